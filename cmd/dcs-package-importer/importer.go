@@ -15,6 +15,7 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Debian/dcs/grpcutil"
@@ -54,6 +55,14 @@ var (
 		false,
 		"Print log messages when files are skipped")
 
+	maxSegments = flag.Int("max_segments",
+		16,
+		"Number of index segments (one per package imported since the last merge) above which the segments are compacted into one")
+
+	compactInterval = flag.Duration("compact_interval",
+		1*time.Minute,
+		"How often to check whether the index segments need to be compacted")
+
 	tmpdir string
 
 	failedDpkgSourceExtracts = prometheus.NewCounter(
@@ -92,6 +101,18 @@ var (
 			Help: "Successful package imports.",
 		})
 
+	successfulSegmentAppends = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "segment_appends_successful",
+			Help: "Successful index segment appends.",
+		})
+
+	successfulSegmentCompactions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "segment_compactions_successful",
+			Help: "Successful index segment compactions.",
+		})
+
 	successfulPackageIndexes = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "package_indexes_successful",
@@ -115,6 +136,8 @@ func init() {
 	prometheus.MustRegister(successfulGarbageCollects)
 	prometheus.MustRegister(successfulMerges)
 	prometheus.MustRegister(successfulPackageImports)
+	prometheus.MustRegister(successfulSegmentAppends)
+	prometheus.MustRegister(successfulSegmentCompactions)
 	prometheus.MustRegister(successfulPackageIndexes)
 	prometheus.MustRegister(filesInIndex)
 }
@@ -124,6 +147,10 @@ type server struct {
 	mergesem  chan struct{} // semaphore for merge
 }
 
+// segmentsMu serializes publishing newly indexed packages (which appends
+// index segments), compacting segments and replacing the index after merges.
+var segmentsMu sync.Mutex
+
 // Accepts arbitrary files for a given package and starts unpacking once a .dsc
 // file is uploaded. E.g.:
 //
@@ -272,10 +299,24 @@ func (s *server) GarbageCollect(ctx context.Context, req *packageimporterpb.Garb
 		return nil, err
 	}
 
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
 	if err := os.RemoveAll(filepath.Join(*shardPath, "idx", pkg)); err != nil {
 		return nil, err
 	}
 
+	// Remove the package from the index which the source backend serves
+	// right away instead of with the next merge.
+	n, err := deletePackages(filepath.Join(*shardPath, "full"), []string{pkg})
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		if err := reloadIndex(); err != nil {
+			return nil, err
+		}
+	}
+
 	successfulGarbageCollects.Inc()
 	return &packageimporterpb.GarbageCollectReply{}, nil
 }
@@ -361,6 +402,50 @@ func mergeToShard() error {
 
 	successfulMerges.Inc()
 
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
+
+	// Packages which were published while merging were only appended as
+	// segments to the previous index, so append them to the new index, too.
+	current, err := packageNames()
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]bool, len(names))
+	for _, name := range names {
+		merged[name] = true
+	}
+	var missing []string
+	for _, name := range current {
+		if !merged[name] {
+			missing = append(missing, filepath.Join(*shardPath, "idx", name))
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("appending %d packages published while merging", len(missing))
+		if _, err := index.AppendSegment(tmpIndexPath, missing); err != nil {
+			return err
+		}
+	}
+	// Likewise, packages which were garbage collected while merging were only
+	// deleted from the previous index.
+	published := make(map[string]bool, len(current))
+	for _, name := range current {
+		published[name] = true
+	}
+	var removed []string
+	for _, name := range names {
+		if !published[name] {
+			removed = append(removed, name)
+		}
+	}
+	if len(removed) > 0 {
+		log.Printf("deleting %d packages garbage collected while merging", len(removed))
+		if _, err := deletePackages(tmpIndexPath, removed); err != nil {
+			return err
+		}
+	}
+
 	conn, err := grpcutil.DialTLS(*sourceBackendAddr, *tlsCertPath, *tlsKeyPath)
 	if err != nil {
 		log.Fatalf("could not connect to %q: %v", *sourceBackendAddr, err)
@@ -381,6 +466,81 @@ func mergeToShard() error {
 	return nil
 }
 
+// reloadIndex makes the source backend re-open its index, e.g. after a
+// segment was appended.
+func reloadIndex() error {
+	conn, err := grpcutil.DialTLS(*sourceBackendAddr, *tlsCertPath, *tlsKeyPath)
+	if err != nil {
+		return fmt.Errorf("could not connect to %q: %v", *sourceBackendAddr, err)
+	}
+	defer conn.Close()
+	sourceBackend := sourcebackendpb.NewSourceBackendClient(conn)
+	if _, err := sourceBackend.ReloadIndex(context.Background(), &sourcebackendpb.ReloadIndexRequest{}); err != nil {
+		return fmt.Errorf("indexBackend.ReloadIndex(): %v", err)
+	}
+	return nil
+}
+
+// appendSegment appends the package index in idxdir as a segment to the index
+// which the source backend serves, so that the package becomes searchable
+// without waiting for the next merge. segmentsMu must be held.
+func appendSegment(idxdir string) error {
+	full, err := filepath.EvalSymlinks(filepath.Join(*shardPath, "full"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // nothing merged yet, the first merge includes idxdir
+		}
+		return err
+	}
+	if _, err := index.AppendSegment(full, []string{idxdir}); err != nil {
+		return err
+	}
+	successfulSegmentAppends.Inc()
+	return reloadIndex()
+}
+
+// deletePackages marks the documents of pkgs as deleted in the index in dir
+// and returns how many documents were deleted. segmentsMu must be held.
+func deletePackages(dir string, pkgs []string) (int, error) {
+	deleted := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		deleted[pkg] = true
+	}
+	return index.Delete(dir, func(fn string) bool {
+		idx := strings.IndexByte(fn, '/')
+		return idx > -1 && deleted[fn[:idx]]
+	})
+}
+
+// compactSegments merges the segments of the index which the source backend
+// serves into one segment once there are more than -max_segments, as each
+// segment needs to be queried separately.
+func compactSegments() error {
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
+	full, err := filepath.EvalSymlinks(filepath.Join(*shardPath, "full"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	names, err := index.ReadSegments(full)
+	if err != nil {
+		return err
+	}
+	if len(names) <= *maxSegments {
+		return nil
+	}
+	t0 := time.Now()
+	if err := index.CompactSegments(full); err != nil {
+		return err
+	}
+	log.Printf("compacted %d segments in %v", len(names), time.Since(t0))
+	successfulSegmentCompactions.Inc()
+	return reloadIndex()
+}
+
 func indexPackage(pkg string) error {
 	log.Printf("Indexing %s\n", pkg)
 	unpacked := filepath.Join(tmpdir, pkg, pkg)
@@ -441,11 +601,19 @@ func indexPackage(pkg string) error {
 		return err
 	}
 
+	// Publish the package: merges include it from now on, and it is appended
+	// to the current index right away.
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
 	finalIndexPath := filepath.Join(*shardPath, "idx", pkg)
 	if err := os.Rename(tmpIndexPath, finalIndexPath); err != nil {
 		return err
 	}
 	successfulPackageIndexes.Inc()
+	if err := appendSegment(finalIndexPath); err != nil {
+		// Not fatal: the package is searchable after the next merge.
+		log.Printf("appendSegment(%q): %v", finalIndexPath, err)
+	}
 	return nil
 }
 
@@ -572,6 +740,14 @@ func main() {
 
 	http.Handle("/metrics", prometheus.Handler())
 
+	go func() {
+		for range time.Tick(*compactInterval) {
+			if err := compactSegments(); err != nil {
+				log.Printf("compactSegments: %v", err)
+			}
+		}
+	}()
+
 	log.Fatal(grpcutil.ListenAndServeTLS(*listenAddress,
 		*tlsCertPath,
 		*tlsKeyPath,
@@ -96,7 +96,7 @@ func main() {
 		}
 	}
 
-	ix, err := index.Open(idx)
+	ix, err := index.OpenSegmented(idx)
 	if err != nil {
 		log.Fatal(err)
 	}
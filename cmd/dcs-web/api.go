@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	jsonContentType   = "application/json"
+)
+
+// negotiateContentType returns the content type in which /api/v1/search
+// should respond given the Accept header accept, or "" if none of the
+// acceptable content types are supported.
+func negotiateContentType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ndjsonContentType
+	}
+	var (
+		best  string
+		bestQ = 0.0
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var contentType string
+		switch mediaType {
+		case ndjsonContentType, "application/jsonl", "application/*", "*/*":
+			contentType = ndjsonContentType
+		case jsonContentType:
+			contentType = jsonContentType
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	return best
+}
+
+// apiEncoder writes the events of an /api/v1/search response, either as
+// newline-delimited JSON objects or as the elements of a JSON array.
+type apiEncoder struct {
+	w       io.Writer
+	flusher http.Flusher
+	array   bool
+	n       int
+}
+
+func (e *apiEncoder) write(event []byte) error {
+	prefix, suffix := "", "\n"
+	if e.array {
+		prefix, suffix = ",\n", ""
+		if e.n == 0 {
+			prefix = "[\n"
+		}
+	}
+	e.n++
+	if _, err := fmt.Fprintf(e.w, "%s%s%s", prefix, event, suffix); err != nil {
+		return err
+	}
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
+
+func (e *apiEncoder) writeMarshal(event interface{}) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return e.write(b)
+}
+
+func (e *apiEncoder) close() error {
+	if !e.array {
+		return nil
+	}
+	if e.n == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+type apiProgress struct {
+	Type           string `json:"type"`
+	FilesProcessed int    `json:"files_processed"`
+	FilesTotal     int    `json:"files_total"`
+	Results        int    `json:"results"`
+	Truncated      bool   `json:"truncated"`
+}
+
+type apiFileSummary struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	Matches uint32 `json:"matches"`
+}
+
+type apiError struct {
+	Type      string `json:"type"`
+	ErrorType string `json:"error_type"`
+	Message   string `json:"message"`
+}
+
+// backendReply is a reply received from the source backend with index
+// backendidx. reply is nil once the backend is done, in which case err is set
+// if the backend failed.
+type backendReply struct {
+	backendidx int
+	reply      *sourcebackendpb.SearchReply
+	err        error
+}
+
+// searchBackend sends the replies of backend to replies, followed by a
+// backendReply without reply once the backend is done.
+func searchBackend(ctx context.Context, backendidx int, backend sourcebackendpb.SourceBackendClient, searchRequest *sourcebackendpb.SearchRequest, replies chan<- backendReply) {
+	send := func(r backendReply) error {
+		select {
+		case replies <- r:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	err := streamBackend(ctx, backend, searchRequest, func(reply *sourcebackendpb.SearchReply) error {
+		return send(backendReply{backendidx: backendidx, reply: reply})
+	})
+	send(backendReply{backendidx: backendidx, err: err})
+}
+
+// APISearchHandler serves /api/v1/search, which streams the results of a
+// query directly from the source backends, without query IDs or result pages.
+// See howto/api.md for the request parameters and response format.
+func APISearchHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+	if contentType == "" {
+		http.Error(w, "Supported content types: "+ndjsonContentType+", "+jsonContentType, http.StatusNotAcceptable)
+		return
+	}
+	release := admitRequest(w, r, r.RemoteAddr)
+	if release == nil {
+		return
+	}
+	defer release()
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	enc := &apiEncoder{
+		w:     w,
+		array: contentType == jsonContentType,
+	}
+	enc.flusher, _ = w.(http.Flusher)
+	defer enc.close()
+
+	q := formQuery(r, r.FormValue("q"))
+	if mode := r.FormValue("mode"); mode != "" {
+		q += "&mode=" + url.QueryEscape(mode)
+	}
+	log.Printf("[%s] (api) Received query %q\n", r.RemoteAddr, q)
+	if err := validateQuery("?" + q); err != nil {
+		log.Printf("[%s] Query %q failed validation: %v\n", r.RemoteAddr, q, err)
+		w.WriteHeader(http.StatusBadRequest)
+		enc.writeMarshal(&apiError{
+			Type:      "error",
+			ErrorType: "invalid_query",
+			Message:   err.Error(),
+		})
+		return
+	}
+	searchRequest := newSearchRequest(q)
+	// Unlike result pages, API responses do not collapse identical matches,
+	// so the source backends do not need to compute file digests.
+	searchRequest.FileDigests = false
+
+	if r.FormValue("explain") == "1" {
+		if err := explainBackends(r.Context(), enc, searchRequest); err != nil {
+			log.Printf("[%s] aborting, could not write: %v\n", r.RemoteAddr, err)
+			return
+		}
+		enc.writeMarshal(struct {
+			Type string `json:"type"`
+		}{"done"})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	replies := make(chan backendReply)
+	for idx, backend := range common.SourceBackendStubs {
+		go searchBackend(ctx, idx, backend, searchRequest, replies)
+	}
+
+	var (
+		filesProcessed = make([]int, len(common.SourceBackendStubs))
+		filesTotal     = make([]int, len(common.SourceBackendStubs))
+		truncated      bool
+		results        int
+		buf            bytes.Buffer
+	)
+	progress := func() *apiProgress {
+		p := &apiProgress{
+			Type:      "progress",
+			Results:   results,
+			Truncated: truncated,
+		}
+		for idx := range filesTotal {
+			p.FilesProcessed += filesProcessed[idx]
+			p.FilesTotal += filesTotal[idx]
+		}
+		return p
+	}
+	for remaining := len(common.SourceBackendStubs); remaining > 0; {
+		reply := <-replies
+		var err error
+		switch {
+		case reply.reply == nil:
+			remaining--
+			if reply.err != nil {
+				err = enc.writeMarshal(&apiError{
+					Type:      "error",
+					ErrorType: "backend_unavailable",
+					Message:   reply.err.Error(),
+				})
+			}
+
+		case reply.reply.Type == sourcebackendpb.SearchReply_MATCH:
+			results++
+			// Like exports, API responses are not displayed in a browser.
+			unescapeMatch(reply.reply.Match)
+			buf.Reset()
+			buf.WriteString(`{"type":"match","match":`)
+			if merr := WriteMatchJSON(reply.reply.Match, &buf); merr != nil {
+				log.Printf("[%s] Could not marshal result as JSON: %v\n", r.RemoteAddr, merr)
+				err = enc.writeMarshal(&apiError{
+					Type:      "error",
+					ErrorType: "failed",
+					Message:   "could not marshal result: " + merr.Error(),
+				})
+				break
+			}
+			buf.WriteByte('}')
+			err = enc.write(buf.Bytes())
+
+		case reply.reply.Type == sourcebackendpb.SearchReply_FILE_SUMMARY:
+			results++
+			err = enc.writeMarshal(&apiFileSummary{
+				Type:    "file_summary",
+				Path:    reply.reply.FileSummary.Path,
+				Matches: reply.reply.FileSummary.Matches,
+			})
+
+		case reply.reply.Type == sourcebackendpb.SearchReply_PROGRESS_UPDATE:
+			update := reply.reply.ProgressUpdate
+			filesProcessed[reply.backendidx] = int(update.FilesProcessed)
+			filesTotal[reply.backendidx] = int(update.FilesTotal)
+			truncated = truncated || update.Truncated
+			err = enc.writeMarshal(progress())
+		}
+		if err != nil {
+			log.Printf("[%s] aborting, could not write: %v\n", r.RemoteAddr, err)
+			return
+		}
+	}
+	enc.writeMarshal(struct {
+		Type string `json:"type"`
+	}{"done"})
+}
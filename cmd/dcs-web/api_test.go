@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"google.golang.org/grpc"
+)
+
+// fakeBackend is a source backend which replies to every search with replies.
+type fakeBackend struct {
+	// Only Search is implemented.
+	sourcebackendpb.SourceBackendClient
+
+	replies []*sourcebackendpb.SearchReply
+	request *sourcebackendpb.SearchRequest // the last request
+}
+
+func (b *fakeBackend) Search(ctx context.Context, in *sourcebackendpb.SearchRequest, opts ...grpc.CallOption) (sourcebackendpb.SourceBackend_SearchClient, error) {
+	b.request = in
+	return &fakeSearchClient{replies: b.replies}, nil
+}
+
+type fakeSearchClient struct {
+	grpc.ClientStream
+	replies []*sourcebackendpb.SearchReply
+}
+
+func (c *fakeSearchClient) Recv() (*sourcebackendpb.SearchReply, error) {
+	if len(c.replies) == 0 {
+		return nil, io.EOF
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return reply, nil
+}
+
+func TestAPISearchUnescaped(t *testing.T) {
+	const line = `#include <stdio.h> // a && b`
+	escaped := html.EscapeString(line)
+	start := strings.Index(escaped, "stdio")
+	defer func(old []sourcebackendpb.SourceBackendClient) { common.SourceBackendStubs = old }(common.SourceBackendStubs)
+	backend := &fakeBackend{replies: []*sourcebackendpb.SearchReply{
+		{
+			Type: sourcebackendpb.SearchReply_MATCH,
+			Match: &sourcebackendpb.Match{
+				Path:       "i3-wm_4.16/i3.c",
+				Line:       1,
+				Package:    "i3-wm_4.16",
+				Context:    escaped,
+				After:      []string{html.EscapeString("int x = 1 < 2;")},
+				MatchRange: &sourcebackendpb.Range{Start: int32(start), End: int32(start + len("stdio"))},
+			},
+		},
+		{
+			Type: sourcebackendpb.SearchReply_PROGRESS_UPDATE,
+			ProgressUpdate: &sourcebackendpb.ProgressUpdate{
+				FilesProcessed: 1,
+				FilesTotal:     1,
+			},
+		},
+	}}
+	common.SourceBackendStubs = []sourcebackendpb.SourceBackendClient{backend}
+
+	rec := httptest.NewRecorder()
+	APISearchHandler(rec, httptest.NewRequest("GET", "/api/v1/search?q=stdio", nil))
+	var types []string
+	dec := json.NewDecoder(rec.Body)
+	for {
+		var event struct {
+			Type  string `json:"type"`
+			Match struct {
+				Context    string   `json:"context"`
+				After      []string `json:"after"`
+				MatchRange struct {
+					Start int `json:"start"`
+					End   int `json:"end"`
+				} `json:"match_range"`
+			} `json:"match"`
+		}
+		if err := dec.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, event.Type)
+		if event.Type != "match" {
+			continue
+		}
+		m := event.Match
+		if m.Context != line {
+			t.Errorf("context = %q, want %q", m.Context, line)
+		}
+		if want := "int x = 1 < 2;"; len(m.After) != 1 || m.After[0] != want {
+			t.Errorf("after = %q, want [%q]", m.After, want)
+		}
+		if got := m.Context[m.MatchRange.Start:m.MatchRange.End]; got != "stdio" {
+			t.Errorf("match_range refers to %q, want %q", got, "stdio")
+		}
+	}
+	if got, want := strings.Join(types, ","), "match,progress,done"; got != want {
+		t.Errorf("event types = %s, want %s", got, want)
+	}
+	// API responses do not collapse identical matches.
+	if backend.request.FileDigests {
+		t.Errorf("API search requested file digests")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	apiKeysPath = flag.String("api_keys_path",
+		"",
+		"Path to a file containing API keys and their limits, see howto/api.md. If empty, all queries are accepted without limits.")
+
+	apiKeyQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_key_queries",
+			Help: "Number of queries per API key name and outcome (ok, rate_limited, concurrency_limited).",
+		},
+		[]string{"key", "outcome"})
+
+	apiKeyActiveQueries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_key_queries_active",
+			Help: "Number of active queries per API key name.",
+		},
+		[]string{"key"})
+
+	// apiKeys is nil unless -api_keys_path is set.
+	apiKeys *keyring
+)
+
+func init() {
+	prometheus.MustRegister(apiKeyQueries)
+	prometheus.MustRegister(apiKeyActiveQueries)
+}
+
+// anonymousKey is the key (in the API keys file) whose limits apply to all
+// queries which do not specify an API key.
+const anonymousKey = "*"
+
+const (
+	apiKeyHeader   = "X-Dcs-Api-Key"
+	apiKeyParam    = "apikey"
+	apiKeyMetadata = "x-dcs-api-key"
+)
+
+var (
+	errUnknownKey         = errors.New("unknown API key")
+	errRateLimited        = errors.New("rate limit exceeded")
+	errConcurrencyLimited = errors.New("too many concurrent queries")
+)
+
+// tokenBucket allows rate events per second on average and bursts of up to
+// burst events.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// take removes a token from the bucket. If the bucket is empty, take returns
+// false and how long it takes until a token is available.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// apiKey holds the limits of a single API key. A rate of 0 means no rate
+// limit, a maxConcurrent of 0 means no concurrency limit.
+type apiKey struct {
+	name          string
+	bucket        *tokenBucket
+	maxConcurrent int
+
+	mu     sync.Mutex
+	active int
+}
+
+type keyring struct {
+	keys map[string]*apiKey
+}
+
+// loadKeyring reads API keys from path. Each non-empty line which does not
+// start with # describes one key:
+//
+//	<name> <key> <queries per second> <burst> <max concurrent queries>
+//
+// Use * as key to limit queries which do not specify an API key.
+func loadKeyring(path string) (*keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	kr := &keyring{keys: make(map[string]*apiKey)}
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("%s:%d: expected 5 fields, got %d", path, lineno, len(fields))
+		}
+		name, key := fields[0], fields[1]
+		rate, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid rate: %v", path, lineno, err)
+		}
+		burst, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid burst: %v", path, lineno, err)
+		}
+		maxConcurrent, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid max concurrent queries: %v", path, lineno, err)
+		}
+		if rate < 0 || burst < 0 || maxConcurrent < 0 {
+			return nil, fmt.Errorf("%s:%d: limits must not be negative", path, lineno)
+		}
+		if rate > 0 && burst < 1 {
+			return nil, fmt.Errorf("%s:%d: burst must be at least 1 when rate limiting", path, lineno)
+		}
+		if _, ok := kr.keys[key]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key", path, lineno)
+		}
+		k := &apiKey{
+			name:          name,
+			maxConcurrent: maxConcurrent,
+		}
+		if rate > 0 {
+			k.bucket = newTokenBucket(rate, float64(burst))
+		}
+		kr.keys[key] = k
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// acquire admits a query made with key (which is empty for queries without
+// an API key). On success, the returned function must be called once the
+// query is done. Otherwise, retryAfter is set for rate limited queries.
+func (kr *keyring) acquire(key string) (release func(), retryAfter time.Duration, err error) {
+	noop := func() {}
+	if kr == nil {
+		return noop, 0, nil
+	}
+	if key == "" {
+		key = anonymousKey
+	}
+	k, ok := kr.keys[key]
+	if !ok {
+		if key == anonymousKey {
+			return noop, 0, nil
+		}
+		return nil, 0, errUnknownKey
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// Check the concurrency limit first, so that rejected queries do not
+	// consume a token.
+	if k.maxConcurrent > 0 && k.active >= k.maxConcurrent {
+		apiKeyQueries.WithLabelValues(k.name, "concurrency_limited").Inc()
+		return nil, 0, errConcurrencyLimited
+	}
+	if k.bucket != nil {
+		if ok, wait := k.bucket.take(time.Now()); !ok {
+			apiKeyQueries.WithLabelValues(k.name, "rate_limited").Inc()
+			return nil, wait, errRateLimited
+		}
+	}
+	k.active++
+	apiKeyQueries.WithLabelValues(k.name, "ok").Inc()
+	apiKeyActiveQueries.WithLabelValues(k.name).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			k.active--
+			apiKeyActiveQueries.WithLabelValues(k.name).Dec()
+		})
+	}, 0, nil
+}
+
+// requestAPIKey returns the API key specified in the X-Dcs-Api-Key header or
+// the apikey parameter of r.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	return r.FormValue(apiKeyParam)
+}
+
+// admitRequest calls apiKeys.acquire for the API key of r and responds with
+// an error if the query is not admitted, in which case release is nil.
+func admitRequest(w http.ResponseWriter, r *http.Request, src string) (release func()) {
+	release, retryAfter, err := apiKeys.acquire(requestAPIKey(r))
+	if err == nil {
+		return release
+	}
+	log.Printf("[%s] query rejected: %v\n", src, err)
+	switch err {
+	case errUnknownKey:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errRateLimited:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// admitRPC is like admitRequest, but for gRPC calls, which specify their API
+// key in the x-dcs-api-key metadata.
+func admitRPC(ctx context.Context) (release func(), err error) {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(apiKeyMetadata); len(v) > 0 {
+			key = v[0]
+		}
+	}
+	release, _, err = apiKeys.acquire(key)
+	switch err {
+	case nil:
+		return release, nil
+	case errUnknownKey:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+}
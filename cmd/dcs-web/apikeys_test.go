@@ -0,0 +1,193 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newTokenBucket(2, 3) // 2 tokens per second, bursts of 3
+	for _, tt := range []struct {
+		after    time.Duration // since start
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		// The bucket starts full.
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 500 * time.Millisecond},
+		{250 * time.Millisecond, false, 250 * time.Millisecond},
+		{500 * time.Millisecond, true, 0},
+		// The bucket refills to at most burst tokens.
+		{10 * time.Second, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, false, 500 * time.Millisecond},
+	} {
+		ok, wait := b.take(start.Add(tt.after))
+		if ok != tt.wantOK || wait != tt.wantWait {
+			t.Errorf("take(start+%v) = %v, %v, want %v, %v", tt.after, ok, wait, tt.wantOK, tt.wantWait)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		name     string
+		contents string
+		wantErr  string
+		want     map[string]*apiKey // by key
+	}{
+		{
+			name: "valid",
+			contents: `# name key rate burst concurrent
+codesearch-bot s3cret 0.5 10 2
+
+anonymous * 1 5 0
+unlimited t0ken 0 0 0
+`,
+			want: map[string]*apiKey{
+				"s3cret": {name: "codesearch-bot", maxConcurrent: 2, bucket: newTokenBucket(0.5, 10)},
+				"*":      {name: "anonymous", bucket: newTokenBucket(1, 5)},
+				"t0ken":  {name: "unlimited"},
+			},
+		},
+		{
+			name:     "fields",
+			contents: "bot s3cret 0.5 10\n",
+			wantErr:  ":1: expected 5 fields, got 4",
+		},
+		{
+			name:     "rate",
+			contents: "# comment\nbot s3cret fast 10 2\n",
+			wantErr:  ":2: invalid rate",
+		},
+		{
+			name:     "burst",
+			contents: "bot s3cret 0.5 1.5 2\n",
+			wantErr:  ":1: invalid burst",
+		},
+		{
+			name:     "concurrent",
+			contents: "bot s3cret 0.5 10 many\n",
+			wantErr:  ":1: invalid max concurrent queries",
+		},
+		{
+			name:     "negative",
+			contents: "bot s3cret 0.5 10 -1\n",
+			wantErr:  ":1: limits must not be negative",
+		},
+		{
+			name:     "noburst",
+			contents: "bot s3cret 0.5 0 2\n",
+			wantErr:  ":1: burst must be at least 1",
+		},
+		{
+			name:     "duplicate",
+			contents: "bot * 0.5 10 2\nanonymous * 1 5 0\n",
+			wantErr:  ":2: duplicate key",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(fn, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			kr, err := loadKeyring(fn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadKeyring() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(kr.keys), len(tt.want); got != want {
+				t.Fatalf("loadKeyring() returned %d keys, want %d", got, want)
+			}
+			for key, want := range tt.want {
+				got, ok := kr.keys[key]
+				if !ok {
+					t.Errorf("key %q missing", key)
+					continue
+				}
+				if got.name != want.name || got.maxConcurrent != want.maxConcurrent {
+					t.Errorf("key %q: got name %q, max concurrent %d, want %q, %d", key, got.name, got.maxConcurrent, want.name, want.maxConcurrent)
+				}
+				if (got.bucket == nil) != (want.bucket == nil) {
+					t.Errorf("key %q: got bucket %v, want %v", key, got.bucket, want.bucket)
+				} else if got.bucket != nil && (got.bucket.rate != want.bucket.rate || got.bucket.burst != want.bucket.burst) {
+					t.Errorf("key %q: got rate %v, burst %v, want %v, %v", key, got.bucket.rate, got.bucket.burst, want.bucket.rate, want.bucket.burst)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyringAcquire(t *testing.T) {
+	var nilring *keyring
+	if _, _, err := nilring.acquire("s3cret"); err != nil {
+		t.Errorf("acquire without keyring = %v, want nil", err)
+	}
+
+	kr := &keyring{keys: map[string]*apiKey{
+		"s3cret": {name: "bot", maxConcurrent: 2, bucket: newTokenBucket(0.001, 3)},
+	}}
+	if _, _, err := kr.acquire("wrong"); err != errUnknownKey {
+		t.Errorf("acquire(wrong) = %v, want %v", err, errUnknownKey)
+	}
+	// Without a * key, queries without an API key are not limited.
+	for i := 0; i < 5; i++ {
+		if _, _, err := kr.acquire(""); err != nil {
+			t.Errorf("acquire() = %v, want nil", err)
+		}
+	}
+
+	release1, _, err := kr.acquire("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, _, err := kr.acquire("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Queries rejected by the concurrency limit do not consume tokens.
+	for i := 0; i < 5; i++ {
+		if _, _, err := kr.acquire("s3cret"); err != errConcurrencyLimited {
+			t.Fatalf("acquire(s3cret) = %v, want %v", err, errConcurrencyLimited)
+		}
+	}
+	release1()
+	release1() // releasing twice must not free another slot
+	release3, _, err := kr.acquire("s3cret")
+	if err != nil {
+		t.Fatalf("acquire(s3cret) after release = %v, want nil", err)
+	}
+	if _, _, err := kr.acquire("s3cret"); err != errConcurrencyLimited {
+		t.Fatalf("acquire(s3cret) = %v, want %v", err, errConcurrencyLimited)
+	}
+	release2()
+	release3()
+
+	// All 3 tokens of the burst are used up.
+	_, retryAfter, err := kr.acquire("s3cret")
+	if err != errRateLimited {
+		t.Fatalf("acquire(s3cret) = %v, want %v", err, errRateLimited)
+	}
+	if retryAfter <= 0 {
+		t.Errorf("acquire(s3cret): retryAfter = %v, want > 0", retryAfter)
+	}
+}
@@ -2,11 +2,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"hash/fnv"
-	"io"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
@@ -17,9 +16,11 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 
 	"github.com/Debian/dcs/cmd/dcs-web/common"
 	"github.com/Debian/dcs/cmd/dcs-web/health"
@@ -85,6 +86,46 @@ func init() {
 	prometheus.MustRegister(failedQueries)
 }
 
+// shortLiteralsTTL is the duration for which shortLiteralsSupported caches
+// the capabilities of the source backends, which can be restarted with
+// different flags or re-created indexes.
+const shortLiteralsTTL = 1 * time.Minute
+
+var shortLiterals struct {
+	sync.Mutex
+	checked   time.Time
+	supported bool
+}
+
+// shortLiteralsSupported returns whether all source backends locate short
+// literals (see index.IsShortLiteral) using their index instead of searching
+// all files.
+func shortLiteralsSupported() bool {
+	shortLiterals.Lock()
+	defer shortLiterals.Unlock()
+	if time.Since(shortLiterals.checked) < shortLiteralsTTL {
+		return shortLiterals.supported
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	supported := len(common.SourceBackendStubs) > 0
+	for _, backend := range common.SourceBackendStubs {
+		reply, err := backend.Capabilities(ctx, &sourcebackendpb.CapabilitiesRequest{})
+		if err != nil {
+			log.Printf("Could not query source backend capabilities: %v\n", err)
+			supported = false
+			break
+		}
+		if !reply.ShortLiterals {
+			supported = false
+			break
+		}
+	}
+	shortLiterals.checked = time.Now()
+	shortLiterals.supported = supported
+	return supported
+}
+
 func validateQuery(query string) error {
 	// Parse the query and see whether the resulting trigram query is
 	// non-empty. This is to catch queries like “package:debian”.
@@ -94,18 +135,67 @@ func validateQuery(query string) error {
 	}
 	rewritten := search.RewriteQuery(*fakeUrl)
 	log.Printf("rewritten query = %q\n", rewritten.String())
-	re, err := dcsregexp.Compile(rewritten.Query().Get("q"))
+	opts := search.RegexpOptions(rewritten.Query())
+	re, err := dcsregexp.CompileOptions(rewritten.Query().Get("q"), opts)
 	if err != nil {
 		return err
 	}
+	if _, err := search.ContextLines(rewritten.Query()); err != nil {
+		return err
+	}
+	if _, err := search.ResultMode(rewritten.Query()); err != nil {
+		return err
+	}
 	indexQuery := index.RegexpQuery(re.Syntax)
+	for _, pattern := range rewritten.Query()["and"] {
+		re, err := dcsregexp.CompileOptions(pattern, opts)
+		if err != nil {
+			return fmt.Errorf("+%s: %v", pattern, err)
+		}
+		indexQuery = indexQuery.And(index.RegexpQuery(re.Syntax))
+	}
+	for _, pattern := range rewritten.Query()["not"] {
+		if _, err := dcsregexp.CompileOptions(pattern, opts); err != nil {
+			return fmt.Errorf("-%s: %v", pattern, err)
+		}
+	}
 	log.Printf("trigram = %v, sub = %v", indexQuery.Trigram, indexQuery.Sub)
 	if len(indexQuery.Trigram) == 0 && len(indexQuery.Sub) == 0 {
-		return fmt.Errorf("Empty index query")
+		// Short literals such as “!=” can be served by the positional index.
+		if !index.IsShortLiteral(re.Syntax) {
+			return fmt.Errorf("Empty index query")
+		}
+		if !shortLiteralsSupported() {
+			return fmt.Errorf("Queries shorter than 4 bytes are not supported by the source backends")
+		}
 	}
 	return nil
 }
 
+// formQuery returns the canonical query string (as understood by
+// validateQuery() and maybeStartQuery()) for query and the options in the
+// form values of r.
+func formQuery(r *http.Request, query string) string {
+	literal := r.FormValue("literal")
+	if literal == "" {
+		literal = "0"
+	}
+	q := "q=" + url.QueryEscape(query) + "&literal=" + literal
+	if r.FormValue("case") == "no" {
+		q += "&case=no"
+	}
+	if r.FormValue("word") == "yes" {
+		q += "&word=yes"
+	}
+	if context := r.FormValue("context"); context != "" {
+		q += "&context=" + url.QueryEscape(context)
+	}
+	if r.FormValue("dedup") == "no" {
+		q += "&dedup=no"
+	}
+	return q
+}
+
 func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	query := r.FormValue("q")
@@ -124,11 +214,12 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 		!strings.HasPrefix(r.RemoteAddr, "127.0.0.1:")) {
 		src = r.RemoteAddr
 	}
-	literal := r.FormValue("literal")
-	if literal == "" {
-		literal = "0"
+	release := admitRequest(w, r, src)
+	if release == nil {
+		return
 	}
-	q := "q=" + url.QueryEscape(query) + "&literal=" + literal
+	defer release()
+	q := formQuery(r, query)
 
 	log.Printf("[%s] (events) Received query %q\n", src, q)
 	if err := validateQuery("?" + q); err != nil {
@@ -149,14 +240,9 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Uniquely (well, good enough) identify this query for a couple of minutes
-	// (as long as we want to cache results). We could try to normalize the
-	// query before hashing it, but that seems hardly worth the complexity.
-	h := fnv.New64()
-	io.WriteString(h, q)
-	identifier := fmt.Sprintf("%x", h.Sum64())
+	identifier := queryIdentifier(q)
 
-	cached, err := maybeStartQuery(ctx, identifier, src, q)
+	cached, l, err := maybeStartQuery(ctx, ctx, identifier, src, q)
 	if err != nil {
 		log.Printf("[%s] could not start query: %+v\n", src, err)
 		http.Error(w, "Could not start query", http.StatusInternalServerError)
@@ -181,7 +267,11 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	lastseen := -1
 	sent := 0
 	for {
-		message, sequence := getEvent(identifier, lastseen)
+		message, sequence, err := getEvent(ctx, l, lastseen)
+		if err != nil {
+			log.Printf("[%s] aborting, client went away: %v\n", src, err)
+			return
+		}
 		lastseen = sequence
 		// This message was obsoleted by a more recent one, e.g. a more
 		// recent progress update obsoletes all earlier progress updates.
@@ -232,6 +322,22 @@ func InstantServer(ws *websocket.Conn) {
 		}
 		log.Printf("[%s] Received query %v\n", src, q)
 
+		release, _, err := apiKeys.acquire(requestAPIKey(ws.Request()))
+		if err != nil {
+			log.Printf("[%s] query rejected: %v\n", src, err)
+			b, _ := json.Marshal(struct {
+				Type         string
+				ErrorType    string
+				ErrorMessage string
+			}{
+				Type:         "error",
+				ErrorType:    "ratelimited",
+				ErrorMessage: err.Error(),
+			})
+			ws.Write(b)
+			continue
+		}
+
 		// span := opentracing.SpanFromContext(ctx)
 		// span.SetOperationName("Websocket: " + q.Query)
 
@@ -247,20 +353,21 @@ func InstantServer(ws *websocket.Conn) {
 				ErrorMessage: err.Error(),
 			})
 			ws.Write(b)
+			release()
 			continue
 		}
 
-		// Uniquely (well, good enough) identify this query for a couple of minutes
-		// (as long as we want to cache results). We could try to normalize the
-		// query before hashing it, but that seems hardly worth the complexity.
-		h := fnv.New64()
-		io.WriteString(h, q.Query)
-		identifier := fmt.Sprintf("%x", h.Sum64())
+		identifier := queryIdentifier(q.Query)
 
-		cached, err := maybeStartQuery(ctx, identifier, src, q.Query)
+		// The query is cancelled when the connection is closed before the
+		// query is done, unless other clients are interested in it.
+		queryCtx, cancel := context.WithCancel(ctx)
+		cached, l, err := maybeStartQuery(ctx, queryCtx, identifier, src, q.Query)
 		if err != nil {
 			log.Printf("[%s] could not start query: %v\n", src, err)
 			ws.Write([]byte(`{"Type":"error", "ErrorType":"failed"}`))
+			cancel()
+			release()
 			continue
 		}
 
@@ -280,7 +387,13 @@ func InstantServer(ws *websocket.Conn) {
 
 		lastseen := -1
 		for {
-			message, sequence := getEvent(identifier, lastseen)
+			message, sequence, err := getEvent(queryCtx, l, lastseen)
+			if err != nil {
+				log.Printf("[%s] aborting: %v\n", src, err)
+				cancel()
+				release()
+				return
+			}
 			lastseen = sequence
 			// This message was obsoleted by a more recent one, e.g. a more
 			// recent progress update obsoletes all earlier progress updates.
@@ -294,13 +407,19 @@ func InstantServer(ws *websocket.Conn) {
 			written, err := ws.Write(message.data)
 			if err != nil {
 				log.Printf("[%s] Error writing to websocket, closing: %v\n", src, err)
+				cancel()
+				release()
 				return
 			}
 			if written != len(message.data) {
 				log.Printf("[%s] Could only write %d of %d bytes to websocket, closing.\n", src, written, len(message.data))
+				cancel()
+				release()
 				return
 			}
 		}
+		cancel()
+		release()
 		log.Printf("[%s] query done. waiting for a new one\n", src)
 	}
 }
@@ -308,6 +427,11 @@ func InstantServer(ws *websocket.Conn) {
 func ResultsHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: ideally, this would also start the search in the background to avoid waiting for the round-trip to the client.
 
+	if matches := exportPathRe.FindStringSubmatch(r.URL.Path); matches != nil {
+		ExportHandler(w, r, matches[1])
+		return
+	}
+
 	// Try to match /page_n.json or /perpackage_2_page_n.json
 	matches := resultsPathRe.FindStringSubmatch(r.URL.Path)
 	log.Printf("matches for %q = %v\n", r.URL.Path, matches)
@@ -329,8 +453,7 @@ func ResultsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		queryid := matches[1]
-		_, ok := state[queryid]
-		if !ok {
+		if !queryAvailable(queryid) {
 			http.Error(w, "No such query.", http.StatusNotFound)
 			return
 		}
@@ -360,14 +483,18 @@ func ResultsHandler(w http.ResponseWriter, r *http.Request) {
 		log.Fatalf("Could not convert %q into a number: %v\n", matches[3], err)
 	}
 	perpackage := (matches[2] == "perpackage_2_")
-	_, ok := state[queryid]
-	if !ok {
+	if !queryAvailable(queryid) {
 		http.Error(w, "No such query.", http.StatusNotFound)
 		return
 	}
 
 	if !perpackage {
-		err = writeResults(queryid, page, w, w, r)
+		order, err := parseResultOrder(r.FormValue("sort"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = writeResults(queryid, page, order, w, w, r)
 	} else {
 		err = writePerPkgResults(queryid, page, w, w, r)
 	}
@@ -385,11 +512,36 @@ func (s *server) Search(req *dcspb.SearchRequest, stream dcspb.DCS_SearchServer)
 	span.SetOperationName("gRPC: Search: " + query)
 
 	src := "gRPC" // TODO: get remote address
+	release, err := admitRPC(ctx)
+	if err != nil {
+		log.Printf("[%s] query rejected: %v\n", src, err)
+		return err
+	}
+	defer release()
 	literal := "0"
 	if req.GetLiteral() {
 		literal = "1"
 	}
 	q := "q=" + url.QueryEscape(query) + "&literal=" + literal
+	if req.GetCaseInsensitive() {
+		q += "&case=no"
+	}
+	if req.GetWholeWord() {
+		q += "&word=yes"
+	}
+	// Clients which predate context_lines leave it unset, i.e. the default.
+	if n := req.GetContextLines(); n != nil && n.Value != search.DefaultContextLines {
+		q += "&context=" + strconv.Itoa(int(n.Value))
+	}
+	switch req.GetResultMode() {
+	case sourcebackendpb.SearchRequest_FILES_ONLY:
+		q += "&mode=files"
+	case sourcebackendpb.SearchRequest_COUNT_ONLY:
+		q += "&mode=count"
+	}
+	if req.GetKeepDuplicates() {
+		q += "&dedup=no"
+	}
 
 	log.Printf("[%s] (events) Received query %q\n", src, q)
 	if err := validateQuery("?" + q); err != nil {
@@ -397,14 +549,9 @@ func (s *server) Search(req *dcspb.SearchRequest, stream dcspb.DCS_SearchServer)
 		return fmt.Errorf("invalid query: %v", err)
 	}
 
-	// Uniquely (well, good enough) identify this query for a couple of minutes
-	// (as long as we want to cache results). We could try to normalize the
-	// query before hashing it, but that seems hardly worth the complexity.
-	h := fnv.New64()
-	io.WriteString(h, q)
-	identifier := fmt.Sprintf("%x", h.Sum64())
+	identifier := queryIdentifier(q)
 
-	cached, err := maybeStartQuery(ctx, identifier, src, q)
+	cached, l, err := maybeStartQuery(ctx, ctx, identifier, src, q)
 	if err != nil {
 		return fmt.Errorf("query(%s): %v", query, err)
 	}
@@ -425,7 +572,10 @@ func (s *server) Search(req *dcspb.SearchRequest, stream dcspb.DCS_SearchServer)
 
 	lastseen := -1
 	for {
-		message, sequence := getEvent(identifier, lastseen)
+		message, sequence, err := getEvent(ctx, l, lastseen)
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
 		lastseen = sequence
 		// This message was obsoleted by a more recent one, e.g. a more
 		// recent progress update obsoletes all earlier progress updates.
@@ -463,6 +613,7 @@ func toEventProto(data []byte) (*dcspb.Event, error) {
 			FilesProcessed int
 			FilesTotal     int
 			Results        int
+			Truncated      bool
 		}
 		if err := json.Unmarshal(data, &p); err != nil {
 			return nil, err
@@ -474,6 +625,50 @@ func toEventProto(data []byte) (*dcspb.Event, error) {
 					FilesProcessed: int64(p.FilesProcessed),
 					FilesTotal:     int64(p.FilesTotal),
 					Results:        int64(p.Results),
+					Truncated:      p.Truncated,
+				},
+			},
+		}, nil
+
+	case "error":
+		var e struct {
+			ErrorType    string
+			ErrorMessage string
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		errorType, ok := map[string]dcspb.Error_ErrorType{
+			"cancelled":          dcspb.Error_CANCELLED,
+			"backendunavailable": dcspb.Error_BACKEND_UNAVAILABLE,
+			"failed":             dcspb.Error_FAILED,
+			"invalidquery":       dcspb.Error_INVALID_QUERY,
+		}[e.ErrorType]
+		if !ok {
+			return nil, fmt.Errorf("unhandled error type %q", e.ErrorType)
+		}
+		return &dcspb.Event{
+			Data: &dcspb.Event_Error{
+				Error: &dcspb.Error{
+					Type:    errorType,
+					Message: e.ErrorMessage,
+				},
+			},
+		}, nil
+
+	case "filesummary":
+		var f struct {
+			Path    string
+			Matches uint32
+		}
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+		return &dcspb.Event{
+			Data: &dcspb.Event_FileSummary{
+				FileSummary: &sourcebackendpb.FileSummary{
+					Path:    f.Path,
+					Matches: f.Matches,
 				},
 			},
 		}, nil
@@ -536,6 +731,11 @@ func main() {
 	defer closer.Close()
 
 	common.Init(*tlsCertPath, *tlsKeyPath, *staticPath)
+	loadRankingData()
+
+	if err := loadQueryCache(*queryResultsPath); err != nil {
+		log.Fatal(err)
+	}
 
 	if *accessLogPath != "" {
 		var err error
@@ -553,6 +753,14 @@ func main() {
 		}
 	}
 
+	if *apiKeysPath != "" {
+		var err error
+		apiKeys, err = loadKeyring(*apiKeysPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	fmt.Printf("Debian Code Search webapp, version %s\n", common.Version)
 
 	health.StartChecking()
@@ -604,6 +812,7 @@ func main() {
 	http.HandleFunc("/perpackage-results/", PerPackageResultsHandler)
 	http.HandleFunc("/queryz", QueryzHandler)
 	http.HandleFunc("/track", Track)
+	http.HandleFunc("/api/v1/search", APISearchHandler)
 
 	traced := http.NewServeMux()
 	traced.HandleFunc("/search", Search)
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"google.golang.org/grpc"
+)
+
+// capabilitiesBackend is a source backend which only implements Capabilities.
+type capabilitiesBackend struct {
+	sourcebackendpb.SourceBackendClient
+
+	shortLiterals bool
+	calls         int
+}
+
+func (b *capabilitiesBackend) Capabilities(ctx context.Context, in *sourcebackendpb.CapabilitiesRequest, opts ...grpc.CallOption) (*sourcebackendpb.CapabilitiesReply, error) {
+	b.calls++
+	return &sourcebackendpb.CapabilitiesReply{ShortLiterals: b.shortLiterals}, nil
+}
+
+func TestValidateQueryShortLiterals(t *testing.T) {
+	defer func(old []sourcebackendpb.SourceBackendClient) { common.SourceBackendStubs = old }(common.SourceBackendStubs)
+	defer func() { shortLiterals.checked = time.Time{} }()
+	positional := &capabilitiesBackend{shortLiterals: true}
+	for _, tt := range []struct {
+		desc     string
+		backends []sourcebackendpb.SourceBackendClient
+		wantOK   bool
+	}{
+		{"positional", []sourcebackendpb.SourceBackendClient{positional, &capabilitiesBackend{shortLiterals: true}}, true},
+		{"mixed", []sourcebackendpb.SourceBackendClient{positional, &capabilitiesBackend{}}, false},
+		{"none", nil, false},
+	} {
+		common.SourceBackendStubs = tt.backends
+		shortLiterals.checked = time.Time{}
+		for _, q := range []string{"q=!%3D&literal=1", "q=->&literal=0"} {
+			if err := validateQuery("?" + q); (err == nil) != tt.wantOK {
+				t.Errorf("%s: validateQuery(%q) = %v, want ok = %v", tt.desc, q, err, tt.wantOK)
+			}
+		}
+		// Neither short nor indexable, regardless of the source backends.
+		if err := validateQuery("?q=.&literal=0"); err == nil {
+			t.Errorf("%s: validateQuery(.) unexpectedly succeeded", tt.desc)
+		}
+	}
+	// The capabilities are cached instead of being queried for every query.
+	if got, want := positional.calls, 2; got != want {
+		t.Errorf("Capabilities called %d times, want %d", got, want)
+	}
+}
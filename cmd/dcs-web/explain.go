@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+)
+
+type apiTrigramExplanation struct {
+	Trigram string `json:"trigram"`
+	Entries uint32 `json:"entries"`
+	Docids  int32  `json:"docids"`
+}
+
+type apiQueryExplanation struct {
+	Op        string                  `json:"op"`
+	Trigrams  []apiTrigramExplanation `json:"trigrams,omitempty"`
+	StoppedAt int32                   `json:"stopped_at"`
+	Sub       []*apiQueryExplanation  `json:"sub,omitempty"`
+	Docids    uint32                  `json:"docids"`
+}
+
+func newAPIQueryExplanation(ex *sourcebackendpb.QueryExplanation) *apiQueryExplanation {
+	if ex == nil {
+		return nil
+	}
+	result := &apiQueryExplanation{
+		Op:        ex.Op,
+		StoppedAt: ex.StoppedAt,
+		Docids:    ex.Docids,
+	}
+	for _, te := range ex.Trigrams {
+		result.Trigrams = append(result.Trigrams, apiTrigramExplanation{
+			Trigram: string(te.Trigram),
+			Entries: te.Entries,
+			Docids:  te.Docids,
+		})
+	}
+	for _, sub := range ex.Sub {
+		result.Sub = append(result.Sub, newAPIQueryExplanation(sub))
+	}
+	return result
+}
+
+type apiExplain struct {
+	Type           string                 `json:"type"`
+	Backend        int                    `json:"backend"`
+	Shard          string                 `json:"shard"`
+	Query          string                 `json:"query"`
+	Candidates     uint32                 `json:"candidates"`
+	PositionalPlan string                 `json:"positional_plan,omitempty"`
+	Explanations   []*apiQueryExplanation `json:"explanations,omitempty"`
+}
+
+// explainBackends writes how each source backend finds the candidate files
+// for searchRequest, in the order of the backends.
+func explainBackends(ctx context.Context, enc *apiEncoder, searchRequest *sourcebackendpb.SearchRequest) error {
+	replies := make([]*sourcebackendpb.ExplainReply, len(common.SourceBackendStubs))
+	errs := make([]error, len(common.SourceBackendStubs))
+	var wg sync.WaitGroup
+	for idx, backend := range common.SourceBackendStubs {
+		wg.Add(1)
+		go func(idx int, backend sourcebackendpb.SourceBackendClient) {
+			defer wg.Done()
+			replies[idx], errs[idx] = backend.Explain(ctx, searchRequest)
+		}(idx, backend)
+	}
+	wg.Wait()
+	for idx, reply := range replies {
+		var err error
+		if errs[idx] != nil {
+			err = enc.writeMarshal(&apiError{
+				Type:      "error",
+				ErrorType: "backend_unavailable",
+				Message:   errs[idx].Error(),
+			})
+		} else {
+			explanations := make([]*apiQueryExplanation, len(reply.Explanations))
+			for i, ex := range reply.Explanations {
+				explanations[i] = newAPIQueryExplanation(ex)
+			}
+			err = enc.writeMarshal(&apiExplain{
+				Type:           "explain",
+				Backend:        idx,
+				Shard:          reply.Shard,
+				Query:          reply.Query,
+				Candidates:     reply.Candidates,
+				PositionalPlan: reply.PositionalPlan,
+				Explanations:   explanations,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
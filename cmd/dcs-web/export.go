@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+)
+
+var exportPathRe = regexp.MustCompile(`^/results/([^/]+)/export$`)
+
+// exportFormats maps the supported format= values of
+// /results/<queryid>/export to their content type and file name extension.
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	// One row per result: package, path, line, ranking and context (the
+	// line containing the match).
+	"csv": {"text/csv; charset=utf-8", "csv"},
+	// One JSON object per result, as in page_N.json, but with the lines not
+	// HTML-escaped.
+	"jsonl": {"application/x-ndjson", "jsonl"},
+	// One unique package/path per line, e.g. for feeding into xargs.
+	"paths": {"text/plain; charset=utf-8", "txt"},
+}
+
+// unescapeLines returns lines without the HTML escaping of the source
+// backends.
+func unescapeLines(lines []string) []string {
+	unescaped := make([]string, len(lines))
+	for i, line := range lines {
+		unescaped[i] = html.UnescapeString(line)
+	}
+	return unescaped
+}
+
+// unescapeMatch undoes the HTML escaping of the lines of match, which is only
+// useful for displaying them in a browser, and adjusts the match ranges to
+// refer to the unescaped context.
+func unescapeMatch(match *sourcebackendpb.Match) {
+	unescapeRange := func(r *sourcebackendpb.Range) {
+		if r == nil || r.Start < 0 || r.Start > r.End || int(r.End) > len(match.Context) {
+			return
+		}
+		r.Start = int32(len(html.UnescapeString(match.Context[:r.Start])))
+		r.End = int32(len(html.UnescapeString(match.Context[:r.End])))
+	}
+	unescapeRange(match.MatchRange)
+	for _, r := range match.SubmatchRanges {
+		unescapeRange(r)
+	}
+	match.Context = html.UnescapeString(match.Context)
+	match.Before = unescapeLines(match.Before)
+	match.After = unescapeLines(match.After)
+	match.Ctxp2 = html.UnescapeString(match.Ctxp2)
+	match.Ctxp1 = html.UnescapeString(match.Ctxp1)
+	match.Ctxn1 = html.UnescapeString(match.Ctxn1)
+	match.Ctxn2 = html.UnescapeString(match.Ctxn2)
+}
+
+// exportPointers returns the result pointers of queryid in the specified
+// order, including the identical matches which were collapsed into another
+// result (see collapseDuplicates), so that exports list every matching file.
+func exportPointers(queryid string, order resultOrder) ([]resultPointer, error) {
+	stateMu.RLock()
+	s := state[queryid]
+	stateMu.RUnlock()
+	if len(s.duplicates) == 0 {
+		return sortedPointers(queryid, order)
+	}
+	pointers := make([]resultPointer, 0, len(s.resultPointers))
+	for _, pointer := range s.resultPointers {
+		pointers = append(pointers, pointer)
+		pointers = append(pointers, s.duplicates[pointer.key()]...)
+	}
+	sort.Stable(pointerByRanking(pointers))
+	if order == orderRanking {
+		return pointers, nil
+	}
+	return sortPointers(queryid, pointers, order)
+}
+
+// exportResults writes all results of queryid to w, in the specified format
+// and order.
+func exportResults(queryid, format string, order resultOrder, w io.Writer) error {
+	pointers, err := exportPointers(queryid, order)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	var (
+		fn func(match *sourcebackendpb.Match) error
+		cw *csv.Writer
+	)
+	switch format {
+	case "csv":
+		cw = csv.NewWriter(bw)
+		if err := cw.Write([]string{"package", "path", "line", "ranking", "context"}); err != nil {
+			return err
+		}
+		fn = func(match *sourcebackendpb.Match) error {
+			unescapeMatch(match)
+			return cw.Write([]string{
+				match.Package,
+				match.Path,
+				strconv.FormatUint(uint64(match.Line), 10),
+				strconv.FormatFloat(float64(match.Ranking), 'g', -1, 32),
+				match.Context,
+			})
+		}
+
+	case "jsonl":
+		fn = func(match *sourcebackendpb.Match) error {
+			unescapeMatch(match)
+			if err := WriteMatchJSON(match, bw); err != nil {
+				return err
+			}
+			return bw.WriteByte('\n')
+		}
+
+	case "paths":
+		seen := make(map[string]bool)
+		fn = func(match *sourcebackendpb.Match) error {
+			// match.Path already starts with the package, e.g.
+			// i3-wm_4.16.1-1/i3bar/src/xcb.c
+			if seen[match.Path] {
+				return nil
+			}
+			seen[match.Path] = true
+			_, err := fmt.Fprintln(bw, match.Path)
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	if err := readAllFromPointers(queryid, pointers, fn); err != nil {
+		return err
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportHandler serves /results/<queryid>/export?format=csv|jsonl|paths,
+// i.e. all results of a finished query at once. The optional sort= parameter
+// selects the order, as for the result pages.
+func ExportHandler(w http.ResponseWriter, r *http.Request, queryid string) {
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	ft, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid format %q, expected csv, jsonl or paths", format), http.StatusBadRequest)
+		return
+	}
+	order, err := parseResultOrder(r.FormValue("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !queryAvailable(queryid) {
+		http.Error(w, "No such query.", http.StatusNotFound)
+		return
+	}
+	stateMu.RLock()
+	done := state[queryid].done
+	stateMu.RUnlock()
+	if !done {
+		http.Error(w, "Query not finished yet.", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", ft.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"dcs-%s.%s\"", queryid, ft.extension))
+	if err := exportResults(queryid, format, order, w); err != nil {
+		// The response is likely partially written at this point, so all we
+		// can do is log the error.
+		log.Printf("[%s] export failed: %v\n", queryid, err)
+	}
+}
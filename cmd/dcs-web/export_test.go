@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"hash/fnv"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/stringpool"
+	"github.com/golang/protobuf/proto"
+)
+
+// storeTestQuery makes matches (as sent by a single source backend) the
+// results of the finished query queryid, like queryBackend and writeToDisk.
+// The returned function removes the query again.
+func storeTestQuery(t *testing.T, queryid string, matches []*sourcebackendpb.Match) (cleanup func()) {
+	t.Helper()
+	f, err := ioutil.TempFile("", "dcs-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bstate := &perBackendState{
+		tempFile:    f,
+		packagePool: stringpool.NewStringPool(),
+	}
+	for _, match := range matches {
+		b, err := proto.Marshal(&sourcebackendpb.SearchReply{
+			Type:  sourcebackendpb.SearchReply_MATCH,
+			Match: match,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := fnv.New64()
+		io.WriteString(h, match.Path)
+		bstate.resultPointers = append(bstate.resultPointers, resultPointer{
+			ranking:     match.Ranking,
+			offset:      bstate.tempFileOffset,
+			length:      len(b),
+			pathHash:    h.Sum64(),
+			packageName: bstate.packagePool.Get(match.Package),
+			dupKey:      dupKey(match),
+		})
+		if _, err := f.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		bstate.tempFileOffset += int64(len(b))
+	}
+	pointers := append([]resultPointer(nil), bstate.resultPointers...)
+	sort.Sort(pointerByRanking(pointers))
+	results, alsoIn, duplicates := collapseDuplicates(pointers)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state[queryid] = queryState{
+		done:           true,
+		newEvent:       sync.NewCond(&stateMu),
+		tempFilesMu:    &sync.Mutex{},
+		perBackend:     []*perBackendState{bstate},
+		resultPointers: results,
+		alsoIn:         alsoIn,
+		duplicates:     duplicates,
+		sorted:         newSortedResults(),
+	}
+	return func() {
+		stateMu.Lock()
+		delete(state, queryid)
+		stateMu.Unlock()
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestExportUnescaped(t *testing.T) {
+	const line = `#include <stdio.h> // a && b`
+	context := html.EscapeString(line)
+	start := strings.Index(context, "stdio")
+	cleanup := storeTestQuery(t, "unescaped", []*sourcebackendpb.Match{
+		{
+			Path:       "i3-wm_4.16/i3.c",
+			Line:       1,
+			Package:    "i3-wm_4.16",
+			Context:    context,
+			After:      []string{html.EscapeString("int x = 1 < 2;")},
+			MatchRange: &sourcebackendpb.Range{Start: int32(start), End: int32(start + len("stdio"))},
+		},
+	})
+	defer cleanup()
+
+	var buf bytes.Buffer
+	if err := exportResults("unescaped", "csv", orderRanking, &buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("csv export: got %d records, want 2", len(records))
+	}
+	if got := records[1][4]; got != line {
+		t.Errorf("csv export: context = %q, want %q", got, line)
+	}
+
+	buf.Reset()
+	if err := exportResults("unescaped", "jsonl", orderRanking, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var match struct {
+		Context    string   `json:"context"`
+		After      []string `json:"after"`
+		MatchRange struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		} `json:"match_range"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &match); err != nil {
+		t.Fatal(err)
+	}
+	if match.Context != line {
+		t.Errorf("jsonl export: context = %q, want %q", match.Context, line)
+	}
+	if want := []string{"int x = 1 < 2;"}; !reflect.DeepEqual(match.After, want) {
+		t.Errorf("jsonl export: after = %q, want %q", match.After, want)
+	}
+	if got := match.Context[match.MatchRange.Start:match.MatchRange.End]; got != "stdio" {
+		t.Errorf("jsonl export: match_range refers to %q, want %q", got, "stdio")
+	}
+}
+
+func TestExportDuplicates(t *testing.T) {
+	digest := sha256.Sum256([]byte("int main() { i3Font(); }\n"))
+	match := func(path string, ranking float32) *sourcebackendpb.Match {
+		return &sourcebackendpb.Match{
+			Path:       path,
+			Line:       1,
+			Package:    path[:strings.Index(path, "/")],
+			Context:    "int main() { i3Font(); }",
+			MatchRange: &sourcebackendpb.Range{Start: 13, End: 19},
+			Ranking:    ranking,
+			FileDigest: digest[:],
+		}
+	}
+	cleanup := storeTestQuery(t, "duplicates", []*sourcebackendpb.Match{
+		match("i3-wm_4.16/i3.c", 0.9),
+		match("xterm_344/vendor/i3.c", 0.5),
+		match("zsh_5.7/zsh.c", 0.7),
+	})
+	defer cleanup()
+
+	stateMu.RLock()
+	numResults := len(state["duplicates"].resultPointers)
+	stateMu.RUnlock()
+	if numResults != 1 {
+		t.Fatalf("identical matches not collapsed: got %d results, want 1", numResults)
+	}
+
+	for _, tt := range []struct {
+		order resultOrder
+		want  string
+	}{
+		{orderRanking, "i3-wm_4.16/i3.c\nzsh_5.7/zsh.c\nxterm_344/vendor/i3.c\n"},
+		{orderPath, "i3-wm_4.16/i3.c\nxterm_344/vendor/i3.c\nzsh_5.7/zsh.c\n"},
+	} {
+		var buf bytes.Buffer
+		if err := exportResults("duplicates", "paths", tt.order, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("paths export (sort=%s) = %q, want %q", tt.order, got, tt.want)
+		}
+	}
+}
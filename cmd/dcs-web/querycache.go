@@ -0,0 +1,659 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Debian/dcs/stringpool"
+	"github.com/google/renameio"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The query cache makes the results of completed queries survive dcs-web
+// restarts: once a query is finished, its state (result pointers, per-package
+// results, events, stats) is written to <query_results_path>/<queryid>/state.json
+// next to the unsorted_<n>.pb files it points into, and the query is added to
+// the cache index, <query_results_path>/cache.json, which is loaded on
+// startup. Queries which are not in the state map anymore (e.g. after a
+// restart or garbage collection) are restored from disk when requested.
+//
+// Cache entries expire -query_cache_ttl after their query was started. When
+// the cache exceeds -query_cache_max_bytes, or when the file system runs out
+// of headroom (see ensureEnoughSpaceAvailable), the least recently used
+// entries are evicted.
+
+var (
+	queryCacheTTL = flag.Duration("query_cache_ttl",
+		30*time.Minute,
+		"Duration for which the results of a query are re-used (and kept on disk) after the query was started")
+
+	queryCacheMaxBytes = flag.Int64("query_cache_max_bytes",
+		0,
+		"Maximum size of all cached query results in -query_results_path, in bytes. 0 means no limit (apart from -headroom_percentage)")
+
+	queryCacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "query_cache_hits_total",
+			Help: "Number of queries answered from the query cache, by where the query state was found (memory or disk).",
+		},
+		[]string{"tier"})
+
+	queryCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "query_cache_misses_total",
+			Help: "Number of queries which were not cached and had to be sent to the source backends.",
+		})
+
+	queryCacheEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "query_cache_evictions_total",
+			Help: "Number of queries evicted from the query cache, by reason (ttl, size or space).",
+		},
+		[]string{"reason"})
+
+	queryCacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "query_cache_bytes",
+			Help: "Size of all cached query results on disk.",
+		})
+
+	queryCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "query_cache_entries",
+			Help: "Number of cached queries.",
+		})
+)
+
+func init() {
+	prometheus.MustRegister(queryCacheHits)
+	prometheus.MustRegister(queryCacheMisses)
+	prometheus.MustRegister(queryCacheEvictions)
+	prometheus.MustRegister(queryCacheBytes)
+	prometheus.MustRegister(queryCacheEntries)
+}
+
+const (
+	queryCacheIndexFile = "cache.json"
+	queryCacheStateFile = "state.json"
+)
+
+// cacheEntry describes a completed query in the cache index.
+type cacheEntry struct {
+	QueryId     string
+	Query       string
+	Started     time.Time
+	Ended       time.Time
+	LastUsed    time.Time
+	Bytes       int64
+	NumResults  int
+	ResultPages int
+	NumPackages int
+}
+
+// cachedPointer is the on-disk representation of a resultPointer.
+type cachedPointer struct {
+	Backend  int     `json:"b"`
+	Ranking  float32 `json:"r"`
+	Offset   int64   `json:"o"`
+	Length   int     `json:"l"`
+	PathHash uint64  `json:"h"`
+	Package  int     `json:"p"` // index into cachedQuery.PackageNames
+}
+
+// cachedQuery is the on-disk representation of a completed queryState.
+type cachedQuery struct {
+	Query          string
+	Started        time.Time
+	Ended          time.Time
+	FilesTotal     []int
+	FilesProcessed []int
+	Truncated      []bool
+	ResultPages    int
+	FirstPathRank  float32
+
+	// Events contains the data of all events which were not obsoleted, i.e.
+	// what a client joining the completed query receives.
+	Events []string
+
+	// PackageNames contains each full package name (e.g. i3-wm_4.8-1) which
+	// is referenced by Pointers once.
+	PackageNames []string
+
+	// Pointers starts with the NumResultPointers result pointers, in order,
+	// followed by pointers which are only referenced by PointersByPkg.
+	Pointers          []cachedPointer
+	NumResultPointers int
+
+	// PointersByPkg, AlsoIn and Duplicates contain indexes into Pointers.
+	PointersByPkg     map[string][]int
+	AlsoIn            map[int][]string
+	Duplicates        map[int][]int
+	AllPackagesSorted []string
+}
+
+type queryCacheT struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+var queryCache = &queryCacheT{
+	entries: make(map[string]*cacheEntry),
+}
+
+// loadQueryCache loads the cache index from dir and removes expired entries as
+// well as query results which are not referenced by the index, e.g. from
+// queries which were still running when dcs-web was stopped.
+func loadQueryCache(dir string) error {
+	c := &queryCacheT{
+		dir:     dir,
+		entries: make(map[string]*cacheEntry),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, queryCacheIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var entries []*cacheEntry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			log.Printf("Ignoring corrupt query cache index: %v", err)
+		}
+		for _, e := range entries {
+			c.entries[e.QueryId] = e
+		}
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	onDisk := make(map[string]bool, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		onDisk[fi.Name()] = true
+		if _, ok := c.entries[fi.Name()]; ok {
+			continue
+		}
+		log.Printf("Removing unreferenced query results %q", fi.Name())
+		if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	for queryid := range c.entries {
+		if !onDisk[queryid] {
+			delete(c.entries, queryid)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked()
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	log.Printf("Loaded %d cached queries from %q", len(c.entries), dir)
+	queryCache = c
+	return nil
+}
+
+func (c *queryCacheT) saveLocked() error {
+	entries := make([]*cacheEntry, 0, len(c.entries))
+	var size int64
+	for _, e := range c.entries {
+		entries = append(entries, e)
+		size += e.Bytes
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QueryId < entries[j].QueryId
+	})
+	queryCacheBytes.Set(float64(size))
+	queryCacheEntries.Set(float64(len(entries)))
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(filepath.Join(c.dir, queryCacheIndexFile), b, 0644)
+}
+
+func (c *queryCacheT) expired(e *cacheEntry) bool {
+	return time.Since(e.Started) > *queryCacheTTL
+}
+
+// removeLocked removes the cache entry for queryid, its query results and its
+// (completed) state.
+func (c *queryCacheT) removeLocked(queryid, reason string) {
+	log.Printf("[%s] evicting from query cache (%s)", queryid, reason)
+	queryCacheEvictions.WithLabelValues(reason).Inc()
+	delete(c.entries, queryid)
+
+	stateMu.Lock()
+	if s, ok := state[queryid]; ok {
+		if !s.done {
+			// A new query with the same queryid is running and uses the
+			// same directory, which must therefore be kept.
+			stateMu.Unlock()
+			return
+		}
+		for _, bstate := range s.perBackend {
+			bstate.tempFile.Close()
+		}
+		delete(state, queryid)
+	}
+	stateMu.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(c.dir, queryid)); err != nil {
+		log.Printf("[%s] could not remove query results: %v", queryid, err)
+	}
+}
+
+// lruLocked returns the least recently used cache entry, or nil if the cache
+// is empty.
+func (c *queryCacheT) lruLocked() *cacheEntry {
+	var lru *cacheEntry
+	for _, e := range c.entries {
+		if lru == nil || e.LastUsed.Before(lru.LastUsed) {
+			lru = e
+		}
+	}
+	return lru
+}
+
+// evictLocked removes expired entries, then the least recently used entries
+// until the cache fits into -query_cache_max_bytes.
+func (c *queryCacheT) evictLocked() {
+	var size int64
+	for queryid, e := range c.entries {
+		if c.expired(e) {
+			c.removeLocked(queryid, "ttl")
+			continue
+		}
+		size += e.Bytes
+	}
+	if *queryCacheMaxBytes <= 0 {
+		return
+	}
+	for size > *queryCacheMaxBytes {
+		lru := c.lruLocked()
+		if lru == nil {
+			break
+		}
+		size -= lru.Bytes
+		c.removeLocked(lru.QueryId, "size")
+	}
+}
+
+// evictOldest removes the least recently used entry from the cache to free
+// disk space. It returns false if the cache is empty.
+func (c *queryCacheT) evictOldest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lru := c.lruLocked()
+	if lru == nil {
+		return false
+	}
+	c.removeLocked(lru.QueryId, "space")
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Could not save query cache index: %v", err)
+	}
+	return true
+}
+
+// invalidate removes the (expired) cache entry for queryid, if any, before
+// the query is started again.
+func (c *queryCacheT) invalidate(queryid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[queryid]; !ok {
+		return
+	}
+	c.removeLocked(queryid, "ttl")
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Could not save query cache index: %v", err)
+	}
+}
+
+// contains returns whether queryid is in the cache and not expired.
+func (c *queryCacheT) contains(queryid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[queryid]
+	return ok && !c.expired(e)
+}
+
+// touch marks the cache entry for queryid (if any) as used.
+func (c *queryCacheT) touch(queryid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[queryid]; ok {
+		e.LastUsed = time.Now()
+	}
+}
+
+func dirSize(dir string) (int64, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, fi := range fis {
+		size += fi.Size()
+	}
+	return size, nil
+}
+
+// store adds the completed query queryid to the cache. Queries which were
+// cancelled, failed or are missing results of a source backend are not
+// cached.
+func (c *queryCacheT) store(queryid string) error {
+	stateMu.RLock()
+	s, ok := state[queryid]
+	if !ok || !s.done || s.cancelled || s.incomplete {
+		stateMu.RUnlock()
+		return nil
+	}
+	cq := cachedQuery{
+		Query:             s.query,
+		Started:           s.started,
+		Ended:             s.ended,
+		FilesTotal:        s.filesTotal,
+		FilesProcessed:    s.filesProcessed,
+		Truncated:         s.truncated,
+		ResultPages:       s.resultPages,
+		FirstPathRank:     s.FirstPathRank,
+		PointersByPkg:     make(map[string][]int, len(s.resultPointersByPkg)),
+		AllPackagesSorted: s.allPackagesSorted,
+	}
+	for _, e := range s.events {
+		if *e.obsolete {
+			continue
+		}
+		cq.Events = append(cq.Events, string(e.data))
+	}
+	// The per-package results and duplicates contain pointers which were
+	// collapsed into another result (see collapseDuplicates), so they are
+	// stored after the result pointers.
+	pointerIdx := make(map[pointerKey]int, len(s.resultPointers))
+	packageIdx := make(map[string]int)
+	addPointer := func(pointer resultPointer) int {
+		if idx, ok := pointerIdx[pointer.key()]; ok {
+			return idx
+		}
+		pkgidx, ok := packageIdx[*pointer.packageName]
+		if !ok {
+			pkgidx = len(cq.PackageNames)
+			packageIdx[*pointer.packageName] = pkgidx
+			cq.PackageNames = append(cq.PackageNames, *pointer.packageName)
+		}
+		idx := len(cq.Pointers)
+		cq.Pointers = append(cq.Pointers, cachedPointer{
+			Backend:  pointer.backendidx,
+			Ranking:  pointer.ranking,
+			Offset:   pointer.offset,
+			Length:   pointer.length,
+			PathHash: pointer.pathHash,
+			Package:  pkgidx,
+		})
+		pointerIdx[pointer.key()] = idx
+		return idx
+	}
+	cq.Pointers = make([]cachedPointer, 0, len(s.resultPointers))
+	for _, pointer := range s.resultPointers {
+		addPointer(pointer)
+	}
+	cq.NumResultPointers = len(cq.Pointers)
+	for pkg, pointers := range s.resultPointersByPkg {
+		indexes := make([]int, len(pointers))
+		for i, pointer := range pointers {
+			indexes[i] = addPointer(pointer)
+		}
+		cq.PointersByPkg[pkg] = indexes
+	}
+	if len(s.alsoIn) > 0 {
+		cq.AlsoIn = make(map[int][]string, len(s.alsoIn))
+		for key, packages := range s.alsoIn {
+			cq.AlsoIn[pointerIdx[key]] = packages
+		}
+	}
+	if len(s.duplicates) > 0 {
+		cq.Duplicates = make(map[int][]int, len(s.duplicates))
+		for key, pointers := range s.duplicates {
+			indexes := make([]int, len(pointers))
+			for i, pointer := range pointers {
+				indexes[i] = addPointer(pointer)
+			}
+			cq.Duplicates[pointerIdx[key]] = indexes
+		}
+	}
+	numResults := s.numResults()
+	stateMu.RUnlock()
+
+	dir := filepath.Join(c.dir, queryid)
+	b, err := json.Marshal(&cq)
+	if err != nil {
+		return err
+	}
+	if err := renameio.WriteFile(filepath.Join(dir, queryCacheStateFile), b, 0644); err != nil {
+		return err
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[queryid] = &cacheEntry{
+		QueryId:     queryid,
+		Query:       cq.Query,
+		Started:     cq.Started,
+		Ended:       cq.Ended,
+		LastUsed:    time.Now(),
+		Bytes:       size,
+		NumResults:  numResults,
+		ResultPages: cq.ResultPages,
+		NumPackages: len(cq.AllPackagesSorted),
+	}
+	c.evictLocked()
+	return c.saveLocked()
+}
+
+// restore loads the cached query queryid into the state map. It returns false
+// if queryid is not cached or cannot be restored.
+func (c *queryCacheT) restore(queryid string) bool {
+	if !c.contains(queryid) {
+		return false
+	}
+	querystate, err := c.load(queryid)
+	if err != nil {
+		log.Printf("[%s] could not restore cached query: %v", queryid, err)
+		c.mu.Lock()
+		c.removeLocked(queryid, "corrupt")
+		c.mu.Unlock()
+		return false
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	old, exists := state[queryid]
+	if _, expired := queryExistsLocked(queryid); exists && !expired {
+		// Another goroutine restored or started the query in the meantime.
+		for _, bstate := range querystate.perBackend {
+			bstate.tempFile.Close()
+		}
+		return true
+	}
+	if exists {
+		cancelQueryLocked(queryid)
+		go releaseTempFiles(old)
+	} else {
+		gcStateLocked()
+	}
+	setStateLocked(queryid, querystate)
+	log.Printf("[%s] restored from query cache", queryid)
+	return true
+}
+
+func (c *queryCacheT) load(queryid string) (queryState, error) {
+	dir := filepath.Join(c.dir, queryid)
+	b, err := ioutil.ReadFile(filepath.Join(dir, queryCacheStateFile))
+	if err != nil {
+		return queryState{}, err
+	}
+	var cq cachedQuery
+	if err := json.Unmarshal(b, &cq); err != nil {
+		return queryState{}, err
+	}
+
+	querystate := queryState{
+		started:             cq.Started,
+		ended:               cq.Ended,
+		newEvent:            sync.NewCond(&stateMu),
+		done:                true,
+		query:               cq.Query,
+		cancel:              func() {},
+		filesTotal:          cq.FilesTotal,
+		filesProcessed:      cq.FilesProcessed,
+		truncated:           cq.Truncated,
+		filesMu:             &sync.Mutex{},
+		resultPages:         cq.ResultPages,
+		tempFilesMu:         &sync.Mutex{},
+		perBackend:          make([]*perBackendState, len(cq.FilesTotal)),
+		alsoIn:              make(map[pointerKey][]string, len(cq.AlsoIn)),
+		duplicates:          make(map[pointerKey][]resultPointer, len(cq.Duplicates)),
+		sorted:              newSortedResults(),
+		resultPointersByPkg: make(map[string][]resultPointer, len(cq.PointersByPkg)),
+		allPackagesSorted:   cq.AllPackagesSorted,
+		FirstPathRank:       cq.FirstPathRank,
+	}
+	for _, data := range cq.Events {
+		querystate.events = append(querystate.events, event{
+			data:     []byte(data),
+			obsolete: new(bool),
+		})
+	}
+	for i := range querystate.perBackend {
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf("unsorted_%d.pb", i)))
+		if err != nil {
+			for _, bstate := range querystate.perBackend[:i] {
+				bstate.tempFile.Close()
+			}
+			return queryState{}, err
+		}
+		querystate.perBackend[i] = &perBackendState{
+			tempFile:    f,
+			packagePool: stringpool.NewStringPool(),
+			allPackages: make(map[string]bool),
+		}
+	}
+	if cq.NumResultPointers < 0 || cq.NumResultPointers > len(cq.Pointers) {
+		for _, bstate := range querystate.perBackend {
+			bstate.tempFile.Close()
+		}
+		return queryState{}, fmt.Errorf("invalid number of result pointers: %d", cq.NumResultPointers)
+	}
+	pointers := make([]resultPointer, len(cq.Pointers))
+	for idx, cp := range cq.Pointers {
+		if cp.Backend < 0 || cp.Backend >= len(querystate.perBackend) ||
+			cp.Package < 0 || cp.Package >= len(cq.PackageNames) {
+			for _, bstate := range querystate.perBackend {
+				bstate.tempFile.Close()
+			}
+			return queryState{}, fmt.Errorf("invalid result pointer %+v", cp)
+		}
+		bstate := querystate.perBackend[cp.Backend]
+		pkg := cq.PackageNames[cp.Package]
+		pointer := resultPointer{
+			backendidx:  cp.Backend,
+			ranking:     cp.Ranking,
+			offset:      cp.Offset,
+			length:      cp.Length,
+			pathHash:    cp.PathHash,
+			packageName: bstate.packagePool.Get(pkg),
+		}
+		pointers[idx] = pointer
+		bstate.resultPointers = append(bstate.resultPointers, pointer)
+		bstate.allPackages[pkg] = true
+	}
+	querystate.resultPointers = pointers[:cq.NumResultPointers]
+	if err := resolvePointers(&querystate, &cq, pointers); err != nil {
+		for _, bstate := range querystate.perBackend {
+			bstate.tempFile.Close()
+		}
+		return queryState{}, err
+	}
+	return querystate, nil
+}
+
+// resolvePointers sets the per-package results, alsoIn and duplicates of
+// querystate from the indexes into pointers which cq contains.
+func resolvePointers(querystate *queryState, cq *cachedQuery, pointers []resultPointer) error {
+	lookup := func(idx int) (resultPointer, error) {
+		if idx < 0 || idx >= len(pointers) {
+			return resultPointer{}, fmt.Errorf("invalid result pointer index %d", idx)
+		}
+		return pointers[idx], nil
+	}
+	lookupAll := func(indexes []int) ([]resultPointer, error) {
+		result := make([]resultPointer, len(indexes))
+		for i, idx := range indexes {
+			pointer, err := lookup(idx)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = pointer
+		}
+		return result, nil
+	}
+	for pkg, indexes := range cq.PointersByPkg {
+		bypkg, err := lookupAll(indexes)
+		if err != nil {
+			return err
+		}
+		querystate.resultPointersByPkg[pkg] = bypkg
+	}
+	for idx, packages := range cq.AlsoIn {
+		pointer, err := lookup(idx)
+		if err != nil {
+			return err
+		}
+		querystate.alsoIn[pointer.key()] = packages
+	}
+	for idx, indexes := range cq.Duplicates {
+		pointer, err := lookup(idx)
+		if err != nil {
+			return err
+		}
+		duplicates, err := lookupAll(indexes)
+		if err != nil {
+			return err
+		}
+		querystate.duplicates[pointer.key()] = duplicates
+	}
+	return nil
+}
+
+// queryAvailable returns whether state for queryid exists, restoring it from
+// the query cache if necessary.
+func queryAvailable(queryid string) bool {
+	stateMu.RLock()
+	_, ok := state[queryid]
+	stateMu.RUnlock()
+	if ok {
+		return true
+	}
+	return queryCache.restore(queryid)
+}
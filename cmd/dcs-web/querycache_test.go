@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+)
+
+func newTestQueryCache(t *testing.T) (*queryCacheT, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dcs-querycache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &queryCacheT{
+		dir:     dir,
+		entries: make(map[string]*cacheEntry),
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+// describePointers returns a string per pointer which contains all fields
+// stored in the query cache.
+func describePointers(pointers []resultPointer) []string {
+	result := make([]string, len(pointers))
+	for idx, p := range pointers {
+		result[idx] = fmt.Sprintf("%d@%d+%d %s %v %x", p.backendidx, p.offset, p.length, *p.packageName, p.ranking, p.pathHash)
+	}
+	return result
+}
+
+func TestQueryCacheRoundTrip(t *testing.T) {
+	c, cleanupCache := newTestQueryCache(t)
+	defer cleanupCache()
+
+	const queryid = "roundtrip"
+	digest := sha256.Sum256([]byte("identical file"))
+	cleanup := storeTestQuery(t, queryid, []*sourcebackendpb.Match{
+		{Path: "i3-wm_4.16/i3.c", Line: 1, Package: "i3-wm_4.16", Ranking: 0.9, FileDigest: digest[:]},
+		// Collapsed into the previous result.
+		{Path: "i3_4.16/i3.c", Line: 1, Package: "i3_4.16", Ranking: 0.8, FileDigest: digest[:]},
+		{Path: "zsh_5.7/zsh.c", Line: 3, Package: "zsh_5.7", Ranking: 0.7},
+	})
+	defer cleanup()
+
+	// store expects the temporary files of the query in the cache directory
+	// and the remaining state of a query finished by writeToDisk.
+	stateMu.Lock()
+	s := state[queryid]
+	b, err := ioutil.ReadFile(s.perBackend[0].tempFile.Name())
+	if err != nil {
+		stateMu.Unlock()
+		t.Fatal(err)
+	}
+	s.started = time.Now()
+	s.ended = s.started.Add(time.Second)
+	s.query = "q=i3&literal=1"
+	s.filesTotal = []int{3}
+	s.filesProcessed = []int{3}
+	s.truncated = []bool{false}
+	s.resultPages = 1
+	s.events = []event{
+		{data: []byte(`{"Type":"progress","FilesProcessed":1}`), obsolete: new(bool)},
+		{data: []byte(`{"Type":"progress","FilesProcessed":3}`), obsolete: new(bool)},
+	}
+	*s.events[0].obsolete = true
+	s.resultPointersByPkg = make(map[string][]resultPointer)
+	for _, pointer := range s.perBackend[0].resultPointers {
+		pkg := sourcePackageName(*pointer.packageName)
+		s.resultPointersByPkg[pkg] = append(s.resultPointersByPkg[pkg], pointer)
+	}
+	s.allPackagesSorted = []string{"i3", "i3-wm", "zsh"}
+	state[queryid] = s
+	stateMu.Unlock()
+	dir := filepath.Join(c.dir, queryid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "unsorted_0.pb"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.duplicates) == 0 || len(s.alsoIn) == 0 {
+		t.Fatalf("test query contains no duplicates")
+	}
+
+	if err := c.store(queryid); err != nil {
+		t.Fatal(err)
+	}
+	// Remove the query from the state map, e.g. because of a restart.
+	cleanup()
+	if !c.restore(queryid) {
+		t.Fatalf("restore(%s) = false, want true", queryid)
+	}
+	stateMu.Lock()
+	restored := state[queryid]
+	stateMu.Unlock()
+	defer func() {
+		stateMu.Lock()
+		delete(state, queryid)
+		stateMu.Unlock()
+		releaseTempFiles(restored)
+	}()
+
+	if !restored.done {
+		t.Errorf("restored query is not done")
+	}
+	if restored.query != s.query || !restored.started.Equal(s.started) || !restored.ended.Equal(s.ended) {
+		t.Errorf("restored query %q (%v to %v), want %q (%v to %v)", restored.query, restored.started, restored.ended, s.query, s.started, s.ended)
+	}
+	if !reflect.DeepEqual(restored.filesTotal, s.filesTotal) ||
+		!reflect.DeepEqual(restored.filesProcessed, s.filesProcessed) ||
+		!reflect.DeepEqual(restored.truncated, s.truncated) ||
+		restored.resultPages != s.resultPages {
+		t.Errorf("restored stats differ: got %v/%v (truncated %v, %d pages), want %v/%v (truncated %v, %d pages)",
+			restored.filesProcessed, restored.filesTotal, restored.truncated, restored.resultPages,
+			s.filesProcessed, s.filesTotal, s.truncated, s.resultPages)
+	}
+	var events []string
+	for _, e := range restored.events {
+		events = append(events, string(e.data))
+	}
+	if want := []string{`{"Type":"progress","FilesProcessed":3}`}; !reflect.DeepEqual(events, want) {
+		t.Errorf("restored events = %q, want %q (without obsoleted events)", events, want)
+	}
+	if got, want := describePointers(restored.resultPointers), describePointers(s.resultPointers); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored result pointers = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(restored.allPackagesSorted, s.allPackagesSorted) {
+		t.Errorf("restored packages = %q, want %q", restored.allPackagesSorted, s.allPackagesSorted)
+	}
+	if got, want := len(restored.resultPointersByPkg), len(s.resultPointersByPkg); got != want {
+		t.Errorf("restored %d packages, want %d", got, want)
+	}
+	for pkg, pointers := range s.resultPointersByPkg {
+		if got, want := describePointers(restored.resultPointersByPkg[pkg]), describePointers(pointers); !reflect.DeepEqual(got, want) {
+			t.Errorf("restored pointers of package %s = %q, want %q", pkg, got, want)
+		}
+	}
+	if !reflect.DeepEqual(restored.alsoIn, s.alsoIn) {
+		t.Errorf("restored alsoIn = %v, want %v", restored.alsoIn, s.alsoIn)
+	}
+	if got, want := len(restored.duplicates), len(s.duplicates); got != want {
+		t.Errorf("restored %d duplicates, want %d", got, want)
+	}
+	for key, pointers := range s.duplicates {
+		if got, want := describePointers(restored.duplicates[key]), describePointers(pointers); !reflect.DeepEqual(got, want) {
+			t.Errorf("restored duplicates of %v = %q, want %q", key, got, want)
+		}
+	}
+
+	// The restored pointers refer to the matches in the temporary files.
+	var paths []string
+	if err := readAllFromPointers(queryid, restored.resultPointers, func(match *sourcebackendpb.Match) error {
+		paths = append(paths, match.Path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"i3-wm_4.16/i3.c", "zsh_5.7/zsh.c"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("restored results = %q, want %q", paths, want)
+	}
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	defer func(old time.Duration) { *queryCacheTTL = old }(*queryCacheTTL)
+	defer func(old int64) { *queryCacheMaxBytes = old }(*queryCacheMaxBytes)
+	*queryCacheTTL = 30 * time.Minute
+
+	now := time.Now()
+	entry := func(queryid string, started, lastUsed time.Duration) *cacheEntry {
+		return &cacheEntry{
+			QueryId:  queryid,
+			Started:  now.Add(-started),
+			LastUsed: now.Add(-lastUsed),
+			Bytes:    100,
+		}
+	}
+	for _, tt := range []struct {
+		name     string
+		maxBytes int64
+		entries  []*cacheEntry
+		touch    string
+		want     []string
+	}{
+		{
+			name: "ttl",
+			entries: []*cacheEntry{
+				entry("expired", 31*time.Minute, 0),
+				entry("fresh", 29*time.Minute, 29*time.Minute),
+			},
+			want: []string{"fresh"},
+		},
+		{
+			name:     "lru",
+			maxBytes: 250,
+			entries: []*cacheEntry{
+				entry("a", 3*time.Minute, 3*time.Minute),
+				entry("b", 3*time.Minute, 2*time.Minute),
+				entry("c", 3*time.Minute, time.Minute),
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:     "touched",
+			maxBytes: 250,
+			entries: []*cacheEntry{
+				entry("a", 3*time.Minute, 3*time.Minute),
+				entry("b", 3*time.Minute, 2*time.Minute),
+				entry("c", 3*time.Minute, time.Minute),
+			},
+			touch: "a",
+			want:  []string{"a", "c"},
+		},
+		{
+			// Expired entries are removed before the least recently used
+			// ones, regardless of when they were last used.
+			name:     "ttl before lru",
+			maxBytes: 150,
+			entries: []*cacheEntry{
+				entry("expired", 31*time.Minute, 0),
+				entry("a", 3*time.Minute, 2*time.Minute),
+				entry("b", 3*time.Minute, time.Minute),
+			},
+			want: []string{"b"},
+		},
+		{
+			name:     "unlimited",
+			maxBytes: 0,
+			entries: []*cacheEntry{
+				entry("a", 3*time.Minute, 2*time.Minute),
+				entry("b", 3*time.Minute, time.Minute),
+			},
+			want: []string{"a", "b"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			*queryCacheMaxBytes = tt.maxBytes
+			c, cleanup := newTestQueryCache(t)
+			defer cleanup()
+			for _, e := range tt.entries {
+				if err := os.MkdirAll(filepath.Join(c.dir, e.QueryId), 0755); err != nil {
+					t.Fatal(err)
+				}
+				c.entries[e.QueryId] = e
+			}
+			if tt.touch != "" {
+				c.touch(tt.touch)
+			}
+			c.mu.Lock()
+			c.evictLocked()
+			c.mu.Unlock()
+
+			var got []string
+			for queryid := range c.entries {
+				got = append(got, queryid)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remaining entries = %q, want %q", got, tt.want)
+			}
+			for _, e := range tt.entries {
+				_, err := os.Stat(filepath.Join(c.dir, e.QueryId))
+				if _, ok := c.entries[e.QueryId]; ok && err != nil {
+					t.Errorf("results of %s: %v", e.QueryId, err)
+				} else if !ok && !os.IsNotExist(err) {
+					t.Errorf("results of evicted %s still exist (err = %v)", e.QueryId, err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryCacheRejectsCorruptState(t *testing.T) {
+	marshal := func(cq cachedQuery) string {
+		b, err := json.Marshal(&cq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for _, tt := range []struct {
+		name  string
+		state string
+	}{
+		{"truncated", `{"Query":"q=i3`},
+		{"type", `{"FilesTotal":"one"}`},
+		{"num result pointers", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			NumResultPointers: 1,
+		})},
+		{"negative num result pointers", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			NumResultPointers: -1,
+		})},
+		{"backend", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{Backend: 1}},
+			NumResultPointers: 1,
+		})},
+		{"negative backend", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{Backend: -1}},
+			NumResultPointers: 1,
+		})},
+		{"package", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{Package: 1}},
+			NumResultPointers: 1,
+		})},
+		{"per-package pointer", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{}},
+			NumResultPointers: 1,
+			PointersByPkg:     map[string][]int{"i3-wm": {0, 1}},
+		})},
+		{"also in", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{}},
+			NumResultPointers: 1,
+			AlsoIn:            map[int][]string{1: {"i3_4.16"}},
+		})},
+		{"duplicate", marshal(cachedQuery{
+			FilesTotal:        []int{1},
+			PackageNames:      []string{"i3-wm_4.16"},
+			Pointers:          []cachedPointer{{}},
+			NumResultPointers: 1,
+			Duplicates:        map[int][]int{0: {-1}},
+		})},
+		{"temporary file", marshal(cachedQuery{
+			// There is only unsorted_0.pb.
+			FilesTotal: []int{1, 1},
+		})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cleanup := newTestQueryCache(t)
+			defer cleanup()
+			queryid := "corrupt"
+			dir := filepath.Join(c.dir, queryid)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "unsorted_0.pb"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, queryCacheStateFile), []byte(tt.state), 0644); err != nil {
+				t.Fatal(err)
+			}
+			c.entries[queryid] = &cacheEntry{
+				QueryId:  queryid,
+				Started:  time.Now(),
+				LastUsed: time.Now(),
+			}
+
+			if c.restore(queryid) {
+				stateMu.Lock()
+				delete(state, queryid)
+				stateMu.Unlock()
+				t.Fatalf("restore(%s) = true, want false", tt.name)
+			}
+			stateMu.RLock()
+			_, ok := state[queryid]
+			stateMu.RUnlock()
+			if ok {
+				t.Errorf("corrupt query was added to the state map")
+			}
+			if _, ok := c.entries[queryid]; ok {
+				t.Errorf("corrupt query was not removed from the query cache")
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("results of the corrupt query still exist (err = %v)", err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"hash/fnv"
@@ -27,6 +28,7 @@ import (
 	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
 	"github.com/Debian/dcs/stringpool"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
@@ -55,6 +57,14 @@ var (
 			},
 		})
 
+	maxResultsPerBackend = flag.Int("max_results_per_backend",
+		0,
+		"Maximum number of results each source backend sends for a query before it stops searching. 0 means no limit.")
+
+	backendTimeout = flag.Duration("backend_timeout",
+		0,
+		"Duration after which source backends stop searching and return the results found so far. 0 means no timeout.")
+
 	headroomPercentage = flag.Float64("headroom_percentage",
 		0.2,
 		"How much space should be kept free on the file system containing -query_results_path in order to be able to write query state. Default: 0.2, i.e. 20% of the total space should be kept free. Set to 0 to disable")
@@ -79,12 +89,27 @@ type Error struct {
 	ErrorType string
 }
 
+// FileSummary is sent for each matching file in the files and count result
+// modes (see search.ResultMode).
+type FileSummary struct {
+	// This is set to “filesummary” to distinguish the message type on the
+	// client.
+	Type string
+
+	Path    string
+	Matches uint32
+}
+
 type ProgressUpdate struct {
 	Type           string
 	QueryId        string
 	FilesProcessed int
 	FilesTotal     int
 	Results        int
+
+	// Whether at least one source backend stopped searching early, see
+	// -max_results_per_backend and -backend_timeout.
+	Truncated bool
 }
 
 func (p *ProgressUpdate) EventType() string {
@@ -108,6 +133,36 @@ type resultPointer struct {
 
 	// Used for per-package results. Points into a stringpool.StringPool
 	packageName *string
+
+	// Identifies identical matches (same line of a file with the same
+	// sourcebackendpb.Match.FileDigest), which are collapsed in the result
+	// list. 0 if the source backend did not send a digest.
+	dupKey uint64
+}
+
+// pointerKey identifies a resultPointer.
+type pointerKey struct {
+	backendidx int
+	offset     int64
+}
+
+func (p resultPointer) key() pointerKey {
+	return pointerKey{p.backendidx, p.offset}
+}
+
+// dupKey returns the resultPointer.dupKey of match.
+func dupKey(match *sourcebackendpb.Match) uint64 {
+	if len(match.FileDigest) == 0 {
+		return 0
+	}
+	h := fnv.New64()
+	h.Write(match.FileDigest)
+	var start int32
+	if match.MatchRange != nil {
+		start = match.MatchRange.Start
+	}
+	fmt.Fprintf(h, ":%d:%d", match.Line, start)
+	return h.Sum64()
 }
 
 type pointerByRanking []resultPointer
@@ -147,10 +202,35 @@ type queryState struct {
 	done     bool
 	query    string
 
+	// cancel cancels the source backend queries. cancelled is set once the
+	// query was cancelled before it completed, see cancelQuery.
+	cancel    context.CancelFunc
+	cancelled bool
+
+	// incomplete is set when the query failed or a source backend did not
+	// return all of its results. Incomplete queries are not cached, see
+	// queryCacheT.store.
+	incomplete bool
+
+	// listeners is the number of clients currently waiting for events, see
+	// listenLocked.
+	listeners int
+
+	// generation identifies this instance of the query: cancelled or expired
+	// queries are started again under the same queryid, and listeners must
+	// only ever see the instance they joined. See setStateLocked.
+	generation uint64
+
+	// backends is done once all queryBackend goroutines returned, i.e. once
+	// the temporary files are not written to anymore. nil for restored
+	// queries.
+	backends *sync.WaitGroup
+
 	results [10]resultPointer
 
 	filesTotal     []int
 	filesProcessed []int
+	truncated      []bool
 	filesMu        *sync.Mutex
 
 	resultPages int
@@ -162,6 +242,18 @@ type queryState struct {
 	resultPointers      []resultPointer
 	resultPointersByPkg map[string][]resultPointer
 
+	// alsoIn contains the packages of the identical matches which were
+	// collapsed into a result, see sourcebackendpb.Match.AlsoIn.
+	alsoIn map[pointerKey][]string
+
+	// duplicates contains the identical matches which were collapsed into a
+	// result, in ranking order.
+	duplicates map[pointerKey][]resultPointer
+
+	// sorted contains resultPointers in the orders other than ranking which
+	// were requested so far, see sortedPointers.
+	sorted *sortedResults
+
 	allPackagesSorted []string
 
 	FirstPathRank float32
@@ -178,13 +270,26 @@ func (qs *queryState) numResults() int {
 var (
 	state   = make(map[string]queryState)
 	stateMu sync.RWMutex
+
+	// lastGeneration is the generation of the most recently stored queryState,
+	// guarded by stateMu.
+	lastGeneration uint64
+
+	// startMu serializes starting queries, so that the temporary files of a
+	// query are only ever created by one goroutine, see maybeStartQuery.
+	startMu sync.Mutex
 )
 
-func queryBackend(ctx context.Context, queryid, src string, backend sourcebackendpb.SourceBackendClient, backendidx int, searchRequest *sourcebackendpb.SearchRequest) {
+func queryBackend(ctx context.Context, queryid, src string, backend sourcebackendpb.SourceBackendClient, backendidx int, bstate *perBackendState, searchRequest *sourcebackendpb.SearchRequest) {
 	// When exiting this function, check that all results were processed. If
 	// not, the backend query must have failed for some reason. Send a progress
 	// update to prevent the query from running forever.
 	defer func() {
+		// A cancelled query is already finished, and its state might have been
+		// replaced by a new query with the same queryid.
+		if ctx.Err() != nil {
+			return
+		}
 		stateMu.RLock()
 		filesTotal := state[queryid].filesTotal[backendidx]
 
@@ -198,6 +303,8 @@ func queryBackend(ctx context.Context, queryid, src string, backend sourcebacken
 			filesTotal = 0
 		}
 
+		markIncomplete(queryid)
+
 		storeProgress(queryid, backendidx, &sourcebackendpb.ProgressUpdate{
 			FilesProcessed: uint64(filesTotal),
 			FilesTotal:     uint64(filesTotal),
@@ -209,126 +316,253 @@ func queryBackend(ctx context.Context, queryid, src string, backend sourcebacken
 		})
 	}()
 
-	ctx, cancelfunc := context.WithCancel(ctx)
-	stream, err := backend.Search(ctx, searchRequest)
-	if err != nil {
-		log.Printf("[%s] [src:%s] Search RPC failed: %v\n", queryid, src, err)
-		return
-	}
-
-	stateMu.RLock()
-	bstate := state[queryid].perBackend[backendidx]
-	stateMu.RUnlock()
 	tempFileWriter := bstate.tempFileWriter
 	buf := proto.NewBuffer(nil)
-	orderlyFinished := false
-	done := false
-
-	for !done {
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			log.Printf("[%s] [src:%s] EOF\n", queryid, src)
-			return
-		}
-		if err != nil {
-			log.Printf("[%s] [src:%s] Error decoding result stream: %v\n", queryid, src, err)
-			return
+	err := streamBackend(ctx, backend, searchRequest, func(msg *sourcebackendpb.SearchReply) error {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
 		buf.Reset()
 		if err := buf.Marshal(msg); err != nil {
-			log.Printf("[%s] [src:%s] Error encoding proto: %v\n", queryid, src, err)
-			return
+			return fmt.Errorf("encoding proto: %v", err)
 		}
 		if _, err := tempFileWriter.Write(buf.Bytes()); err != nil {
-			log.Printf("[%s] [src:%s] Error writing proto: %v\n", queryid, src, err)
-			return
+			return fmt.Errorf("writing proto: %v", err)
 		}
 
 		switch msg.Type {
 		case sourcebackendpb.SearchReply_MATCH:
 			storeResult(queryid, backendidx, msg.Match, len(buf.Bytes()))
+		case sourcebackendpb.SearchReply_FILE_SUMMARY:
+			addEventMarshal(queryid, &FileSummary{
+				Type:    "filesummary",
+				Path:    msg.FileSummary.Path,
+				Matches: msg.FileSummary.Matches,
+			})
 		case sourcebackendpb.SearchReply_PROGRESS_UPDATE:
 			storeProgress(queryid, backendidx, msg.ProgressUpdate)
-			orderlyFinished = msg.ProgressUpdate.FilesProcessed == msg.ProgressUpdate.FilesTotal
 		}
 
 		bstate.tempFileOffset += int64(len(buf.Bytes()))
-		stateMu.RLock()
-		done = state[queryid].done
-		stateMu.RUnlock()
+		return nil
+	})
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("[%s] [src:%s] query cancelled\n", queryid, src)
+	case err != nil:
+		log.Printf("[%s] [src:%s] Search RPC failed: %v\n", queryid, src, err)
+	default:
+		log.Printf("[%s] [src:%s] query done, disconnecting\n", queryid, src)
 	}
+}
 
-	// Drain the stream: the above loop might finish early (when the query is cancelled)
-	if orderlyFinished {
-		// We got everything we need, but we need to try receiving one more
-		// message to make gRPC realize the streaming RPC is finished (by
-		// reading an EOF).
-		stream.Recv()
-	} else {
-		// The query was cancelled before it could complete, so cancel the
-		// stream as well.
-		cancelfunc()
+// streamBackend sends searchRequest to backend and calls fn for each reply,
+// until the backend sent all of its replies (in which case streamBackend
+// returns nil), the search fails or fn returns an error. The search is
+// cancelled unless all replies were received.
+func streamBackend(ctx context.Context, backend sourcebackendpb.SourceBackendClient, searchRequest *sourcebackendpb.SearchRequest, fn func(*sourcebackendpb.SearchReply) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := backend.Search(ctx, searchRequest)
+	if err != nil {
+		return err
+	}
+	for {
+		reply, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(reply); err != nil {
+			return err
+		}
 	}
-	log.Printf("[%s] [src:%s] query done, disconnecting\n", queryid, src)
 }
 
 // queryExistsLocked returns whether state for the query exists and whether
-// that state is expired.
+// that state is expired (see -query_cache_ttl). Cancelled queries expire
+// immediately, so that they are restarted when requested again.
 func queryExistsLocked(queryid string) (bool, bool) {
 	querystate, exists := state[queryid]
-	return exists, time.Since(querystate.started) > 30*time.Minute
+	return exists, querystate.cancelled || time.Since(querystate.started) > *queryCacheTTL
 }
 
-// queryExists returns true if a query with the specified queryid exists and is
-// not expired yet.
-func queryExists(queryid string) bool {
-	stateMu.RLock()
-	defer stateMu.RUnlock()
-	exists, expired := queryExistsLocked(queryid)
-	return exists && !expired
+// joinLocked returns whether queryid exists and is not expired. If so, and
+// unless listenCtx is nil, a listener is registered until listenCtx is done.
+func joinLocked(listenCtx context.Context, queryid string) (*listener, bool) {
+	if exists, expired := queryExistsLocked(queryid); !exists || expired {
+		return nil, false
+	}
+	if listenCtx == nil {
+		return nil, true
+	}
+	return listenLocked(listenCtx, queryid), true
+}
+
+// joinQuery is like joinLocked, but acquires stateMu.
+func joinQuery(listenCtx context.Context, queryid string) (*listener, bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return joinLocked(listenCtx, queryid)
+}
+
+// setStateLocked stores querystate as a new instance of queryid, waking up the
+// listeners of the instance it replaces (if any), see getEvent.
+func setStateLocked(queryid string, querystate queryState) {
+	if old, ok := state[queryid]; ok {
+		old.newEvent.Broadcast()
+	}
+	lastGeneration++
+	querystate.generation = lastGeneration
+	state[queryid] = querystate
 }
 
-func startQuery(queryid string, querystate queryState) error {
+// releaseTempFiles closes the temporary files of querystate once its
+// queryBackend goroutines returned.
+func releaseTempFiles(querystate queryState) {
+	if querystate.backends != nil {
+		querystate.backends.Wait()
+	}
+	querystate.tempFilesMu.Lock()
+	defer querystate.tempFilesMu.Unlock()
+	for _, bstate := range querystate.perBackend {
+		if bstate != nil { // creating the temporary files failed
+			bstate.tempFile.Close()
+		}
+	}
+}
+
+// startQuery stores querystate as the running instance of queryid and, unless
+// listenCtx is nil, registers a listener until listenCtx is done.
+func startQuery(listenCtx context.Context, queryid string, querystate queryState) (*listener, error) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
 	exists, expired := queryExistsLocked(queryid)
 	if exists && !expired {
-		return fmt.Errorf("query already exists")
+		return nil, fmt.Errorf("query already exists")
 	}
 	// See if we need to garbage collect old queries. This is unnecessary when
 	// the query is expired, as we can just re-use the previous slot.
-	if !exists && len(state) >= 10 {
-		log.Printf("Trying to garbage collect queries (currently %d)\n", len(state))
-		for queryid, s := range state {
-			if len(state) < 10 {
-				break
-			}
-			if !s.done {
-				continue
-			}
-			for _, state := range s.perBackend {
-				state.tempFile.Close()
-			}
-			delete(state, queryid)
-		}
-		log.Printf("Garbage collection done. %d queries remaining", len(state))
+	if !exists {
+		gcStateLocked()
 	}
-	state[queryid] = querystate
+	setStateLocked(queryid, querystate)
 	activeQueries.Add(1)
-	return nil
+	if listenCtx == nil {
+		return nil, nil
+	}
+	return listenLocked(listenCtx, queryid), nil
 }
 
-// XXX: Starting a new query while there may still be clients reading that
-// query is not a great idea. Best fix may be to make getEvent() use a
-// querystate instead of the string identifier.
+// gcStateLocked removes completed queries from the state map until there are
+// fewer than 10 queries. Cached queries are restored from disk when they are
+// requested again, see queryCacheT.restore.
+func gcStateLocked() {
+	if len(state) < 10 {
+		return
+	}
+	log.Printf("Trying to garbage collect queries (currently %d)\n", len(state))
+	for queryid, s := range state {
+		if len(state) < 10 {
+			break
+		}
+		if !s.done {
+			continue
+		}
+		for _, state := range s.perBackend {
+			state.tempFile.Close()
+		}
+		delete(state, queryid)
+	}
+	log.Printf("Garbage collection done. %d queries remaining", len(state))
+}
+
+// queryIdentifier returns the identifier under which the results of query
+// (which must have passed validateQuery()) are stored. Equivalent queries
+// share an identifier, see search.CanonicalQuery.
+func queryIdentifier(query string) string {
+	canonical := query
+	if fakeUrl, err := url.Parse("?" + query); err == nil {
+		canonical = search.CanonicalQuery(*fakeUrl)
+	}
+	h := fnv.New64()
+	io.WriteString(h, canonical)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// newSearchRequest rewrites query (which must have passed validateQuery())
+// into a request for source backends.
+func newSearchRequest(query string) *sourcebackendpb.SearchRequest {
+	fakeUrl, err := url.Parse("?" + query)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rewritten := search.RewriteQuery(*fakeUrl)
+	opts := search.RegexpOptions(rewritten.Query())
+	// validateQuery() already rejected invalid context= and mode= values.
+	contextLines, err := search.ContextLines(rewritten.Query())
+	if err != nil {
+		contextLines = search.DefaultContextLines
+	}
+	resultMode, _ := search.ResultMode(rewritten.Query())
+	return &sourcebackendpb.SearchRequest{
+		Query:            rewritten.Query().Get("q"),
+		RewrittenUrl:     rewritten.String(),
+		MaxResults:       uint32(*maxResultsPerBackend),
+		TimeoutMs:        uint32(*backendTimeout / time.Millisecond),
+		CaseInsensitive:  opts.FoldCase,
+		WholeWord:        opts.WholeWord,
+		ContextLines:     &wrappers.UInt32Value{Value: uint32(contextLines)},
+		ResultMode:       resultMode,
+		RequiredPatterns: rewritten.Query()["and"],
+		ExcludedPatterns: rewritten.Query()["not"],
+		FileDigests:      search.Dedup(rewritten.Query()),
+	}
+}
 
 // maybeStartQuery starts a specified query if that query does not already
-// exist. Returns whether the query existed and any errors during query
-// creation.
-func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, error) {
-	if queryExists(queryid) {
-		return true, nil
+// exist. Unless listenCtx is nil, the caller is registered as a listener of
+// the query until listenCtx is done, atomically with looking up or starting
+// the query. Returns whether the query existed, the listener to pass to
+// getEvent and any errors during query creation.
+func maybeStartQuery(ctx, listenCtx context.Context, queryid, src, query string) (bool, *listener, error) {
+	if l, ok := joinQuery(listenCtx, queryid); ok {
+		queryCacheHits.WithLabelValues("memory").Inc()
+		queryCache.touch(queryid)
+		return true, l, nil
+	}
+	if queryCache.restore(queryid) {
+		// The restored query might have been garbage collected already, in
+		// which case it is started again below.
+		if l, ok := joinQuery(listenCtx, queryid); ok {
+			queryCacheHits.WithLabelValues("disk").Inc()
+			queryCache.touch(queryid)
+			return true, l, nil
+		}
+	}
+	queryCacheMisses.Inc()
+	queryCache.invalidate(queryid)
+
+	startMu.Lock()
+	defer startMu.Unlock()
+	stateMu.Lock()
+	// Another goroutine might have started the query since we looked.
+	if l, ok := joinLocked(listenCtx, queryid); ok {
+		stateMu.Unlock()
+		return true, l, nil
+	}
+	old, replace := state[queryid]
+	if replace {
+		cancelQueryLocked(queryid)
+	}
+	stateMu.Unlock()
+	if replace {
+		// The previous (cancelled or expired) instance must be done writing to
+		// its temporary files before they are re-created below.
+		releaseTempFiles(old)
 	}
 
 	// carry over the tracing span id to a background context: queries are
@@ -337,17 +571,20 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 	// TODO(golang.org/issues/19643): replace the code below once a “detach” API
 	// is available
 	span := opentracing.SpanFromContext(ctx)
-	ctx = opentracing.ContextWithSpan(context.Background(), span)
+	ctx, cancel := context.WithCancel(opentracing.ContextWithSpan(context.Background(), span))
 
 	querystate := queryState{
 		started:        time.Now(),
 		query:          query,
+		cancel:         cancel,
 		newEvent:       sync.NewCond(&stateMu),
 		filesTotal:     make([]int, len(common.SourceBackendStubs)),
 		filesProcessed: make([]int, len(common.SourceBackendStubs)),
+		truncated:      make([]bool, len(common.SourceBackendStubs)),
 		filesMu:        &sync.Mutex{},
 		perBackend:     make([]*perBackendState, len(common.SourceBackendStubs)),
 		tempFilesMu:    &sync.Mutex{},
+		backends:       &sync.WaitGroup{},
 	}
 
 	// TODO: it’d be so much better if we would correctly handle ESPACE errors
@@ -356,7 +593,8 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 
 	dir := filepath.Join(*queryResultsPath, queryid)
 	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
-		return false, xerrors.Errorf("could not create %q: %w", dir, err)
+		cancel()
+		return false, nil, xerrors.Errorf("could not create %q: %w", dir, err)
 	}
 
 	for i := 0; i < len(common.SourceBackendStubs); i++ {
@@ -364,7 +602,9 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 		path := filepath.Join(dir, fmt.Sprintf("unsorted_%d.pb", i))
 		f, err := os.Create(path)
 		if err != nil {
-			return false, xerrors.Errorf("could not create %q: %w", path, err)
+			cancel()
+			releaseTempFiles(querystate)
+			return false, nil, xerrors.Errorf("could not create %q: %w", path, err)
 		}
 		querystate.perBackend[i] = &perBackendState{
 			packagePool:    stringpool.NewStringPool(),
@@ -375,25 +615,25 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 	}
 	log.Printf("querystate = %v\n", querystate)
 
-	// Rewrite the query into a query for source backends.
-	fakeUrl, err := url.Parse("?" + query)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rewritten := search.RewriteQuery(*fakeUrl)
-	searchRequest := &sourcebackendpb.SearchRequest{
-		Query:        rewritten.Query().Get("q"),
-		RewrittenUrl: rewritten.String(),
-	}
+	searchRequest := newSearchRequest(query)
 	log.Printf("[%s] querying for %+v\n", queryid, searchRequest)
-	if err := startQuery(queryid, querystate); err != nil {
-		// Another goroutine must have raced us since we called queryExists().
-		return true, nil
+	l, err := startQuery(listenCtx, queryid, querystate)
+	if err != nil {
+		// The query must have been restored from the query cache since we
+		// called joinQuery().
+		cancel()
+		releaseTempFiles(querystate)
+		l, ok := joinQuery(listenCtx, queryid)
+		return ok, l, nil
 	}
+	querystate.backends.Add(len(common.SourceBackendStubs))
 	for idx, backend := range common.SourceBackendStubs {
-		go queryBackend(ctx, queryid, src, backend, idx, searchRequest)
+		go func(idx int, backend sourcebackendpb.SourceBackendClient) {
+			defer querystate.backends.Done()
+			queryBackend(ctx, queryid, src, backend, idx, querystate.perBackend[idx], searchRequest)
+		}(idx, backend)
 	}
-	return false, nil
+	return false, l, nil
 }
 
 type queryStats struct {
@@ -415,11 +655,7 @@ type queryStats struct {
 func QueryzHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	if cancel := r.PostFormValue("cancel"); cancel != "" {
-		addEventMarshal(cancel, &Error{
-			Type:      "error",
-			ErrorType: "cancelled",
-		})
-		finishQuery(cancel)
+		cancelQuery(cancel)
 		http.Redirect(w, r, "/queryz", http.StatusFound)
 		return
 	}
@@ -546,12 +782,26 @@ func storeResult(queryid string, backendidx int, result *sourcebackendpb.Match,
 		offset:      bstate.tempFileOffset,
 		length:      resultLen,
 		pathHash:    h.Sum64(),
-		packageName: bstate.packagePool.Get(result.Package)})
+		packageName: bstate.packagePool.Get(result.Package),
+		dupKey:      dupKey(result)})
 	bstate.allPackages[result.Package] = true
 }
 
+// markIncomplete prevents queryid from being cached once it is finished.
+func markIncomplete(queryid string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	s, ok := state[queryid]
+	if !ok {
+		return
+	}
+	s.incomplete = true
+	state[queryid] = s
+}
+
 func failQuery(queryid string) {
 	failedQueries.Inc()
+	markIncomplete(queryid)
 	addEventMarshal(queryid, &Error{
 		Type:      "error",
 		ErrorType: "failed",
@@ -559,12 +809,48 @@ func failQuery(queryid string) {
 	finishQuery(queryid)
 }
 
+// cancelQuery stops the source backend queries of queryid unless the query is
+// already complete, and sends a “cancelled” error to all clients.
+func cancelQuery(queryid string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	cancelQueryLocked(queryid)
+}
+
+// cancelQueryLocked is like cancelQuery, but must be called with stateMu held.
+// As cancelled queries expire immediately (see queryExistsLocked), stateMu
+// must not be released before the query is finished, or the events could end
+// up in a new instance of the query.
+func cancelQueryLocked(queryid string) {
+	s, ok := state[queryid]
+	if !ok || s.done {
+		return
+	}
+	s.cancelled = true
+	state[queryid] = s
+
+	s.cancel()
+	b, err := json.Marshal(&Error{
+		Type:      "error",
+		ErrorType: "cancelled",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	addEventLocked(queryid, b, nil)
+	finishQueryLocked(queryid)
+}
+
 func finishQuery(queryid string) {
-	stateMu.RLock()
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	finishQueryLocked(queryid)
+}
+
+func finishQueryLocked(queryid string) {
 	started := state[queryid].started
-	stateMu.RUnlock()
 	log.Printf("[%s] done (in %v), closing all client channels.\n", queryid, time.Since(started))
-	addEvent(queryid, []byte{}, nil)
+	addEventLocked(queryid, []byte{}, nil)
 
 	queryDurations.Observe(float64(time.Since(started) / time.Millisecond))
 }
@@ -581,7 +867,7 @@ func fsBytes(path string) (available uint64, total uint64) {
 }
 
 // Makes sure 20% of the filesystem backing -query_results_path are available,
-// cleans up old query results otherwise.
+// evicts the least recently used cached queries otherwise.
 func ensureEnoughSpaceAvailable() {
 	if err := os.MkdirAll(*queryResultsPath, 0755); err != nil {
 		log.Println(err)
@@ -593,35 +879,19 @@ func ensureEnoughSpaceAvailable() {
 		return
 	}
 
-	log.Printf("Deleting an old query...\n")
-	dir, err := os.Open(*queryResultsPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer dir.Close()
-	infos, err := dir.Readdir(-1)
-	if err != nil {
-		log.Fatal(err)
-	}
-	sort.Slice(infos, func(i, j int) bool {
-		return infos[i].ModTime().Before(infos[j].ModTime())
-	})
-	for _, info := range infos {
-		if !info.IsDir() {
-			continue
-		}
-		log.Printf("Removing query results for %q to make enough space\n", info.Name())
-		if err := os.RemoveAll(filepath.Join(*queryResultsPath, info.Name())); err != nil {
-			log.Fatal(err)
+	log.Printf("Evicting cached queries to make enough space...\n")
+	for available < headroom {
+		if !queryCache.evictOldest() {
+			log.Printf("Query cache is empty, but only %d bytes are available\n", available)
+			return
 		}
 		available, _ = fsBytes(*queryResultsPath)
-		if available >= headroom {
-			break
-		}
 	}
 }
 
-func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) error {
+// readFromPointers reads the match each of pointers refers to from the
+// temporary files of queryid and calls fn with it, in order.
+func readFromPointers(queryid string, pointers []resultPointer, fn func(match *sourcebackendpb.Match) error) error {
 	stateMu.RLock()
 	s := state[queryid]
 	stateMu.RUnlock()
@@ -630,12 +900,9 @@ func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) er
 	s.tempFilesMu.Lock()
 	defer s.tempFilesMu.Unlock()
 
-	if _, err := f.Write([]byte("[")); err != nil {
-		return err
-	}
 	var msg sourcebackendpb.SearchReply
 	buf := proto.NewBuffer(nil)
-	for idx, pointer := range pointers {
+	for _, pointer := range pointers {
 		src := s.perBackend[pointer.backendidx].tempFile
 		if _, err := src.Seek(pointer.offset, os.SEEK_SET); err != nil {
 			return err
@@ -645,11 +912,6 @@ func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) er
 		if _, err := src.Read(rdbuf); err != nil {
 			return err
 		}
-		if idx > 0 {
-			if _, err := f.Write([]byte(",")); err != nil {
-				return err
-			}
-		}
 		buf.SetBuf(rdbuf)
 		msg.Reset()
 		if err := buf.Unmarshal(&msg); err != nil {
@@ -663,10 +925,51 @@ func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) er
 		// the dcs-source-backend in queryBackend(), but then modify the
 		// ranking in storeResult().
 		match.Ranking = match.Pathrank + ((firstPathRank * 0.1) * match.Ranking)
-		if err := WriteMatchJSON(match, f); err != nil {
+		match.AlsoIn = s.alsoIn[pointer.key()]
+		if err := fn(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readChunkSize is the number of results which readAllFromPointers reads
+// while holding the lock on the temporary files of a query, so that reading
+// all results of a large query does not block other requests for it.
+const readChunkSize = 1000
+
+// readAllFromPointers is like readFromPointers, but releases the lock on the
+// temporary files of queryid every readChunkSize results.
+func readAllFromPointers(queryid string, pointers []resultPointer, fn func(match *sourcebackendpb.Match) error) error {
+	for start := 0; start < len(pointers); start += readChunkSize {
+		end := start + readChunkSize
+		if end > len(pointers) {
+			end = len(pointers)
+		}
+		if err := readFromPointers(queryid, pointers[start:end], fn); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) error {
+	if _, err := f.Write([]byte("[")); err != nil {
+		return err
+	}
+	first := true
+	err := readFromPointers(queryid, pointers, func(match *sourcebackendpb.Match) error {
+		if !first {
+			if _, err := f.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		return WriteMatchJSON(match, f)
+	})
+	if err != nil {
+		return err
+	}
 	if _, err := f.Write([]byte("]\n")); err != nil {
 		return err
 	}
@@ -730,7 +1033,11 @@ func writeToDisk(queryid string) error {
 	// in the code below (and above), but for that we need to carefully test it.
 	ensureEnoughSpaceAvailable()
 
-	pages := int(math.Ceil(float64(len(pointers)) / float64(resultsPerPage)))
+	results, alsoIn, duplicates := collapseDuplicates(pointers)
+	if len(results) < len(pointers) {
+		log.Printf("[%s] collapsed %d identical results.\n", queryid, len(pointers)-len(results))
+	}
+	pages := int(math.Ceil(float64(len(results)) / float64(resultsPerPage)))
 
 	// Now save the results into their package-specific files.
 	byPkgSortingStarted := time.Now()
@@ -754,8 +1061,11 @@ func writeToDisk(queryid string) error {
 
 	stateMu.Lock()
 	s = state[queryid]
-	s.resultPointers = pointers
+	s.resultPointers = results
 	s.resultPointersByPkg = bypkg
+	s.alsoIn = alsoIn
+	s.duplicates = duplicates
+	s.sorted = newSortedResults()
 	s.resultPages = pages
 	state[queryid] = s
 	stateMu.Unlock()
@@ -764,6 +1074,62 @@ func writeToDisk(queryid string) error {
 	return nil
 }
 
+// collapseDuplicates returns pointers (which must be sorted) without the
+// pointers whose dupKey equals that of a higher-ranked pointer. By the pointer
+// they were collapsed into, it also returns the packages of the removed
+// pointers (see sourcebackendpb.Match.AlsoIn) and the removed pointers
+// themselves (for exporting all results). The per-package results keep all
+// pointers.
+func collapseDuplicates(pointers []resultPointer) ([]resultPointer, map[pointerKey][]string, map[pointerKey][]resultPointer) {
+	type pkgKey struct {
+		dupKey  uint64
+		pkgname string
+	}
+	var (
+		results    []resultPointer
+		alsoIn     map[pointerKey][]string
+		duplicates map[pointerKey][]resultPointer
+		first      = make(map[uint64]resultPointer)
+		seen       = make(map[pkgKey]bool)
+	)
+	for idx, pointer := range pointers {
+		if pointer.dupKey == 0 {
+			if results != nil {
+				results = append(results, pointer)
+			}
+			continue
+		}
+		kept, ok := first[pointer.dupKey]
+		if !ok {
+			first[pointer.dupKey] = pointer
+			seen[pkgKey{pointer.dupKey, *pointer.packageName}] = true
+			if results != nil {
+				results = append(results, pointer)
+			}
+			continue
+		}
+		if results == nil {
+			// Copy on the first duplicate, so that queries without
+			// duplicates do not need another slice.
+			results = make([]resultPointer, idx, len(pointers))
+			copy(results, pointers[:idx])
+			alsoIn = make(map[pointerKey][]string)
+			duplicates = make(map[pointerKey][]resultPointer)
+		}
+		duplicates[kept.key()] = append(duplicates[kept.key()], pointer)
+		pk := pkgKey{pointer.dupKey, *pointer.packageName}
+		if seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		alsoIn[kept.key()] = append(alsoIn[kept.key()], pk.pkgname)
+	}
+	if results == nil {
+		return pointers, nil, nil
+	}
+	return results, alsoIn, duplicates
+}
+
 func storeProgress(queryid string, backendidx int, progress *sourcebackendpb.ProgressUpdate) {
 	stateMu.RLock()
 	s := state[queryid]
@@ -771,6 +1137,7 @@ func storeProgress(queryid string, backendidx int, progress *sourcebackendpb.Pro
 	s.filesMu.Lock()
 	s.filesTotal[backendidx] = int(progress.FilesTotal)
 	s.filesProcessed[backendidx] = int(progress.FilesProcessed)
+	s.truncated[backendidx] = s.truncated[backendidx] || progress.Truncated
 	s.filesMu.Unlock()
 	allSet := true
 	for i := 0; i < len(common.SourceBackendStubs); i++ {
@@ -789,6 +1156,10 @@ func storeProgress(queryid string, backendidx int, progress *sourcebackendpb.Pro
 	for _, total := range s.filesTotal {
 		filesTotal += total
 	}
+	truncated := false
+	for _, t := range s.truncated {
+		truncated = truncated || t
+	}
 
 	if allSet && filesProcessed == filesTotal {
 		log.Printf("[%s] [src:%d] query done on all backends, writing to disk.\n", queryid, backendidx)
@@ -806,9 +1177,13 @@ func storeProgress(queryid string, backendidx int, progress *sourcebackendpb.Pro
 			FilesProcessed: filesProcessed,
 			FilesTotal:     filesTotal,
 			Results:        s.numResults(),
+			Truncated:      truncated,
 		})
 		if filesProcessed == filesTotal {
 			finishQuery(queryid)
+			if err := queryCache.store(queryid); err != nil {
+				log.Printf("[%s] could not store query in cache: %v\n", queryid, err)
+			}
 		}
 	} else {
 		log.Printf("[%s] [src:%d] progress: %d of %d\n", queryid, backendidx, progress.FilesProcessed, progress.FilesTotal)
@@ -836,13 +1211,13 @@ func PerPackageResultsHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Fatalf("Could not convert %q into a number: %v\n", matches[2], err)
 	}
-	stateMu.RLock()
-	s, ok := state[queryid]
-	stateMu.RUnlock()
-	if !ok {
+	if !queryAvailable(queryid) {
 		http.Error(w, "No such query.", http.StatusNotFound)
 		return
 	}
+	stateMu.RLock()
+	s := state[queryid]
+	stateMu.RUnlock()
 	if !s.done {
 		started := time.Now()
 		for time.Since(started) < 60*time.Second {
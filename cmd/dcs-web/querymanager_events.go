@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -38,6 +41,10 @@ type event struct {
 func addEvent(queryid string, data []byte, origdata interface{}) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	addEventLocked(queryid, data, origdata)
+}
+
+func addEventLocked(queryid string, data []byte, origdata interface{}) {
 	s := state[queryid]
 	original, _ := origdata.(obsoletableEvent)
 	s.events = append(s.events, event{
@@ -92,17 +99,83 @@ func addEventMarshal(queryid string, data interface{}) {
 	}
 }
 
-func getEvent(queryid string, lastseen int) (event, int) {
+// errQueryReplaced is returned by getEvent when the query instance the
+// listener joined is gone, e.g. because it was cancelled and then restarted.
+var errQueryReplaced = errors.New("query was replaced by a new instance")
+
+// A listener is a client waiting for the events of one instance of a query,
+// see listenLocked.
+type listener struct {
+	queryid    string
+	generation uint64
+	newEvent   *sync.Cond
+}
+
+// getEvent returns the event following lastseen, waiting for it if necessary.
+// It returns ctx.Err() once ctx is done, which requires that ctx is the
+// context with which l was registered.
+func getEvent(ctx context.Context, l *listener, lastseen int) (event, int, error) {
 	// We need to prevent new events being added, otherwise we could deadlock.
 	stateMu.Lock()
+	defer stateMu.Unlock()
+	for {
+		s, ok := state[l.queryid]
+		if !ok || s.generation != l.generation {
+			return event{}, lastseen, errQueryReplaced
+		}
+		if lastseen+1 < len(s.events) {
+			return s.events[lastseen+1], lastseen + 1, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return event{}, lastseen, err
+		}
+		log.Printf("[%s] lastseen=%d, waiting\n", l.queryid, lastseen)
+		l.newEvent.Wait()
+	}
+}
+
+// listenLocked registers a listener for the current instance of queryid (which
+// must exist) until ctx is done. Once the last listener of a query which is
+// not yet complete is gone, the query is cancelled, as nobody is interested in
+// its results anymore.
+//
+// Callers must hold stateMu, so that the query cannot be cancelled or
+// replaced between looking it up or starting it and registering the listener.
+func listenLocked(ctx context.Context, queryid string) *listener {
 	s := state[queryid]
-	for lastseen+1 >= len(s.events) {
-		log.Printf("[%s] lastseen=%d, waiting\n", queryid, lastseen)
-		s.newEvent.Wait()
-		s = state[queryid]
+	s.listeners++
+	state[queryid] = s
+	l := &listener{
+		queryid:    queryid,
+		generation: s.generation,
+		newEvent:   s.newEvent,
+	}
+
+	go func() {
+		<-ctx.Done()
+		unlisten(l)
+	}()
+	return l
+}
+
+// unlisten unregisters l, cancelling its query instance if l was the last
+// listener.
+func unlisten(l *listener) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	// Wake up getEvent() so that it can return.
+	l.newEvent.Broadcast()
+	s, ok := state[l.queryid]
+	if !ok || s.generation != l.generation {
+		// The instance l listened to is gone, and with it its listeners.
+		return
+	}
+	s.listeners--
+	state[l.queryid] = s
+	if s.listeners == 0 && !s.done {
+		log.Printf("[%s] no listeners left, cancelling\n", l.queryid)
+		cancelQueryLocked(l.queryid)
 	}
-	stateMu.Unlock()
-	return s.events[lastseen+1], lastseen + 1
 }
 
 func queryCompleted(queryid string) bool {
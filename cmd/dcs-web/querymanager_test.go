@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"google.golang.org/grpc"
+)
+
+// blockingBackend is a source backend whose searches only return once they
+// are cancelled.
+type blockingBackend struct {
+	// Only Search is implemented.
+	sourcebackendpb.SourceBackendClient
+}
+
+func (b *blockingBackend) Search(ctx context.Context, in *sourcebackendpb.SearchRequest, opts ...grpc.CallOption) (sourcebackendpb.SourceBackend_SearchClient, error) {
+	return &blockingSearchClient{ctx: ctx}, nil
+}
+
+type blockingSearchClient struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (c *blockingSearchClient) Recv() (*sourcebackendpb.SearchReply, error) {
+	<-c.ctx.Done()
+	return nil, c.ctx.Err()
+}
+
+func TestRestartedQueryListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-querymanager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(old string) { *queryResultsPath = old }(*queryResultsPath)
+	*queryResultsPath = dir
+	defer func(old []sourcebackendpb.SourceBackendClient) { common.SourceBackendStubs = old }(common.SourceBackendStubs)
+	common.SourceBackendStubs = []sourcebackendpb.SourceBackendClient{&blockingBackend{}}
+
+	const query = "q=foo"
+	queryid := queryIdentifier(query)
+	ctx := context.Background()
+	// The listeners are unregistered explicitly (using unlisten) below, so
+	// their contexts are never done.
+	cached, old1, err := maybeStartQuery(ctx, ctx, queryid, "test", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Fatalf("maybeStartQuery() = cached, want started")
+	}
+	cached, old2, err := maybeStartQuery(ctx, ctx, queryid, "test", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached {
+		t.Fatalf("maybeStartQuery() = started, want cached")
+	}
+	stateMu.RLock()
+	first := state[queryid]
+	stateMu.RUnlock()
+
+	// E.g. cancelled via /queryz, while both clients are still connected.
+	cancelQuery(queryid)
+	for lastseen := -1; ; {
+		ev, sequence, err := getEvent(ctx, old1, lastseen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastseen = sequence
+		if len(ev.data) == 0 {
+			break
+		}
+		if got, want := string(ev.data), `{"Type":"error","ErrorType":"cancelled"}`; got != want {
+			t.Errorf("unexpected event: got %s, want %s", got, want)
+		}
+	}
+
+	// Requesting the cancelled query again starts a new instance.
+	cached, l, err := maybeStartQuery(ctx, ctx, queryid, "test", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Fatalf("maybeStartQuery() = cached, want started")
+	}
+	defer func() {
+		stateMu.Lock()
+		s := state[queryid]
+		cancelQueryLocked(queryid)
+		delete(state, queryid)
+		stateMu.Unlock()
+		releaseTempFiles(s)
+	}()
+
+	// The first instance was done writing to its (closed) temporary files
+	// before they were re-created.
+	first.backends.Wait()
+	if _, err := first.perBackend[0].tempFile.Write([]byte("x")); err == nil {
+		t.Errorf("temporary file of the cancelled query still open")
+	}
+
+	// The clients of the first instance going away must not affect the new
+	// instance.
+	unlisten(old1)
+	unlisten(old2)
+	stateMu.RLock()
+	s := state[queryid]
+	stateMu.RUnlock()
+	if s.listeners != 1 || s.cancelled {
+		t.Fatalf("new query instance: got %d listeners, cancelled = %v, want 1 listener, not cancelled", s.listeners, s.cancelled)
+	}
+	if _, _, err := getEvent(ctx, old1, -1); err != errQueryReplaced {
+		t.Errorf("getEvent(first instance) = %v, want %v", err, errQueryReplaced)
+	}
+
+	unlisten(l)
+	stateMu.RLock()
+	s = state[queryid]
+	stateMu.RUnlock()
+	if !s.cancelled {
+		t.Errorf("new query instance not cancelled after its last listener went away")
+	}
+}
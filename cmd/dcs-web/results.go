@@ -21,8 +21,11 @@ func startJsonResponse(w http.ResponseWriter) {
 	w.Header().Set("Expires", cacheUntil)
 }
 
-func writeResults(queryid string, page int, results io.Writer, w http.ResponseWriter, r *http.Request) error {
-	pointers := state[queryid].resultPointers
+func writeResults(queryid string, page int, order resultOrder, results io.Writer, w http.ResponseWriter, r *http.Request) error {
+	pointers, err := sortedPointers(queryid, order)
+	if err != nil {
+		return fmt.Errorf("Could not sort results: %v", err)
+	}
 	pages := int(math.Ceil(float64(len(pointers)) / float64(resultsPerPage)))
 	if page > pages {
 		http.Error(w, "No such page.", http.StatusNotFound)
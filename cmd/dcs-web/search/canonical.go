@@ -0,0 +1,79 @@
+package search
+
+import (
+	"net/url"
+	"regexp/syntax"
+	"sort"
+)
+
+// setValued lists the parameters of a rewritten query whose values form a
+// set, i.e. neither their order nor duplicates change the query result. Of
+// all other parameters, only the first value is used (see url.Values.Get).
+var setValued = map[string]bool{
+	"filetype":  true,
+	"nfiletype": true,
+	"npackage":  true,
+	"path":      true,
+	"npath":     true,
+	"and":       true,
+	"not":       true,
+}
+
+// regexpValued lists the parameters of a rewritten query whose values are
+// regular expressions.
+var regexpValued = map[string]bool{
+	"q":        true,
+	"and":      true,
+	"not":      true,
+	"package":  true,
+	"npackage": true,
+	"path":     true,
+	"npath":    true,
+}
+
+// canonicalRegexp returns the simplified form of the regular expression expr,
+// so that e.g. a literal query and the equivalent quoted regular expression
+// are the same. expr is returned unmodified if it cannot be parsed.
+func canonicalRegexp(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return expr
+	}
+	return re.Simplify().String()
+}
+
+// CanonicalQuery returns a canonical form of the query in u, which is equal
+// for queries which only differ in the order of their keywords (e.g. “foo
+// package:bar” and “package:bar foo”), in duplicate keywords or in the
+// notation of their regular expressions. It is used to identify queries, so
+// that equivalent queries share their results.
+func CanonicalQuery(u url.URL) string {
+	rewritten := RewriteQuery(u)
+	query := rewritten.Query()
+	// RewriteQuery turned literal queries into quoted regular expressions.
+	query.Del("literal")
+	// The order of the results does not change which results are found.
+	query.Del("sort")
+	canonical := make(url.Values, len(query))
+	for key, values := range query {
+		if !setValued[key] {
+			values = values[:1]
+		}
+		normalized := make([]string, 0, len(values))
+		seen := make(map[string]bool, len(values))
+		for _, v := range values {
+			if regexpValued[key] {
+				v = canonicalRegexp(v)
+			}
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			normalized = append(normalized, v)
+		}
+		sort.Strings(normalized)
+		canonical[key] = normalized
+	}
+	// Encode sorts by key.
+	return canonical.Encode()
+}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"net/url"
+	"testing"
+)
+
+func canonical(t *testing.T, query string) string {
+	t.Helper()
+	u, err := url.Parse("/search?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CanonicalQuery(*u)
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		a, b string
+	}{
+		{
+			desc: "keyword order",
+			a:    "q=foo+package%3Abar",
+			b:    "q=package%3Abar+foo",
+		},
+		{
+			desc: "filetype order",
+			a:    "q=foo+filetype%3Ac+filetype%3Ago",
+			b:    "q=filetype%3Ago+foo+filetype%3AC",
+		},
+		{
+			desc: "duplicate keywords",
+			a:    "q=foo+-path%3Atest+-path%3Atest",
+			b:    "q=foo+-path%3Atest",
+		},
+		{
+			desc: "term order",
+			a:    "q=foo+and%3Abar+and%3Abaz",
+			b:    "q=and%3Abaz+foo+and%3Abar",
+		},
+		{
+			desc: "literal",
+			a:    "q=a.b&literal=1",
+			b:    "q=a%5C.b&literal=0",
+		},
+		{
+			desc: "regexp notation",
+			a:    "q=fo%7B2%7D",
+			b:    "q=foo",
+		},
+		{
+			desc: "character class notation",
+			a:    "q=%5B0-9%5D",
+			b:    "q=%5Cd",
+		},
+		{
+			desc: "sort order",
+			a:    "q=foo&sort=path",
+			b:    "q=foo",
+		},
+		{
+			desc: "parameter order",
+			a:    "q=foo&case=no&context=3",
+			b:    "context=3&q=foo&case=no",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			a, b := canonical(t, tt.a), canonical(t, tt.b)
+			if a != b {
+				t.Fatalf("CanonicalQuery(%q) = %q differs from CanonicalQuery(%q) = %q", tt.a, a, tt.b, b)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		desc string
+		a, b string
+	}{
+		{
+			desc: "different terms",
+			a:    "q=foo",
+			b:    "q=bar",
+		},
+		{
+			desc: "literal",
+			a:    "q=a.b&literal=1",
+			b:    "q=a.b&literal=0",
+		},
+		{
+			desc: "only the first package is used",
+			a:    "q=foo+package%3Aa+package%3Ab",
+			b:    "q=foo+package%3Ab+package%3Aa",
+		},
+		{
+			desc: "case",
+			a:    "q=foo+case%3Ano",
+			b:    "q=foo",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			a, b := canonical(t, tt.a), canonical(t, tt.b)
+			if a == b {
+				t.Fatalf("CanonicalQuery(%q) and CanonicalQuery(%q) are both %q", tt.a, tt.b, a)
+			}
+		})
+	}
+}
@@ -2,14 +2,19 @@
 package search
 
 import (
+	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	dcsregexp "github.com/Debian/dcs/regexp"
 )
 
 var (
-	start = regexp.MustCompile(`(?i)^\s*(-?(?:filetype|package|pkg|path|file)):(\S+)\s+`)
-	end   = regexp.MustCompile(`(?i)\s+(-?(?:filetype|package|pkg|path|file)):(\S+)\s*$`)
+	start = regexp.MustCompile(`(?i)^\s*(-?(?:filetype|package|pkg|path|file)|case|word|and|not):(\S+)\s+`)
+	end   = regexp.MustCompile(`(?i)\s+(-?(?:filetype|package|pkg|path|file)|case|word|and|not):(\S+)\s*$`)
 )
 
 func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
@@ -30,7 +35,7 @@ func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
 		} else if strings.HasPrefix(filter, "-") {
 			filter = "n" + filter[1:]
 		}
-		if strings.HasSuffix(filter, "filetype") {
+		if strings.HasSuffix(filter, "filetype") || filter == "case" || filter == "word" {
 			value = strings.ToLower(value)
 		}
 		query.Add(filter, value)
@@ -48,7 +53,9 @@ func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
 }
 
 // Parses the querystring (q= parameter) and moves special tokens such as
-// "lang:c" from the querystring into separate arguments.
+// "lang:c" from the querystring into separate arguments. "and:pattern" (files
+// must also match pattern) and "not:pattern" (files must not match pattern)
+// become and= and not= arguments.
 func RewriteQuery(u url.URL) url.URL {
 	// query is a copy which we will modify using Set() and use in the result
 	query := rewriteFilters(u.Query(), start)
@@ -61,3 +68,61 @@ func RewriteQuery(u url.URL) url.URL {
 
 	return u
 }
+
+// RegexpOptions returns the matching options selected in the rewritten query:
+// case:no (or case=no) selects case-insensitive matching, word:yes (or
+// word=yes) selects matching on word boundaries only.
+func RegexpOptions(query url.Values) dcsregexp.Options {
+	return dcsregexp.Options{
+		FoldCase:  query.Get("case") == "no",
+		WholeWord: query.Get("word") == "yes",
+	}
+}
+
+const (
+	// DefaultContextLines is the number of lines of context around each
+	// match unless the query specifies context=.
+	DefaultContextLines = 2
+
+	// maxContextLines matches sourcebackend.MaxContextLines.
+	maxContextLines = 20
+)
+
+// ContextLines returns the number of lines of context around each match
+// selected by the context= parameter of the rewritten query.
+func ContextLines(query url.Values) (int, error) {
+	v := query.Get("context")
+	if v == "" {
+		return DefaultContextLines, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid context=%q: %v", v, err)
+	}
+	if n < 0 || n > maxContextLines {
+		return 0, fmt.Errorf("context=%d out of range [0, %d]", n, maxContextLines)
+	}
+	return n, nil
+}
+
+// ResultMode returns the result mode selected by the mode= parameter of the
+// rewritten query: matches (the default), files or count.
+func ResultMode(query url.Values) (sourcebackendpb.SearchRequest_ResultMode, error) {
+	switch v := query.Get("mode"); v {
+	case "", "matches":
+		return sourcebackendpb.SearchRequest_MATCHES, nil
+	case "files":
+		return sourcebackendpb.SearchRequest_FILES_ONLY, nil
+	case "count":
+		return sourcebackendpb.SearchRequest_COUNT_ONLY, nil
+	default:
+		return 0, fmt.Errorf("invalid mode=%q", v)
+	}
+}
+
+// Dedup returns whether matches in identical files should be collapsed into
+// one match, which is the default unless the rewritten query specifies
+// dedup=no.
+func Dedup(query url.Values) bool {
+	return query.Get("dedup") != "no"
+}
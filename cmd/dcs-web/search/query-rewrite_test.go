@@ -3,7 +3,11 @@ package search
 
 import (
 	"net/url"
+	"reflect"
 	"testing"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	dcsregexp "github.com/Debian/dcs/regexp"
 )
 
 func rewrite(t *testing.T, urlstr string) url.URL {
@@ -162,3 +166,138 @@ func TestRewriteQuery(t *testing.T) {
 		t.Fatalf("Expected two elements in the hash of the -package keyword, saw %d", seen)
 	}
 }
+
+func TestRewriteQueryOptions(t *testing.T) {
+	for _, tt := range []struct {
+		urlstr string
+		q      string
+		want   dcsregexp.Options
+	}{
+		{"/search?q=searchterm", "searchterm", dcsregexp.Options{}},
+		{"/search?q=searchterm+case%3Ano", "searchterm", dcsregexp.Options{FoldCase: true}},
+		{"/search?q=case%3ANo+searchterm", "searchterm", dcsregexp.Options{FoldCase: true}},
+		{"/search?q=searchterm+case%3Ayes", "searchterm", dcsregexp.Options{}},
+		{"/search?q=searchterm+word%3Ayes", "searchterm", dcsregexp.Options{WholeWord: true}},
+		{"/search?q=word%3Ayes+searchterm+case%3Ano+filetype%3Ac", "searchterm", dcsregexp.Options{FoldCase: true, WholeWord: true}},
+		{"/search?q=searchterm&case=no&word=yes", "searchterm", dcsregexp.Options{FoldCase: true, WholeWord: true}},
+	} {
+		rewritten := rewrite(t, tt.urlstr)
+		if got := rewritten.Query().Get("q"); got != tt.q {
+			t.Errorf("%s: expected search query %q, got %q", tt.urlstr, tt.q, got)
+		}
+		if got := RegexpOptions(rewritten.Query()); got != tt.want {
+			t.Errorf("%s: RegexpOptions = %+v, want %+v", tt.urlstr, got, tt.want)
+		}
+	}
+}
+
+func TestContextLines(t *testing.T) {
+	for _, tt := range []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"q=foo", DefaultContextLines, false},
+		{"q=foo&context=0", 0, false},
+		{"q=foo&context=20", 20, false},
+		{"q=foo&context=21", 0, true},
+		{"q=foo&context=-1", 0, true},
+		{"q=foo&context=two", 0, true},
+	} {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ContextLines(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ContextLines(%q): err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ContextLines(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestResultMode(t *testing.T) {
+	for _, tt := range []struct {
+		query   string
+		want    sourcebackendpb.SearchRequest_ResultMode
+		wantErr bool
+	}{
+		{"q=foo", sourcebackendpb.SearchRequest_MATCHES, false},
+		{"q=foo&mode=matches", sourcebackendpb.SearchRequest_MATCHES, false},
+		{"q=foo&mode=files", sourcebackendpb.SearchRequest_FILES_ONLY, false},
+		{"q=foo&mode=count", sourcebackendpb.SearchRequest_COUNT_ONLY, false},
+		{"q=foo&mode=lines", 0, true},
+	} {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ResultMode(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResultMode(%q): err = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResultMode(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  bool
+	}{
+		{"q=foo", true},
+		{"q=foo&dedup=yes", true},
+		{"q=foo&dedup=no", false},
+	} {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Dedup(query); got != tt.want {
+			t.Errorf("Dedup(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteQueryTerms(t *testing.T) {
+	for _, tt := range []struct {
+		urlstr string
+		q      string
+		and    []string
+		not    []string
+	}{
+		{"/search?q=setuid%5C%28+not%3Asetgid%5C%28", `setuid\(`, nil, []string{`setgid\(`}},
+		{"/search?q=foo+and%3Abar+and%3Abaz", "foo", []string{"baz", "bar"}, nil},
+		{"/search?q=and%3Abar+foo", "foo", []string{"bar"}, nil},
+		{"/search?q=foo+filetype%3Ac+not%3Abar", "foo", nil, []string{"bar"}},
+		{"/search?q=foo+not%3Abar+filetype%3Ac", "foo", nil, []string{"bar"}},
+		{"/search?q=foo+AND%3Abar", "foo", []string{"bar"}, nil},
+		// A lone term is the search query itself.
+		{"/search?q=not%3Abar", "not:bar", nil, nil},
+		// Leading or trailing -x and +x tokens are ordinary code.
+		{"/search?q=rm+-rf", "rm -rf", nil, nil},
+		{"/search?q=set+-e", "set -e", nil, nil},
+		{"/search?q=return+-1", "return -1", nil, nil},
+		{"/search?q=CFLAGS+%2B%3D+-Wall", "CFLAGS += -Wall", nil, nil},
+		{"/search?q=-x+foo", "-x foo", nil, nil},
+		{"/search?q=i+%3D+-1&literal=1", `\Qi = -1\E`, nil, nil},
+	} {
+		rewritten := rewrite(t, tt.urlstr)
+		query := rewritten.Query()
+		if got := query.Get("q"); got != tt.q {
+			t.Errorf("%s: expected search query %q, got %q", tt.urlstr, tt.q, got)
+		}
+		if got := query["and"]; !reflect.DeepEqual(got, tt.and) {
+			t.Errorf("%s: expected and=%q, got %q", tt.urlstr, tt.and, got)
+		}
+		if got := query["not"]; !reflect.DeepEqual(got, tt.not) {
+			t.Errorf("%s: expected not=%q, got %q", tt.urlstr, tt.not, got)
+		}
+	}
+}
@@ -9,13 +9,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"hash/fnv"
 	"html/template"
-	"io"
 	"log"
 	"math"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
 
@@ -35,6 +32,9 @@ type halfRenderedResult struct {
 	SourcePackage string
 	RelativePath  string
 	Context       template.HTML
+
+	// Packages containing an identical match, see sourcebackendpb.Match.
+	AlsoIn []string
 }
 
 func maybeAppendContext(context []string, line string) []string {
@@ -144,11 +144,13 @@ func renderPerPackage(w http.ResponseWriter, r *http.Request, queryid string, pa
 		halfrendered := make([]halfRenderedResult, len(pp.RawResults))
 		for idx, result := range pp.RawResults {
 			var context []string
-			context = maybeAppendContext(context, result.Ctxp2)
-			context = maybeAppendContext(context, result.Ctxp1)
+			for _, line := range result.Before {
+				context = maybeAppendContext(context, line)
+			}
 			context = append(context, "<strong>"+result.Context+"</strong>")
-			context = maybeAppendContext(context, result.Ctxn1)
-			context = maybeAppendContext(context, result.Ctxn2)
+			for _, line := range result.After {
+				context = maybeAppendContext(context, line)
+			}
 
 			sourcePackage, relativePath := splitPath(result.Path)
 
@@ -203,6 +205,7 @@ func renderPerPackage(w http.ResponseWriter, r *http.Request, queryid string, pa
 // page= page number
 // perpkg= per-package grouping
 // literal= literal vs. regex search
+// sort= result order (ranking, path, package or popcon)
 func Search(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if err := r.ParseForm(); err != nil {
@@ -211,21 +214,23 @@ func Search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	src := r.RemoteAddr
+	release := admitRequest(w, r, src)
+	if release == nil {
+		return
+	}
+	defer release()
 	query := r.Form.Get("q")
 	if query == "" {
 		http.Error(w, "Empty query", http.StatusNotFound)
 		return
 	}
-	literal := r.Form.Get("literal")
-	if literal == "" {
-		literal = "0"
-	}
 
 	span := opentracing.SpanFromContext(ctx)
 	span.SetOperationName("Serverrendered: " + query)
 
-	// We encode a URL that contains _only_ the q parameter.
-	q := url.Values{"q": []string{query}}.Encode() + "&literal=" + literal
+	// We encode a URL that contains _only_ the q parameter (and the options
+	// which change the result list), like the interactive search does.
+	q := formQuery(r, query)
 
 	pageStr := r.Form.Get("page")
 	if pageStr == "" {
@@ -237,14 +242,11 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Uniquely (well, good enough) identify this query for a couple of minutes
-	// (as long as we want to cache results). We could try to normalize the
-	// query before hashing it, but that seems hardly worth the complexity.
-	h := fnv.New64()
-	io.WriteString(h, q)
-	queryid := fmt.Sprintf("%x", h.Sum64())
-
-	log.Printf("server-render(%q, %q, %q)\n", queryid, src, q)
+	order, err := parseResultOrder(r.Form.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err := validateQuery("?" + q); err != nil {
 		log.Printf("[%s] Query %q failed validation: %v\n", src, q, err)
@@ -252,7 +254,10 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := maybeStartQuery(ctx, queryid, src, q); err != nil {
+	queryid := queryIdentifier(q)
+	log.Printf("server-render(%q, %q, %q)\n", queryid, src, q)
+
+	if _, _, err := maybeStartQuery(ctx, nil, queryid, src, q); err != nil {
 		log.Printf("[%s] could not start query: %v\n", src, err)
 		http.Error(w, fmt.Sprintf("Could not start query: %v", err), http.StatusInternalServerError)
 		return
@@ -265,7 +270,7 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		if err := common.Templates.ExecuteTemplate(w, "placeholder.html", map[string]interface{}{
 			"criticalcss": common.CriticalCss,
 			"q":           r.Form.Get("q"),
-			"literal":     literal == "1",
+			"literal":     r.Form.Get("literal") == "1",
 			"host":        r.Host,
 			"version":     common.Version,
 		}); err != nil {
@@ -283,12 +288,15 @@ func Search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var buffer bytes.Buffer
-	if err := writeResults(queryid, page, &buffer, w, r); err != nil {
+	if err := writeResults(queryid, page, order, &buffer, w, r); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var results []dcsregexp.Match
+	var results []struct {
+		dcsregexp.Match
+		AlsoIn []string `json:"also_in"`
+	}
 	if err := json.NewDecoder(&buffer).Decode(&results); err != nil {
 		http.Error(w,
 			fmt.Sprintf("Could not parse results from disk: %v", err),
@@ -299,11 +307,13 @@ func Search(w http.ResponseWriter, r *http.Request) {
 	halfrendered := make([]halfRenderedResult, len(results))
 	for idx, result := range results {
 		var context []string
-		context = maybeAppendContext(context, result.Ctxp2)
-		context = maybeAppendContext(context, result.Ctxp1)
+		for _, line := range result.Before {
+			context = maybeAppendContext(context, line)
+		}
 		context = append(context, "<strong>"+result.Context+"</strong>")
-		context = maybeAppendContext(context, result.Ctxn1)
-		context = maybeAppendContext(context, result.Ctxn2)
+		for _, line := range result.After {
+			context = maybeAppendContext(context, line)
+		}
 
 		sourcePackage, relativePath := splitPath(result.Path)
 
@@ -315,6 +325,7 @@ func Search(w http.ResponseWriter, r *http.Request) {
 			SourcePackage: sourcePackage,
 			RelativePath:  relativePath,
 			Context:       template.HTML(strings.Join(context, "<br>")),
+			AlsoIn:        result.AlsoIn,
 		}
 	}
 
@@ -343,7 +354,7 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		"packages":    packages,
 		"pagination":  template.HTML(pagination),
 		"q":           r.Form.Get("q"),
-		"literal":     literal == "1",
+		"literal":     r.Form.Get("literal") == "1",
 		"page":        page,
 		"host":        r.Host,
 		"version":     common.Version,
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func TestSearchRateLimited(t *testing.T) {
+	defer func(old *keyring) { apiKeys = old }(apiKeys)
+	bucket := newTokenBucket(0.001, 1)
+	apiKeys = &keyring{keys: map[string]*apiKey{
+		anonymousKey: {name: "anonymous", bucket: bucket},
+	}}
+	// Empty the bucket, so that the next query is rejected.
+	if ok, _ := bucket.take(time.Now()); !ok {
+		t.Fatal("bucket unexpectedly empty")
+	}
+
+	rec := httptest.NewRecorder()
+	Search(rec, httptest.NewRequest("GET", "/search?q=foo", nil))
+	if got, want := rec.Code, http.StatusTooManyRequests; got != want {
+		t.Fatalf("unexpected HTTP status: got %d, want %d", got, want)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Retry-After header missing")
+	}
+}
+
+func TestSearchValidatesOptions(t *testing.T) {
+	// context= used to be dropped instead of validated (and passed on).
+	r := httptest.NewRequest("GET", "/search?q=foobar&context=99", nil)
+	span := opentracing.NoopTracer{}.StartSpan("test")
+	r = r.WithContext(opentracing.ContextWithSpan(r.Context(), span))
+	rec := httptest.NewRecorder()
+	Search(rec, r)
+	if got, want := rec.Code, http.StatusBadRequest; got != want {
+		t.Fatalf("unexpected HTTP status: got %d, want %d", got, want)
+	}
+}
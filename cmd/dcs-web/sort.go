@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/ranking"
+)
+
+var rankingDataPath = flag.String("ranking_data_path",
+	"/var/dcs/ranking.json",
+	"Path to the JSON containing ranking data (see dcs-compute-ranking), used for sort=popcon")
+
+// A resultOrder is an order in which the results of a query can be
+// presented, selected by the sort= parameter. Results are sorted by ranking
+// when the query is finished (see writeToDisk), all other orders are sorted
+// when they are first requested (see sortedPointers).
+type resultOrder string
+
+const (
+	orderRanking resultOrder = "ranking"
+
+	// By path and line number.
+	orderPath resultOrder = "path"
+
+	// By package name and version, then by ranking. Useful for splitting the
+	// results among multiple people, e.g. when auditing.
+	orderPackage resultOrder = "package"
+
+	// By the popcon installation count of the package (most installed
+	// first), then by package name and version, then by ranking.
+	orderPopcon resultOrder = "popcon"
+)
+
+// parseResultOrder returns the order selected by the value of a sort=
+// parameter, which defaults to ranking.
+func parseResultOrder(value string) (resultOrder, error) {
+	switch order := resultOrder(value); order {
+	case "":
+		return orderRanking, nil
+	case orderRanking, orderPath, orderPackage, orderPopcon:
+		return order, nil
+	default:
+		return "", fmt.Errorf("invalid sort=%q, expected ranking, path, package or popcon", value)
+	}
+}
+
+// sortedResults holds the result pointers of a query in each order other
+// than ranking which was requested so far.
+type sortedResults struct {
+	mu      sync.Mutex
+	byOrder map[resultOrder][]resultPointer
+}
+
+func newSortedResults() *sortedResults {
+	return &sortedResults{byOrder: make(map[resultOrder][]resultPointer)}
+}
+
+// loadRankingData reads the popcon installation counts for sort=popcon. Without
+// them, sort=popcon is equivalent to sort=package.
+func loadRankingData() {
+	if *rankingDataPath == "" {
+		return
+	}
+	if err := ranking.ReadRankingData(*rankingDataPath); err != nil {
+		log.Printf("Could not read ranking data, sort=popcon will sort by package: %v", err)
+	}
+}
+
+// sourcePackageName returns the package name of the full package name pkg,
+// e.g. i3-wm for i3-wm_4.8-1, or pkg itself if it has no version.
+func sourcePackageName(pkg string) string {
+	if underscore := strings.Index(pkg, "_"); underscore != -1 {
+		return pkg[:underscore]
+	}
+	return pkg
+}
+
+// lessPackage reports whether the full package name a (e.g. i3-wm_4.8-1) sorts
+// before b, comparing the package names before the versions, so that e.g.
+// foo_1 sorts before foo-bar_1.
+func lessPackage(a, b string) bool {
+	na, nb := sourcePackageName(a), sourcePackageName(b)
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// sortedPointers returns the result pointers of the (finished) query queryid
+// in the specified order. The pointers are sorted on the first request for
+// each order and kept for subsequent requests, e.g. for further pages.
+func sortedPointers(queryid string, order resultOrder) ([]resultPointer, error) {
+	stateMu.RLock()
+	s := state[queryid]
+	stateMu.RUnlock()
+	if order == orderRanking || s.sorted == nil {
+		// Queries without results have nothing to sort.
+		return s.resultPointers, nil
+	}
+
+	s.sorted.mu.Lock()
+	defer s.sorted.mu.Unlock()
+	if pointers, ok := s.sorted.byOrder[order]; ok {
+		return pointers, nil
+	}
+	pointers, err := sortPointers(queryid, s.resultPointers, order)
+	if err != nil {
+		return nil, err
+	}
+	s.sorted.byOrder[order] = pointers
+	return pointers, nil
+}
+
+// sortPointers returns a copy of the result pointers of queryid (which must be
+// in ranking order) in the specified order.
+func sortPointers(queryid string, ranked []resultPointer, order resultOrder) ([]resultPointer, error) {
+	// All orders use the ranking order as a tie-breaker, so that the order
+	// is stable.
+	pointers := make([]resultPointer, len(ranked))
+	copy(pointers, ranked)
+	switch order {
+	case orderPath:
+		// The paths are only stored in the temporary files. fn is called for
+		// each pointer, in order.
+		type location struct {
+			pointer resultPointer
+			path    string
+			line    uint32
+		}
+		locations := make([]location, 0, len(pointers))
+		err := readAllFromPointers(queryid, pointers, func(match *sourcebackendpb.Match) error {
+			locations = append(locations, location{
+				pointer: pointers[len(locations)],
+				path:    match.Path,
+				line:    match.Line,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(locations, func(i, j int) bool {
+			if locations[i].path != locations[j].path {
+				return locations[i].path < locations[j].path
+			}
+			return locations[i].line < locations[j].line
+		})
+		for idx, l := range locations {
+			pointers[idx] = l.pointer
+		}
+	case orderPackage:
+		sort.SliceStable(pointers, func(i, j int) bool {
+			return lessPackage(*pointers[i].packageName, *pointers[j].packageName)
+		})
+	case orderPopcon:
+		insts := make(map[string]float32)
+		for _, pointer := range pointers {
+			pkg := *pointer.packageName
+			if _, ok := insts[pkg]; !ok {
+				insts[pkg] = ranking.Installations(sourcePackageName(pkg))
+			}
+		}
+		sort.SliceStable(pointers, func(i, j int) bool {
+			pi, pj := *pointers[i].packageName, *pointers[j].packageName
+			if insts[pi] != insts[pj] {
+				return insts[pi] > insts[pj]
+			}
+			return lessPackage(pi, pj)
+		})
+	}
+	return pointers, nil
+}
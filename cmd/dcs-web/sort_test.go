@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/ranking"
+)
+
+func TestParseResultOrder(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    resultOrder
+		wantErr bool
+	}{
+		{"", orderRanking, false},
+		{"ranking", orderRanking, false},
+		{"path", orderPath, false},
+		{"package", orderPackage, false},
+		{"popcon", orderPopcon, false},
+		{"Path", "", true},
+		{"size", "", true},
+	} {
+		got, err := parseResultOrder(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResultOrder(%q): err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseResultOrder(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSourcePackageName(t *testing.T) {
+	for _, tt := range []struct {
+		pkg  string
+		want string
+	}{
+		{"i3-wm_4.8-1", "i3-wm"},
+		{"i3-wm", "i3-wm"},
+		{"", ""},
+	} {
+		if got := sourcePackageName(tt.pkg); got != tt.want {
+			t.Errorf("sourcePackageName(%q) = %q, want %q", tt.pkg, got, tt.want)
+		}
+	}
+}
+
+func TestSortPointers(t *testing.T) {
+	f, err := ioutil.TempFile("", "dcs-ranking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"zsh": {"Inst": 0.9}, "nover": {"Inst": 0.5}}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ranking.ReadRankingData(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	match := func(pkg, path string, line uint32, ranking float32) *sourcebackendpb.Match {
+		return &sourcebackendpb.Match{
+			Path:    pkg + "/" + path,
+			Line:    line,
+			Package: pkg,
+			Context: "i3Font",
+			Ranking: ranking,
+		}
+	}
+	cleanup := storeTestQuery(t, "sorted", []*sourcebackendpb.Match{
+		match("zsh_5.7", "a.c", 3, 0.9),
+		match("i3_4.16", "x.c", 1, 0.8),
+		match("i3-wm_4.16", "b.c", 1, 0.7),
+		match("zsh_5.7", "a.c", 1, 0.6),
+		match("nover", "c.c", 1, 0.5), // package without version
+		match("i3-wm_4.16", "a.c", 1, 0.4),
+	})
+	defer cleanup()
+
+	for _, tt := range []struct {
+		order resultOrder
+		want  []string
+	}{
+		{orderRanking, []string{
+			"zsh_5.7/a.c:3",
+			"i3_4.16/x.c:1",
+			"i3-wm_4.16/b.c:1",
+			"zsh_5.7/a.c:1",
+			"nover/c.c:1",
+			"i3-wm_4.16/a.c:1",
+		}},
+		{orderPath, []string{
+			"i3-wm_4.16/a.c:1",
+			"i3-wm_4.16/b.c:1",
+			"i3_4.16/x.c:1",
+			"nover/c.c:1",
+			"zsh_5.7/a.c:1",
+			"zsh_5.7/a.c:3",
+		}},
+		// i3 sorts before i3-wm, ties are broken by ranking.
+		{orderPackage, []string{
+			"i3_4.16/x.c:1",
+			"i3-wm_4.16/b.c:1",
+			"i3-wm_4.16/a.c:1",
+			"nover/c.c:1",
+			"zsh_5.7/a.c:3",
+			"zsh_5.7/a.c:1",
+		}},
+		// Packages without installations sort by package.
+		{orderPopcon, []string{
+			"zsh_5.7/a.c:3",
+			"zsh_5.7/a.c:1",
+			"nover/c.c:1",
+			"i3_4.16/x.c:1",
+			"i3-wm_4.16/b.c:1",
+			"i3-wm_4.16/a.c:1",
+		}},
+	} {
+		pointers, err := sortedPointers("sorted", tt.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		if err := readAllFromPointers("sorted", pointers, func(match *sourcebackendpb.Match) error {
+			got = append(got, match.Path+":"+strconv.Itoa(int(match.Line)))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort=%s: got %q, want %q", tt.order, got, tt.want)
+		}
+	}
+}
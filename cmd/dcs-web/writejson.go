@@ -8,6 +8,13 @@ import (
 	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
 )
 
+// jsonRange is a sourcebackendpb.Range which always includes both offsets,
+// even if they are zero.
+type jsonRange struct {
+	Start int32 `json:"start"`
+	End   int32 `json:"end"`
+}
+
 // WriteMatchJSON was generated when we were still using capnproto.
 // TODO: investigate whether any further performance tuning with regards to
 // generating JSON makes sense.
@@ -96,6 +103,28 @@ func WriteMatchJSON(match *sourcebackendpb.Match, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	_, err = b.WriteString("\"before\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := match.Before
+		if s == nil {
+			s = []string{}
+		}
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
 	_, err = b.WriteString("\"context\":")
 	if err != nil {
 		return err
@@ -153,6 +182,72 @@ func WriteMatchJSON(match *sourcebackendpb.Match, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	_, err = b.WriteString("\"after\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := match.After
+		if s == nil {
+			s = []string{}
+		}
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"match_range\":")
+	if err != nil {
+		return err
+	}
+	{
+		var s *jsonRange
+		if r := match.MatchRange; r != nil {
+			s = &jsonRange{Start: r.Start, End: r.End}
+		}
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"submatch_ranges\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := make([]jsonRange, len(match.SubmatchRanges))
+		for i, r := range match.SubmatchRanges {
+			s[i] = jsonRange{Start: r.Start, End: r.End}
+		}
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
 	_, err = b.WriteString("\"pathrank\":")
 	if err != nil {
 		return err
@@ -206,6 +301,28 @@ func WriteMatchJSON(match *sourcebackendpb.Match, w io.Writer) error {
 			return err
 		}
 	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"also_in\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := match.AlsoIn
+		if s == nil {
+			s = []string{}
+		}
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte('}')
 	if err != nil {
 		return err
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Debian/dcs/internal/index"
+)
+
+const convertHelp = `convert - convert a legacy index into the current index format
+
+Legacy (codesearch format) index files do not contain positional information,
+so the files they list are read from disk (relative to -root) and indexed
+again. Files which cannot be read are skipped.
+
+Example:
+  % dcs convert -idx=/srv/dcs/shard0/full -root=/srv/dcs/shard0 -trim_prefix=/srv/dcs/shard0/src/ /srv/dcs/shard0/full.idx
+`
+
+func convert(args []string) error {
+	fset := flag.NewFlagSet("convert", flag.ExitOnError)
+	fset.Usage = usage(fset, convertHelp)
+	var idx string
+	fset.StringVar(&idx, "idx", "", "path to the index directory to create")
+	var root string
+	fset.StringVar(&root, "root", "", "directory relative to which the file names of the legacy index are resolved. Defaults to the directory containing the legacy index")
+	var trimPrefix string
+	fset.StringVar(&trimPrefix, "trim_prefix", "", "prefix to remove from the resolved file names to obtain the document names")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if idx == "" || fset.NArg() != 1 {
+		fset.Usage()
+		os.Exit(1)
+	}
+	legacy := fset.Arg(0)
+	if root == "" {
+		root = filepath.Dir(legacy)
+	}
+
+	names, err := index.LegacyNames(legacy)
+	if err != nil {
+		return err
+	}
+	log.Printf("converting %d files from %s into %s", len(names), legacy, idx)
+
+	w, err := index.Create(idx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, name)
+		}
+		if err := w.AddFile(path, strings.TrimPrefix(path, trimPrefix)); err != nil {
+			log.Printf("skipping %q: %v", path, err)
+		}
+	}
+	return w.Flush()
+}
@@ -29,11 +29,14 @@ Index query commands:
 	posting  - list the (decoded) posting list for the specified trigram
 	matches  - list the filename[:pos] matches for the specified trigram
 	search   - list the filename[:pos] matches for the specified search query
+	explain  - show how the trigram query for the specified search query is evaluated
 	replay   — replay a query log
 
 Index manipulation commands:
 	create   - create an index
 	merge    - merge multiple index files into one
+	convert  - convert a legacy index into the current index format
+	verify   - check the integrity of the specified indexes
 `
 
 func usage(fset *flag.FlagSet, help string) func() {
@@ -137,10 +140,16 @@ func main() {
 		err = create(args)
 	case "merge":
 		err = merge(args)
+	case "convert":
+		err = convert(args)
 	case "search":
 		err = search(args)
+	case "explain":
+		err = explain(args)
 	case "replay":
 		err = replay(args)
+	case "verify":
+		err = verify(args)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
 		flag.Usage()
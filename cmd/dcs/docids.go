@@ -1,9 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
-	"io"
 	"math"
 	"os"
 
@@ -12,6 +12,8 @@ import (
 
 const docidsHelp = `docids - list the documents covered by this index
 
+Deleted documents are not listed, but can still be displayed using -doc.
+
 Example:
   % dcs docids -idx=/srv/dcs/shard0/full
   ruby-jquery-turbolinks_2.1.0~dfsg-1/.travis.yml
@@ -56,8 +58,13 @@ func docids(args []string) error {
 		return nil
 	}
 	// Display all docid entries
-	if _, err := io.Copy(os.Stdout, i.DocidMap.All()); err != nil {
+	paths, err := i.Paths()
+	if err != nil {
 		return err
 	}
-	return nil
+	w := bufio.NewWriter(os.Stdout)
+	for _, path := range paths {
+		fmt.Fprintln(w, path)
+	}
+	return w.Flush()
 }
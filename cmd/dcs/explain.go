@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Debian/dcs/internal/index"
+	"github.com/Debian/dcs/regexp"
+)
+
+const explainHelp = `explain - show how the trigram query for the specified search query is evaluated
+
+Prints the trigram query and, for each of the specified index shards, the
+posting list length of each trigram, the number of candidate files after each
+trigram and where the intersection stopped early.
+
+Example:
+  % dcs explain -query=i3Font /srv/dcs/shard*/full
+  trigram query "3Fo" "Fon" "i3F" "ont"
+
+  shard /srv/dcs/shard0/full: 12 candidate files
+  and: 12 docids
+    trigram "i3F" (29 entries) → 29 docids
+    trigram "3Fo" (31 entries) → 12 docids
+    trigram "Fon" (24871 entries) → 12 docids
+    stopped early: fewer than 10 candidates removed, remaining trigrams skipped
+    trigram "ont" (1129446 entries) skipped
+  […]
+`
+
+func explain(args []string) error {
+	fset := flag.NewFlagSet("explain", flag.ExitOnError)
+	fset.Usage = usage(fset, explainHelp)
+	var query string
+	fset.StringVar(&query, "query", "", "search query")
+	var caseInsensitive bool
+	fset.BoolVar(&caseInsensitive, "case_insensitive", false, "match the query case-insensitively")
+	var wholeWord bool
+	fset.BoolVar(&wholeWord, "whole_word", false, "only match the query at word boundaries")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if query == "" || fset.NArg() == 0 {
+		fset.Usage()
+		os.Exit(1)
+	}
+
+	re, err := regexp.CompileOptions(query, regexp.Options{
+		FoldCase:  caseInsensitive,
+		WholeWord: wholeWord,
+	})
+	if err != nil {
+		return err
+	}
+	q := index.RegexpQuery(re.Syntax)
+	fmt.Printf("trigram query %v\n", q)
+
+	var total int
+	for _, fn := range fset.Args() {
+		ix, err := index.OpenSegmented(fn)
+		if err != nil {
+			return fmt.Errorf("Could not open index: %v", err)
+		}
+		docids, exs := ix.ExplainPostingQuery(q)
+		fmt.Printf("\nshard %s: %d candidate files\n", fn, len(docids))
+		for idx, ex := range exs {
+			if len(exs) > 1 {
+				fmt.Printf("segment %q:\n", ix.Segments[idx].Name)
+			}
+			fmt.Printf("%v", ex)
+		}
+		ix.Close()
+		total += len(docids)
+	}
+	if fset.NArg() > 1 {
+		fmt.Printf("\n%d candidate files in %d shards\n", total, fset.NArg())
+	}
+	return nil
+}
@@ -10,7 +10,6 @@ import (
 	"log"
 	"net/url"
 	"os"
-	"path/filepath"
 	"regexp/syntax"
 	"sort"
 	"strings"
@@ -18,7 +17,6 @@ import (
 	"time"
 
 	dcssearch "github.com/Debian/dcs/cmd/dcs-web/search"
-	oldindex "github.com/Debian/dcs/index"
 	"github.com/Debian/dcs/internal/index"
 	"github.com/Debian/dcs/internal/sourcebackend"
 	"github.com/Debian/dcs/ranking"
@@ -27,11 +25,10 @@ import (
 
 const replayHelp = `replay - replay a query log
 
-Runs queries (one per line) from a logfile one by one against either the old or
-the new index implementation.
+Runs queries (one per line) from a logfile one by one against the index.
 
 Example:
-  % dcs replay -log=/home/michael/dcs-logs/2018-03-15/one-query-per-line.txt
+  % dcs replay -idx=/srv/dcs/shard0/full,/srv/dcs/shard1/full -unpacked_path=/srv/dcs/shard0/src,/srv/dcs/shard1/src -log=/home/michael/dcs-logs/2018-03-15/one-query-per-line.txt
 `
 
 type measurement struct {
@@ -44,83 +41,6 @@ type measurement struct {
 	TotalNano     int64  `json:"total_nano"`
 }
 
-type shardedOldIndex struct {
-	shards []*oldindex.Index
-}
-
-func (si *shardedOldIndex) doPostingQuery(query *oldindex.Query) []string {
-	var (
-		wg       sync.WaitGroup
-		prefixed = make([][]string, len(si.shards))
-	)
-	for i := range si.shards {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			prefix := fmt.Sprintf("/srv/dcs-benchmark/shard%d/", i)
-			ix := si.shards[i]
-			post := ix.PostingQuery(query)
-			possible := make([]string, len(post))
-			for idx, fileid := range post {
-				possible[idx] = prefix + ix.Name(fileid)
-			}
-			prefixed[i] = possible
-		}(i)
-	}
-	wg.Wait()
-	var possible []string
-	for i := range si.shards {
-		possible = append(possible, prefixed[i]...)
-	}
-	return possible
-}
-
-func (si *shardedOldIndex) measure(idx int, query string, _, skipFile, skipGrep bool) (measurement, error) {
-	m := measurement{
-		Index: idx,
-		Query: query,
-	}
-	// Rewrite the query into a query for source backends.
-	fakeUrl, err := url.Parse("?q=" + query)
-	if err != nil {
-		return m, err
-	}
-	rewritten := dcssearch.RewriteQuery(*fakeUrl)
-	//log.Printf("rewritten: %q, query = %v", rewritten.String(), rewritten.Query())
-
-	// Parse the (rewritten) URL to extract all ranking options/keywords.
-	rankingopts := ranking.RankingOptsFromQuery(rewritten.Query())
-	//log.Printf("rankingopts: %+v", rankingopts)
-
-	// query all index files
-	re, err := regexp.Compile(rewritten.Query().Get("q"))
-	if err != nil {
-		return m, fmt.Errorf("regexp.Compile: %s\n", err)
-	}
-	// if s := re.Syntax.Simplify(); s.Op == syntax.OpLiteral {
-	// 	return m, fmt.Errorf("positional skipped")
-	// }
-	start := time.Now()
-	possible := si.doPostingQuery(oldindex.RegexpQuery(re.Syntax))
-
-	// Rank all the paths.
-	files := make(ranking.ResultPaths, 0, len(possible))
-	for _, filename := range possible {
-		result := ranking.ResultPath{Path: filename}
-		result.Rank(&rankingopts)
-		if result.Ranking > -1 {
-			files = append(files, result)
-		}
-	}
-	files = sourcebackend.FilterByKeywords(&rewritten, files)
-	m.FilesSearched = len(files)
-	m.PostingNano = int64(time.Since(start))
-	m.Matches = grep(rewritten.Query().Get("q"), files, rankingopts, skipFile, skipGrep)
-	m.TotalNano = int64(time.Since(start))
-
-	return m, nil
-}
-
 // TODO: refactor to verifyBundle(), use bcmills concurrency pattern
 func verifyMatches(query string, files ranking.ResultPaths) (filesSearched int, matches int, _ error) {
 	rqb := []byte(query)
@@ -309,92 +229,7 @@ func grep(query string, files ranking.ResultPaths, rankingopts ranking.RankingOp
 	return matchCnt
 }
 
-type shardedNewIndex struct {
-	shards []*index.Index
-}
-
-func (si *shardedNewIndex) doPostingQuery(query *index.Query) []string {
-	log.Printf("doPostingQuery(%s)", query)
-	var (
-		wg       sync.WaitGroup
-		prefixed = make([][]string, len(si.shards))
-	)
-	for i := range si.shards {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			ix := si.shards[i]
-			post := ix.PostingQuery(query)
-			possible := make([]string, len(post))
-			for idx, fileid := range post {
-				fn, err := ix.DocidMap.Lookup(fileid)
-				if err != nil {
-					log.Fatalf("DocidMap.Lookup(%v): %v", fileid, err)
-				}
-				possible[idx] = fn
-			}
-			prefixed[i] = possible
-		}(i)
-	}
-	wg.Wait()
-	l := 0
-	for _, p := range prefixed {
-		l += len(p)
-	}
-	possible := make([]string, 0, l)
-	for i := range si.shards {
-		possible = append(possible, prefixed[i]...)
-	}
-	return possible
-}
-
-type entry struct {
-	fn  string
-	pos uint32
-}
-
-func (si *shardedNewIndex) doPostingQueryPos(query string) []entry {
-	log.Printf("doPostingQueryPos(%q)", query)
-	var (
-		wg       sync.WaitGroup
-		prefixed = make([][]entry, len(si.shards))
-	)
-	for i := range si.shards {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			ix := si.shards[i]
-			matches, err := ix.QueryPositional(query)
-			if err != nil {
-				log.Fatalf("QueryPositional(%q): %v", query, err)
-			}
-			possible := make([]entry, len(matches))
-			for idx, match := range matches {
-				fn, err := ix.DocidMap.Lookup(match.Docid)
-				if err != nil {
-					log.Fatalf("DocidMap.Lookup(%v): %v", match.Docid, err)
-				}
-				possible[idx] = entry{
-					fn:  fn,
-					pos: match.Position,
-				}
-			}
-			prefixed[i] = possible
-		}(i)
-	}
-	wg.Wait()
-	l := 0
-	for _, p := range prefixed {
-		l += len(p)
-	}
-	possible := make([]entry, 0, l)
-	for i := range si.shards {
-		possible = append(possible, prefixed[i]...)
-	}
-	return possible
-}
-
-func (si *shardedNewIndex) measure(idx int, query string, pos, skipFile, skipGrep bool) (measurement, error) {
+func measureQuery(searcher *sourcebackend.Searcher, idx int, query string, pos, skipFile, skipGrep bool) (measurement, error) {
 	m := measurement{
 		Index: idx,
 		Query: query,
@@ -421,12 +256,15 @@ func (si *shardedNewIndex) measure(idx int, query string, pos, skipFile, skipGre
 	m.QueryPos = queryPos
 	start := time.Now()
 	if queryPos {
-		possible := si.doPostingQueryPos(string(s.Rune))
+		possible, err := searcher.QueryPositional(string(s.Rune))
+		if err != nil {
+			return m, err
+		}
 		files := make(ranking.ResultPaths, 0, len(possible))
-		for _, entry := range possible {
+		for _, match := range possible {
 			result := ranking.ResultPath{
-				Path:     entry.fn,
-				Position: int(entry.pos),
+				Path:     match.Filename,
+				Position: int(match.Position),
 			}
 			result.Rank(&rankingopts)
 			if result.Ranking > -1 {
@@ -445,7 +283,10 @@ func (si *shardedNewIndex) measure(idx int, query string, pos, skipFile, skipGre
 		}
 		m.TotalNano = int64(time.Since(start))
 	} else {
-		possible := si.doPostingQuery(index.RegexpQuery(re.Syntax))
+		possible, err := searcher.PostingQuery(index.RegexpQuery(re.Syntax))
+		if err != nil {
+			return m, err
+		}
 
 		// Rank all the paths.
 		files := make(ranking.ResultPaths, 0, len(possible))
@@ -465,34 +306,7 @@ func (si *shardedNewIndex) measure(idx int, query string, pos, skipFile, skipGre
 	return m, nil
 }
 
-type measurer interface {
-	measure(idx int, query string, pos, skipFile, skipGrep bool) (measurement, error)
-}
-
-func logic(logPath string, old, pos bool, debug int, skipFile, skipGrep bool) error {
-	var measurer measurer
-	if old {
-		si := &shardedOldIndex{}
-		const shards = 6
-		for i := 0; i < shards; i++ {
-			ix := oldindex.Open(filepath.Join(fmt.Sprintf("/srv/dcs-benchmark/shard%d/", i), "full.idx"))
-			defer ix.Close()
-			si.shards = append(si.shards, ix)
-		}
-		measurer = si
-	} else {
-		si := &shardedNewIndex{}
-		const shards = 6
-		for i := 0; i < shards; i++ {
-			ix, err := index.Open(fmt.Sprintf("/home/michael/as/shard%d/", i))
-			if err != nil {
-				return err
-			}
-			defer ix.Close()
-			si.shards = append(si.shards, ix)
-		}
-		measurer = si
-	}
+func logic(searcher *sourcebackend.Searcher, logPath string, pos bool, debug int, skipFile, skipGrep bool) error {
 	b, err := ioutil.ReadFile(logPath)
 	if err != nil {
 		return err
@@ -504,7 +318,7 @@ func logic(logPath string, old, pos bool, debug int, skipFile, skipGrep bool) er
 		}
 
 		log.Printf("query: %s", query)
-		m, err := measurer.measure(idx, query, pos, skipFile, skipGrep)
+		m, err := measureQuery(searcher, idx, query, pos, skipFile, skipGrep)
 		if err != nil {
 			log.Printf("query %q failed: %v", query, err)
 			continue
@@ -523,8 +337,10 @@ func replay(args []string) error {
 
 	var logPath string
 	fset.StringVar(&logPath, "log", "", "path to the query log file to replay (1 query per line)")
-	var old bool
-	fset.BoolVar(&old, "old", false, "use the old index")
+	var idx string
+	fset.StringVar(&idx, "idx", "", "comma-separated paths to the index shards to work with")
+	var unpacked string
+	fset.StringVar(&unpacked, "unpacked_path", "", "comma-separated paths to the source files of each shard")
 	var pos bool
 	fset.BoolVar(&pos, "pos", false, "use the pos index")
 	var debug int
@@ -537,10 +353,16 @@ func replay(args []string) error {
 	if err := fset.Parse(args); err != nil {
 		return err
 	}
-	if logPath == "" {
+	if logPath == "" || idx == "" || unpacked == "" {
 		fset.Usage()
 		os.Exit(1)
 	}
 
-	return logic(logPath, old, pos, debug, skipFile, skipGrep)
+	searcher, err := sourcebackend.OpenSearcher(strings.Split(idx, ","), strings.Split(unpacked, ","), pos)
+	if err != nil {
+		return err
+	}
+	defer searcher.Close()
+
+	return logic(searcher, logPath, pos, debug, skipFile, skipGrep)
 }
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp/syntax"
+	"strings"
+	"time"
 
 	"github.com/Debian/dcs/internal/index"
 	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
-	"github.com/Debian/dcs/internal/rpctest"
 	"github.com/Debian/dcs/internal/sourcebackend"
-	"google.golang.org/grpc"
+	"github.com/Debian/dcs/regexp"
+	"github.com/golang/protobuf/ptypes/wrappers"
 )
 
 const searchHelp = `search - list the filename[:pos] matches for the specified search query
@@ -24,19 +27,43 @@ Example:
   /srv/dcs/shard4/src/i3-wm_4.16.1-1/i3-nagbar/main.c:471
   /srv/dcs/shard4/src/i3-wm_4.16.1-1/i3bar/src/xcb.c:68
   […]
+
+  % dcs search -idx=/srv/dcs/shard0/full,/srv/dcs/shard1/full -unpacked_path=/srv/dcs/shard0/src,/srv/dcs/shard1/src -query=i3Font
+  […]
+
+  % dcs search -idx=/srv/dcs/shard4/full -pos -explain -query=int64_t
+  positional literal
+  query "int64_t": strategy rarest, cost 1234
+  […]
 `
 
 func search(args []string) error {
 	fset := flag.NewFlagSet("search", flag.ExitOnError)
 	fset.Usage = usage(fset, searchHelp)
 	var idx string
-	fset.StringVar(&idx, "idx", "", "path to the index file to work with")
+	fset.StringVar(&idx, "idx", "", "comma-separated paths to the index shards to work with")
 	var unpacked string
-	fset.StringVar(&unpacked, "unpacked_path", "", "path to the source files to work with")
+	fset.StringVar(&unpacked, "unpacked_path", "", "comma-separated paths to the source files of each shard")
 	var query string
 	fset.StringVar(&query, "query", "", "search query")
 	var pos bool
 	fset.BoolVar(&pos, "pos", false, "do a positional query for identifier searches")
+	var maxResults int
+	fset.IntVar(&maxResults, "max_results", 0, "stop searching after this many matches (0 means no limit)")
+	var timeout time.Duration
+	fset.DurationVar(&timeout, "timeout", 0, "stop searching after this duration (0 means no timeout)")
+	var caseInsensitive bool
+	fset.BoolVar(&caseInsensitive, "case_insensitive", false, "match the query case-insensitively")
+	var wholeWord bool
+	fset.BoolVar(&wholeWord, "whole_word", false, "only match the query at word boundaries")
+	var allMatches bool
+	fset.BoolVar(&allMatches, "all_matches", false, "list every occurrence instead of at most one match per line")
+	var count bool
+	fset.BoolVar(&count, "count", false, "print the number of matches per file instead of the matches")
+	var filesOnly bool
+	fset.BoolVar(&filesOnly, "files_only", false, "print the names of matching files instead of the matches")
+	var explain bool
+	fset.BoolVar(&explain, "explain", false, "print how the index is queried instead of searching")
 	if err := fset.Parse(args); err != nil {
 		return err
 	}
@@ -45,42 +72,105 @@ func search(args []string) error {
 		os.Exit(1)
 	}
 
-	ix, err := index.Open(idx)
+	idxdirs := strings.Split(idx, ",")
+	unpackedPaths := make([]string, len(idxdirs))
+	if unpacked != "" {
+		unpackedPaths = strings.Split(unpacked, ",")
+	}
+	searcher, err := sourcebackend.OpenSearcher(idxdirs, unpackedPaths, pos)
 	if err != nil {
 		return fmt.Errorf("Could not open index: %v", err)
 	}
+	defer searcher.Close()
 
-	srv := &sourcebackend.Server{
-		Index:              ix,
-		UnpackedPath:       unpacked,
-		IndexPath:          idx,
-		UsePositionalIndex: pos,
+	if explain {
+		for _, srv := range searcher.Shards {
+			if len(searcher.Shards) > 1 {
+				fmt.Printf("shard %q:\n", srv.IndexPath)
+			}
+			if err := explainQuery(os.Stdout, srv.Index, query, pos, regexp.Options{
+				FoldCase:  caseInsensitive,
+				WholeWord: wholeWord,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	conn, cleanup := rpctest.Loopback(func(s *grpc.Server) {
-		sourcebackendpb.RegisterSourceBackendServer(s, srv)
-	})
-	defer cleanup()
-	cl := sourcebackendpb.NewSourceBackendClient(conn)
-	stream, err := cl.Search(context.Background(), &sourcebackendpb.SearchRequest{
-		Query:        query,
-		RewrittenUrl: "",
+	resultMode := sourcebackendpb.SearchRequest_MATCHES
+	if filesOnly {
+		resultMode = sourcebackendpb.SearchRequest_FILES_ONLY
+	} else if count {
+		resultMode = sourcebackendpb.SearchRequest_COUNT_ONLY
+	}
+
+	return searcher.Search(context.Background(), &sourcebackendpb.SearchRequest{
+		Query:           query,
+		RewrittenUrl:    "",
+		MaxResults:      uint32(maxResults),
+		TimeoutMs:       uint32(timeout / time.Millisecond),
+		CaseInsensitive: caseInsensitive,
+		WholeWord:       wholeWord,
+		ContextLines:    &wrappers.UInt32Value{}, // only path and line are printed
+		AllMatches:      allMatches,
+		ResultMode:      resultMode,
+	}, func(shard int, msg *sourcebackendpb.SearchReply) error {
+		unpacked := searcher.Shards[shard].UnpackedPath
+		switch msg.Type {
+		case sourcebackendpb.SearchReply_PROGRESS_UPDATE:
+			if msg.ProgressUpdate.Truncated {
+				fmt.Fprintf(os.Stderr, "search stopped early, results are truncated\n")
+			}
+		case sourcebackendpb.SearchReply_FILE_SUMMARY:
+			if filesOnly {
+				fmt.Printf("%s\n", unpacked+msg.FileSummary.Path)
+			} else {
+				fmt.Printf("%s:%d\n", unpacked+msg.FileSummary.Path, msg.FileSummary.Matches)
+			}
+		case sourcebackendpb.SearchReply_MATCH:
+			fmt.Printf("%s:%d\n", unpacked+msg.Match.Path, msg.Match.Line)
+		}
+		return nil
 	})
+}
+
+// explainQuery prints the positional plan (see index.PlanPositional) or the
+// evaluation of the trigram query (see index.ExplainPostingQuery) which the
+// source backend uses for query, for each segment of ix.
+func explainQuery(w io.Writer, ix *index.SegmentedIndex, query string, pos bool, opts regexp.Options) error {
+	re, err := regexp.CompileOptions(query, opts)
 	if err != nil {
 		return err
 	}
-	for {
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			return nil
+	simplified := re.Syntax.Simplify()
+	pattern := index.NewPositionalPattern(re.Syntax)
+	q := index.RegexpQuery(re.Syntax)
+	for _, seg := range ix.Segments {
+		if len(ix.Segments) > 1 {
+			fmt.Fprintf(w, "segment %q:\n", seg.Name)
 		}
-		if err != nil {
-			return fmt.Errorf("decoding result stream: %v", err)
+		if pos && simplified.Op == syntax.OpLiteral && simplified.Flags&syntax.FoldCase == 0 {
+			plan, err := seg.PlanPositional(string(simplified.Rune))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "positional literal\n%v", plan)
+			continue
 		}
-		if msg.Type != sourcebackendpb.SearchReply_MATCH {
+		if pos && pattern != nil {
+			fmt.Fprintf(w, "positional pattern, gaps %v\n", pattern.Gaps)
+			for _, literal := range pattern.Literals {
+				plan, err := seg.PlanPositional(literal)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%v", plan)
+			}
 			continue
 		}
-		fmt.Printf("%s:%d\n", unpacked+msg.Match.Path, msg.Match.Line)
+		_, ex := seg.ExplainPostingQuery(q)
+		fmt.Fprintf(w, "trigram query %v\n%v", q, ex)
 	}
 	return nil
 }
@@ -0,0 +1,196 @@
+package index
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"github.com/google/renameio"
+)
+
+// deletedFile is a bitmap of deleted docids (bit docid%8 of byte docid/8),
+// stored alongside docid.map. The file may be shorter than the docid map:
+// missing bytes mean that the corresponding documents were not deleted.
+//
+// The docids of the remaining documents do not change until the index is
+// merged with ConcatN or Merge, which drop deleted documents.
+const deletedFile = "docid.deleted"
+
+// A deletedSet is the content of a deletedFile.
+type deletedSet []byte
+
+// readDeleted returns the deletedSet of the index in dir, or nil if no
+// documents were deleted.
+func readDeleted(dir string) (deletedSet, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, deletedFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return deletedSet(b), nil
+}
+
+func (d deletedSet) contains(docid uint32) bool {
+	idx := docid / 8
+	return int(idx) < len(d) && d[idx]&(1<<(docid%8)) != 0
+}
+
+func (d deletedSet) count() int {
+	var n int
+	for _, b := range d {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// Deleted reports whether docid was deleted (see Delete).
+func (i *Index) Deleted(docid uint32) bool {
+	return i.deleted.contains(docid)
+}
+
+// live removes deleted docids from docids, re-using its storage.
+func (i *Index) live(docids []uint32) []uint32 {
+	if i.deleted == nil {
+		return docids
+	}
+	result := docids[:0]
+	for _, docid := range docids {
+		if !i.deleted.contains(docid) {
+			result = append(result, docid)
+		}
+	}
+	return result
+}
+
+// liveMatches removes matches in deleted documents from matches, re-using its
+// storage.
+func (i *Index) liveMatches(matches []Match) []Match {
+	if i.deleted == nil {
+		return matches
+	}
+	result := matches[:0]
+	for _, m := range matches {
+		if !i.deleted.contains(m.Docid) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Delete marks the documents of the (segmented, see OpenSegmented) index in
+// dir for which del returns true as deleted, and returns how many documents
+// were newly deleted. Indexes opened before Delete do not see the deletions.
+//
+// Delete must not be called concurrently with AppendSegment or
+// CompactSegments for the same dir.
+func Delete(dir string, del func(filename string) bool) (int, error) {
+	names, err := ReadSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docid.map")); err == nil {
+		names = append([]string{""}, names...)
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	var deleted int
+	for _, name := range names {
+		n, err := deleteDocuments(filepath.Join(dir, name), del)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+func deleteDocuments(dir string, del func(filename string) bool) (int, error) {
+	deleted, n, err := withDeleted(dir, del)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := renameio.WriteFile(filepath.Join(dir, deletedFile), deleted, 0644); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// withDeleted returns the deletedSet of the index in dir with the documents
+// for which del returns true added, and how many documents were added.
+func withDeleted(dir string, del func(filename string) bool) (deletedSet, int, error) {
+	dr, err := newDocidReader(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dr.Close()
+	old, err := readDeleted(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	deleted := make(deletedSet, (dr.Count+7)/8)
+	copy(deleted, old)
+	var n int
+	scanner := bufio.NewScanner(dr.All())
+	for docid := uint32(0); scanner.Scan(); docid++ {
+		if deleted.contains(docid) || !del(scanner.Text()) {
+			continue
+		}
+		deleted[docid/8] |= 1 << (docid % 8)
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return deleted, n, nil
+}
+
+// A positionFilter tells for each position of a trigram's posting list
+// whether it belongs to a deleted document.
+type positionFilter struct {
+	docids  []uint32 // documents containing the trigram
+	posrel  []byte
+	deleted deletedSet
+
+	i      int // index of the next position
+	docidx int // index into docids of the current position’s document
+}
+
+// newPositionFilter returns a positionFilter for trigram t, whose posrel
+// section data starts at posrel, in the index whose docid section is rd.
+func newPositionFilter(rd *PForReader, posrel []byte, t Trigram, deleted deletedSet) (*positionFilter, error) {
+	meta, err := rd.metaEntry1(t)
+	if err != nil {
+		return nil, err
+	}
+	docids := make([]uint32, 0, meta.Entries)
+	var prev uint32
+	dr := NewDeltaReader()
+	dr.Reset(meta, rd.data.Data)
+	for deltas := dr.Read(); deltas != nil; deltas = dr.Read() {
+		for _, d := range deltas {
+			prev += d
+			docids = append(docids, prev)
+		}
+	}
+	return &positionFilter{
+		docids:  docids,
+		posrel:  posrel,
+		deleted: deleted,
+		docidx:  -1,
+	}, nil
+}
+
+// next returns whether the next position should be kept, and its posrel bit.
+func (pf *positionFilter) next() (keep bool, bit byte) {
+	bit = (pf.posrel[pf.i/8] >> (uint(pf.i) % 8)) & 1
+	pf.docidx += int(bit)
+	pf.i++
+	return !pf.deleted.contains(pf.docids[pf.docidx]), bit
+}
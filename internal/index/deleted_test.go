@@ -0,0 +1,95 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shard := filepath.Join(dir, "shard")
+	writeIndex(t, shard, "base", []string{"foobar\n", "foobar foobar\n", "nothing\n", "x = foobar\n"})
+	writeIndex(t, filepath.Join(dir, "a"), "a", []string{"foobar\n", "nothing\n"})
+	if _, err := AppendSegment(shard, []string{filepath.Join(dir, "a")}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Delete(shard, func(fn string) bool {
+		return fn == "base1" || strings.HasPrefix(fn, "a")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 3; got != want {
+		t.Errorf("Delete() = %d, want %d", got, want)
+	}
+
+	re, err := syntax.Parse("foobar", syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := RegexpQuery(re)
+	want := []string{"base0", "base3"}
+	wantPos := []uint32{0, 4}
+
+	check := func(si *SegmentedIndex) {
+		t.Helper()
+		if got := segmentedFilenames(t, si, si.PostingQuery(q)); !reflect.DeepEqual(got, want) {
+			t.Errorf("PostingQuery(%v) = %v, want %v", q, got, want)
+		}
+		matches, err := si.QueryPositional("foobar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var docids, pos []uint32
+		for _, m := range matches {
+			docids = append(docids, m.Docid)
+			pos = append(pos, m.Position)
+		}
+		if got := segmentedFilenames(t, si, docids); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryPositional(foobar) files = %v, want %v", got, want)
+		}
+		if !reflect.DeepEqual(pos, wantPos) {
+			t.Errorf("QueryPositional(foobar) positions = %v, want %v", pos, wantPos)
+		}
+	}
+
+	si, err := OpenSegmented(shard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer si.Close()
+	check(si)
+
+	// Merging drops the deleted documents.
+	merged := filepath.Join(dir, "merged")
+	if err := os.Mkdir(merged, 0755); err != nil {
+		t.Fatal(err)
+	}
+	srcdirs := []string{shard}
+	for _, seg := range si.Segments[1:] {
+		srcdirs = append(srcdirs, filepath.Join(shard, seg.Name))
+	}
+	if err := ConcatN(merged, srcdirs); err != nil {
+		t.Fatal(err)
+	}
+	mi, err := OpenSegmented(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mi.Close()
+	if got, want := mi.Count(), 3; got != want {
+		t.Errorf("after ConcatN: Count() = %d, want %d", got, want)
+	}
+	check(mi)
+}
@@ -0,0 +1,98 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A TrigramExplanation describes how a trigram of a Query was evaluated.
+type TrigramExplanation struct {
+	Trigram Trigram
+	Entries uint32 // length of the posting list, see MetaEntry.Entries
+
+	// Docids is the number of candidate docids after the posting list of
+	// the trigram was combined with those of the preceding trigrams, or -1
+	// if the posting list was not read.
+	Docids int
+}
+
+func (te TrigramExplanation) String() string {
+	s := fmt.Sprintf("%q (%d entries)",
+		[]byte{byte(te.Trigram >> 16), byte(te.Trigram >> 8), byte(te.Trigram)},
+		te.Entries)
+	if te.Docids == -1 {
+		return s + " skipped"
+	}
+	return fmt.Sprintf("%s → %d docids", s, te.Docids)
+}
+
+// A QueryExplanation describes how PostingQuery evaluated a Query.
+type QueryExplanation struct {
+	Op QueryOp
+
+	// Trigrams are in the order in which they were evaluated: the trigrams
+	// of a QAnd query are intersected in ascending order of their posting
+	// list length.
+	Trigrams []TrigramExplanation
+
+	// StoppedAt is the index into Trigrams of the trigram after which
+	// PostingQuery stopped intersecting because the number of candidates
+	// did not decrease significantly anymore, or -1.
+	StoppedAt int
+
+	Sub []*QueryExplanation
+
+	// Docids is the number of candidate docids of the query.
+	Docids int
+}
+
+// sub appends an explanation for a sub query of e and returns it. If e is
+// nil, sub returns nil.
+func (e *QueryExplanation) sub() *QueryExplanation {
+	if e == nil {
+		return nil
+	}
+	sub := &QueryExplanation{}
+	e.Sub = append(e.Sub, sub)
+	return sub
+}
+
+func (e *QueryExplanation) String() string {
+	var b strings.Builder
+	e.write(&b, "")
+	return b.String()
+}
+
+func (e *QueryExplanation) write(w io.Writer, indent string) {
+	var op string
+	switch e.Op {
+	case QAll:
+		op = "all"
+	case QNone:
+		op = "none"
+	case QAnd:
+		op = "and"
+	case QOr:
+		op = "or"
+	}
+	fmt.Fprintf(w, "%s%s: %d docids\n", indent, op, e.Docids)
+	for idx, te := range e.Trigrams {
+		fmt.Fprintf(w, "%s  trigram %v\n", indent, te)
+		if idx == e.StoppedAt {
+			fmt.Fprintf(w, "%s  stopped early: fewer than 10 candidates removed, remaining trigrams skipped\n", indent)
+		}
+	}
+	for _, sub := range e.Sub {
+		sub.write(w, indent+"  ")
+	}
+}
+
+// ExplainPostingQuery is like PostingQuery, but additionally returns how q
+// was evaluated. The docid counts of the explanation include deleted
+// documents.
+func (i *Index) ExplainPostingQuery(q *Query) (docids []uint32, ex *QueryExplanation) {
+	ex = &QueryExplanation{}
+	docids = i.live(i.postingQuery(q, nil, ex))
+	return docids, ex
+}
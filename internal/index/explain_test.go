@@ -0,0 +1,57 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp/syntax"
+	"testing"
+)
+
+func TestExplainPostingQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"foobar\n",
+		"foo bar\n",
+		"barfoo\n",
+	}
+	ix := createIndex(t, dir, files)
+	defer ix.Close()
+
+	re, err := syntax.Parse("foobar", syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := RegexpQuery(re)
+	docids, ex := ix.ExplainPostingQuery(q)
+	if want := ix.PostingQuery(q); !reflect.DeepEqual(docids, want) {
+		t.Errorf("ExplainPostingQuery(%v) = %v, want %v", q, docids, want)
+	}
+	if ex.Op != QAnd {
+		t.Fatalf("ExplainPostingQuery(%v): Op = %v, want %v", q, ex.Op, QAnd)
+	}
+	if got, want := ex.Docids, len(docids); got != want {
+		t.Errorf("ExplainPostingQuery(%v): Docids = %d, want %d", q, got, want)
+	}
+	if got, want := len(ex.Trigrams), 4; got != want {
+		t.Fatalf("ExplainPostingQuery(%v): %d trigrams, want %d", q, got, want)
+	}
+	// “oob” and “oba” only occur in the first file, so the intersection
+	// stops after the second trigram, skipping “foo” and “bar”.
+	if got, want := ex.Trigrams[0].Entries, uint32(1); got != want {
+		t.Errorf("ExplainPostingQuery(%v): Trigrams[0].Entries = %d, want %d", q, got, want)
+	}
+	if got, want := ex.StoppedAt, 1; got != want {
+		t.Errorf("ExplainPostingQuery(%v): StoppedAt = %d, want %d (explanation: %v)", q, got, want, ex)
+	}
+	for _, te := range ex.Trigrams[2:] {
+		if te.Docids != -1 {
+			t.Errorf("ExplainPostingQuery(%v): trigram %v not skipped", q, te)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Debian/dcs/internal/mmap"
+)
+
+// The legacy index format is the single-file format of
+// github.com/google/codesearch, which DCS used before switching to this
+// package. Only its list of names is read, so that legacy indexes can be
+// converted by re-indexing the files they cover.
+//
+// A legacy index ends with a trailer of the form:
+//
+//	offset of path list [4]
+//	offset of name list [4]
+//	offset of posting lists [4]
+//	offset of name index [4]
+//	offset of posting list index [4]
+//	"\ncsearch trailr\n"
+//
+// The name list is a sorted sequence of NUL-terminated file names (file #0
+// first), which ends with an empty name. All offsets are big-endian.
+const (
+	legacyMagic        = "csearch index 1\n"
+	legacyTrailerMagic = "\ncsearch trailr\n"
+)
+
+// LegacyNames returns the names of all files in the legacy (codesearch
+// format) index file, in fileid order.
+func LegacyNames(file string) ([]string, error) {
+	f, err := mmap.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := f.Data
+	if !bytes.HasPrefix(d, []byte(legacyMagic)) ||
+		len(d) < len(legacyMagic)+5*4+len(legacyTrailerMagic) ||
+		!bytes.HasSuffix(d, []byte(legacyTrailerMagic)) {
+		return nil, fmt.Errorf("%s: not a legacy index", file)
+	}
+	trailer := d[len(d)-len(legacyTrailerMagic)-5*4:]
+	nameData := binary.BigEndian.Uint32(trailer[4:])
+	postData := binary.BigEndian.Uint32(trailer[8:])
+	if nameData > postData || int64(postData) > int64(len(d)) {
+		return nil, fmt.Errorf("%s: corrupt trailer", file)
+	}
+	var names []string
+	for list := d[nameData:postData]; ; {
+		idx := bytes.IndexByte(list, 0)
+		if idx == -1 {
+			return nil, fmt.Errorf("%s: unterminated name list", file)
+		}
+		if idx == 0 {
+			break // end of list
+		}
+		names = append(names, string(list[:idx]))
+		list = list[idx+1:]
+	}
+	return names, nil
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLegacyNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A legacy index without posting lists.
+	b := []byte(legacyMagic)
+	pathData := len(b)
+	b = append(b, "src\x00\x00"...)
+	nameData := len(b)
+	b = append(b, "src/i3_4.16/i3.c\x00src/zsh_5.7/zsh.c\x00\x00"...)
+	postData := len(b)
+	b = append(b, "\xff\xff\xff\x00"...)
+	nameIndex := len(b)
+	b = append(b, make([]byte, 3*4)...)
+	postIndex := len(b)
+	for _, off := range []int{pathData, nameData, postData, nameIndex, postIndex} {
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(off))
+		b = append(b, buf[:]...)
+	}
+	b = append(b, legacyTrailerMagic...)
+	fn := filepath.Join(dir, "full.idx")
+	if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := LegacyNames(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"src/i3_4.16/i3.c", "src/zsh_5.7/zsh.c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("LegacyNames() = %v, want %v", names, want)
+	}
+
+	if err := ioutil.WriteFile(fn, b[:len(b)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LegacyNames(fn); err == nil {
+		t.Errorf("LegacyNames(truncated index) = nil, want error")
+	}
+}
@@ -0,0 +1,151 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/renameio"
+)
+
+// FormatVersion is the version of the on-disk index format written by this
+// package. Open refuses to open indexes of newer versions.
+//
+// Version 2 added the trigrams of the last 2 bytes of each file, padded with
+// NUL bytes. Indexes of version 1 (or without a manifest) cannot locate
+// queries of fewer than 3 bytes exactly, see Index.PlanPositional.
+const FormatVersion = 2
+
+// minFormatVersion is the oldest index format version which Open supports.
+const minFormatVersion = 1
+
+// manifestFile lists the format version, sizes and checksums of the index
+// files. It is written after all index files are complete, so an index
+// without a manifest is either incomplete or was created before manifests
+// were introduced.
+const manifestFile = "manifest.json"
+
+// indexFiles are the files covered by the manifest. docid.deleted is not
+// included, as it is modified after the index is created.
+var indexFiles = []string{
+	"docid.map",
+	"posting.docid.meta",
+	"posting.docid.turbopfor",
+	"posting.pos.meta",
+	"posting.pos.turbopfor",
+	"posting.posrel.meta",
+	"posting.posrel.data",
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type manifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	CRC32C uint32 `json:"crc32c"`
+}
+
+type manifest struct {
+	Version int             `json:"version"`
+	Files   []manifestEntry `json:"files"`
+}
+
+// writeManifest checksums the index files in dir and writes the manifest,
+// declaring the specified format version.
+func writeManifest(dir string, version int) error {
+	m := manifest{Version: version}
+	for _, name := range indexFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		h := crc32.New(castagnoli)
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, manifestEntry{
+			Name:   name,
+			Size:   n,
+			CRC32C: h.Sum32(),
+		})
+	}
+	b, err := json.MarshalIndent(&m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(filepath.Join(dir, manifestFile), append(b, '\n'), 0644)
+}
+
+// readManifest returns the manifest of the index in dir, or nil if the index
+// has none.
+func readManifest(dir string) (*manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", manifestFile, err)
+	}
+	if m.Version < minFormatVersion || m.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported index format version %d (want %d to %d)", m.Version, minFormatVersion, FormatVersion)
+	}
+	return &m, nil
+}
+
+// formatVersion returns the format version of the index in dir. Indexes
+// without a manifest are treated as version 1.
+func formatVersion(dir string) (int, error) {
+	m, err := readManifest(dir)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return 1, nil
+	}
+	return m.Version, nil
+}
+
+// check returns an error unless the files in contents (index file name to
+// file contents) have the sizes listed in the manifest. Reading every byte to
+// compare checksums is left to checkChecksums, as Open would otherwise read
+// the entire index.
+func (m *manifest) check(contents map[string][]byte) error {
+	listed := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		b, ok := contents[f.Name]
+		if !ok {
+			return fmt.Errorf("%s: unknown index file", f.Name)
+		}
+		listed[f.Name] = true
+		if got := int64(len(b)); got != f.Size {
+			return fmt.Errorf("%s: size is %d bytes, manifest says %d bytes", f.Name, got, f.Size)
+		}
+	}
+	for _, name := range indexFiles {
+		if !listed[name] {
+			return fmt.Errorf("%s: missing from manifest", name)
+		}
+	}
+	return nil
+}
+
+// checkChecksums returns an error unless the files in contents have the
+// checksums listed in the manifest. check must have succeeded before.
+func (m *manifest) checkChecksums(contents map[string][]byte) error {
+	for _, f := range m.Files {
+		if got := crc32.Checksum(contents[f.Name], castagnoli); got != f.CRC32C {
+			return fmt.Errorf("%s: checksum is %08x, manifest says %08x", f.Name, got, f.CRC32C)
+		}
+	}
+	return nil
+}
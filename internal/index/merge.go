@@ -19,6 +19,11 @@ type fileMetaEntry struct {
 type indexMeta struct {
 	docidBase uint32
 	rd        *PForReader
+
+	// deleted is non-nil if documents were deleted from the index, in which
+	// case remap maps its docids to docids relative to docidBase.
+	deleted deletedSet
+	remap   []uint32
 }
 
 type posrelMetaEntry struct {
@@ -80,7 +85,54 @@ func readPosrelMeta(dir string, idx map[Trigram][]posrelMetaEntry, idxid uint32)
 	return nil
 }
 
+// ConcatN merges the indexes in srcdirs into a new index in destdir. The
+// docids of srcdirs[1] follow those of srcdirs[0] and so on. Deleted
+// documents (see Delete) are dropped.
 func ConcatN(destdir string, srcdirs []string) error {
+	deleted := make([]deletedSet, len(srcdirs))
+	for idx, dir := range srcdirs {
+		var err error
+		if deleted[idx], err = readDeleted(dir); err != nil {
+			return err
+		}
+	}
+	return concatN(destdir, srcdirs, deleted)
+}
+
+// Merge merges the indexes in src1 and src2 into a new index in destdir, like
+// ConcatN. If both indexes contain a document with the same filename, src2 is
+// assumed to be newer and is given preference: the document of src1 is
+// dropped.
+func Merge(destdir, src1, src2 string) error {
+	ix2, err := Open(src2)
+	if err != nil {
+		return err
+	}
+	paths, err := ix2.Paths()
+	ix2.Close()
+	if err != nil {
+		return err
+	}
+	replaced := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		replaced[path] = true
+	}
+	deleted1, _, err := withDeleted(src1, func(filename string) bool {
+		return replaced[filename]
+	})
+	if err != nil {
+		return err
+	}
+	deleted2, err := readDeleted(src2)
+	if err != nil {
+		return err
+	}
+	return concatN(destdir, []string{src1, src2}, []deletedSet{deleted1, deleted2})
+}
+
+// concatN implements ConcatN, dropping the documents in deleted[idx] from
+// srcdirs[idx].
+func concatN(destdir string, srcdirs []string, deleted []deletedSet) error {
 	fDocidMap, err := os.Create(filepath.Join(destdir, "docid.map"))
 	if err != nil {
 		return err
@@ -94,6 +146,7 @@ func ConcatN(destdir string, srcdirs []string) error {
 	)
 	bufr := bufio.NewReader(nil)
 	bases := make([]uint32, len(srcdirs))
+	remaps := make([][]uint32, len(srcdirs))
 	for idx, dir := range srcdirs {
 		bases[idx] = base
 		f, err := os.Open(filepath.Join(dir, "docid.map"))
@@ -116,8 +169,12 @@ func ConcatN(destdir string, srcdirs []string) error {
 
 		// TODO: detect |base| overflows
 		n := (uint32(st.Size()) - indexOffset - 4) / 4
-		log.Printf("%s (idx %d) contains %d docids", dir, idx, n)
-		base += n
+		if deleted[idx] == nil {
+			log.Printf("%s (idx %d) contains %d docids", dir, idx, n)
+		} else {
+			log.Printf("%s (idx %d) contains %d docids, dropping %d deleted docids", dir, idx, n, deleted[idx].count())
+			remaps[idx] = make([]uint32, n)
+		}
 
 		if _, err := f.Seek(0, io.SeekStart); err != nil {
 			return err
@@ -128,7 +185,14 @@ func ConcatN(destdir string, srcdirs []string) error {
 		scanner := bufio.NewScanner(&io.LimitedReader{
 			R: bufr,
 			N: int64(indexOffset)})
-		for scanner.Scan() {
+		for docid := uint32(0); scanner.Scan(); docid++ {
+			if deleted[idx].contains(docid) {
+				continue
+			}
+			if remaps[idx] != nil {
+				remaps[idx][docid] = base - bases[idx]
+			}
+			base++
 			offsets = append(offsets, uint32(cw.offset))
 			cw.Write(scanner.Bytes())
 			cw.Write([]byte{'\n'})
@@ -165,7 +229,12 @@ func ConcatN(destdir string, srcdirs []string) error {
 				return err
 			}
 			defer rd.Close()
-			idxMetaDocid[idx] = indexMeta{docidBase: base, rd: rd}
+			idxMetaDocid[idx] = indexMeta{
+				docidBase: base,
+				rd:        rd,
+				deleted:   deleted[idx],
+				remap:     remaps[idx],
+			}
 		}
 
 		if err := readMeta(dir, "docid", idxDocid, uint32(idx)); err != nil {
@@ -198,6 +267,10 @@ func ConcatN(destdir string, srcdirs []string) error {
 	}
 	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
 
+	// Trigrams which only occur in deleted documents are dropped from all
+	// sections.
+	dropped := make(map[Trigram]bool)
+
 	{
 		log.Printf("writing merged docids")
 		dw, err := newPForWriter(destdir, "docid")
@@ -233,8 +306,26 @@ func ConcatN(destdir string, srcdirs []string) error {
 					}
 					return err
 				}
-				me.Entries += meta.Entries
 				dr.Reset(meta, idx.rd.data.Data)
+				if idx.deleted != nil {
+					var prev uint32
+					for docids := dr.Read(); docids != nil; docids = dr.Read() {
+						for _, d := range docids {
+							prev += d
+							if idx.deleted.contains(prev) {
+								continue
+							}
+							docid := idx.docidBase + idx.remap[prev]
+							if err := dw.PutUint32(docid - last); err != nil {
+								return err
+							}
+							last = docid
+							me.Entries++
+						}
+					}
+					continue
+				}
+				me.Entries += meta.Entries
 				docids := dr.Read() // returns non-nil at least once
 				// Bump the first docid: it needs to be mapped from the old
 				// docid range [0, n) to the new docid range [base, base+n).
@@ -255,6 +346,10 @@ func ConcatN(destdir string, srcdirs []string) error {
 			if err := dw.Flush(); err != nil {
 				return err
 			}
+			if me.Entries == 0 {
+				dropped[t] = true
+				continue
+			}
 			me.Marshal(meBuf)
 			if _, err := bufwDocidMeta.Write(meBuf); err != nil {
 				//if err := binary.Write(bufwDocidMeta, binary.LittleEndian, &me); err != nil {
@@ -295,6 +390,9 @@ func ConcatN(destdir string, srcdirs []string) error {
 			if t == 2105376 { // TODO: document: "   "?
 				continue
 			}
+			if dropped[t] {
+				continue
+			}
 
 			me := MetaEntry{
 				Trigram:    t,
@@ -321,6 +419,20 @@ func ConcatN(destdir string, srcdirs []string) error {
 					return err
 				}
 				b := idxMetaPosrel[idxid].rd.data.Data[pmeta.OffsetData:]
+				if d := idxMetaDocid[idxid]; d.deleted != nil {
+					pf, err := newPositionFilter(d.rd, b, t, d.deleted)
+					if err != nil {
+						return err
+					}
+					for i := 0; i < int(fmeta.Entries); i++ {
+						if keep, bit := pf.next(); keep {
+							if err := pw.WriteByte(bit, 1); err != nil {
+								return err
+							}
+						}
+					}
+					continue
+				}
 				if err := pw.Write(b, int(fmeta.Entries)); err != nil {
 					return err
 				}
@@ -362,6 +474,9 @@ func ConcatN(destdir string, srcdirs []string) error {
 			if t == 2105376 { // TODO: document: "   "?
 				continue
 			}
+			if dropped[t] {
+				continue
+			}
 
 			//ctrl, data := dw.Offsets()
 			me := MetaEntry{
@@ -380,8 +495,30 @@ func ConcatN(destdir string, srcdirs []string) error {
 					}
 					return err
 				}
-				me.Entries += meta.Entries
 				dr.Reset(meta, idx.rd.data.Data)
+				if d := idxMetaDocid[idxid]; d.deleted != nil {
+					pmeta, err := idxMetaPosrel[idxid].rd.metaEntry1(t)
+					if err != nil {
+						return err
+					}
+					pf, err := newPositionFilter(d.rd, idxMetaPosrel[idxid].rd.data.Data[pmeta.OffsetData:], t, d.deleted)
+					if err != nil {
+						return err
+					}
+					for pos := dr.Read(); pos != nil; pos = dr.Read() {
+						for _, p := range pos {
+							if keep, _ := pf.next(); !keep {
+								continue
+							}
+							if err := dw.PutUint32(p); err != nil {
+								return err
+							}
+							me.Entries++
+						}
+					}
+					continue
+				}
+				me.Entries += meta.Entries
 
 				for docids := dr.Read(); docids != nil; docids = dr.Read() {
 					for _, d := range docids {
@@ -416,5 +553,17 @@ func ConcatN(destdir string, srcdirs []string) error {
 		}
 	}
 
-	return nil
+	// The merged index only has the properties of the oldest format version
+	// of srcdirs.
+	version := FormatVersion
+	for _, dir := range srcdirs {
+		v, err := formatVersion(dir)
+		if err != nil {
+			return err
+		}
+		if v < version {
+			version = v
+		}
+	}
+	return writeManifest(destdir, version)
 }
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src1 := filepath.Join(dir, "src1")
+	writeIndex(t, src1, "doc", []string{"foobar\n", "nothing\n", "x = foobar\n"})
+	if _, err := Delete(src1, func(fn string) bool { return fn == "doc1" }); err != nil {
+		t.Fatal(err)
+	}
+	// doc0 was changed, doc1 was re-added.
+	src2 := filepath.Join(dir, "src2")
+	writeIndex(t, src2, "doc", []string{"changed\n", "new foobar\n"})
+
+	merged := filepath.Join(dir, "merged")
+	if err := os.Mkdir(merged, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(merged, src1, src2); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	paths, err := ix.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"doc2", "doc0", "doc1"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Paths() = %v, want %v", paths, want)
+	}
+
+	matches, err := ix.QueryPositional("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{
+		{Docid: 0, Position: 4}, // doc2
+		{Docid: 2, Position: 4}, // doc1
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("QueryPositional(foobar) = %v, want %v", matches, want)
+	}
+	if err := ix.Verify(); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+}
+
+func TestPathsDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "idx")
+	writeIndex(t, idxdir, "doc", []string{"foobar\n", "nothing\n", "x = foobar\n"})
+	if _, err := Delete(idxdir, func(fn string) bool { return fn == "doc1" }); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	paths, err := ix.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"doc0", "doc2"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Paths() = %v, want %v", paths, want)
+	}
+}
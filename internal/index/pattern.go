@@ -0,0 +1,257 @@
+package index
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// unbounded is the maximum length of a Gap which is not bounded, e.g. .*
+const unbounded = -1
+
+// A Gap describes how many bytes can separate two literals of a
+// PositionalPattern.
+type Gap struct {
+	Min int
+	Max int // -1 if unbounded
+}
+
+// A PositionalPattern is a sequence of literals joined by gaps, e.g.
+// foo.{0,20}bar or foo\s+bar. Every match of the regexp it was derived from
+// contains the literals in order, separated by the corresponding gaps.
+type PositionalPattern struct {
+	Literals []string
+	Gaps     []Gap // Gaps[i] separates Literals[i] and Literals[i+1]
+}
+
+// minPatternLiteral is the minimum length of literals in a
+// PositionalPattern: shorter literals are treated as gaps, as
+// QueryPositional cannot locate them at the end of a file.
+const minPatternLiteral = 3
+
+// width returns the minimum and maximum number of bytes matched by re, with
+// max being unbounded if there is no limit. ok is false if re cannot match.
+func width(re *syntax.Regexp) (min, max int, ok bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch,
+		syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return 0, 0, true
+
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			// Case folding can change the encoded length of a rune, e.g. k
+			// (1 byte) matches K (KELVIN SIGN, 3 bytes).
+			return len(re.Rune), utf8.UTFMax * len(re.Rune), true
+		}
+		return len(string(re.Rune)), len(string(re.Rune)), true
+
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return 0, 0, false
+		}
+		return 1, utf8.RuneLen(re.Rune[len(re.Rune)-1]), true
+
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1, utf8.UTFMax, true
+
+	case syntax.OpCapture:
+		return width(re.Sub[0])
+
+	case syntax.OpQuest:
+		_, max, ok := width(re.Sub[0])
+		return 0, max, ok
+
+	case syntax.OpStar, syntax.OpPlus:
+		min, _, ok := width(re.Sub[0])
+		if re.Op == syntax.OpStar {
+			min = 0
+		}
+		return min, unbounded, ok
+
+	case syntax.OpRepeat:
+		smin, smax, ok := width(re.Sub[0])
+		if !ok {
+			return 0, 0, false
+		}
+		max := unbounded
+		if re.Max != -1 && smax != unbounded {
+			max = re.Max * smax
+		}
+		return re.Min * smin, max, true
+
+	case syntax.OpConcat:
+		var min, max int
+		for _, sub := range re.Sub {
+			smin, smax, ok := width(sub)
+			if !ok {
+				return 0, 0, false
+			}
+			min += smin
+			if max != unbounded {
+				if smax == unbounded {
+					max = unbounded
+				} else {
+					max += smax
+				}
+			}
+		}
+		return min, max, true
+
+	case syntax.OpAlternate:
+		min, max, ok := width(re.Sub[0])
+		if !ok {
+			return 0, 0, false
+		}
+		for _, sub := range re.Sub[1:] {
+			smin, smax, ok := width(sub)
+			if !ok {
+				return 0, 0, false
+			}
+			if smin < min {
+				min = smin
+			}
+			if max != unbounded && (smax == unbounded || smax > max) {
+				max = smax
+			}
+		}
+		return min, max, true
+	}
+	return 0, 0, false
+}
+
+// patternLiteral returns the literal which re matches if it is suitable for
+// locating via QueryPositional.
+func patternLiteral(re *syntax.Regexp) (string, bool) {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	lit := string(re.Rune)
+	// Runs of spaces are not part of the positional index.
+	if len(lit) < minPatternLiteral || strings.Contains(lit, "   ") {
+		return "", false
+	}
+	return lit, true
+}
+
+// NewPositionalPattern returns the PositionalPattern of re, or nil if re is
+// not made of at least two literals joined by gaps.
+func NewPositionalPattern(re *syntax.Regexp) *PositionalPattern {
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat {
+		return nil
+	}
+	var (
+		p   PositionalPattern
+		gap Gap
+	)
+	for _, sub := range re.Sub {
+		if lit, ok := patternLiteral(sub); ok {
+			if len(p.Literals) > 0 {
+				p.Gaps = append(p.Gaps, gap)
+			}
+			p.Literals = append(p.Literals, lit)
+			gap = Gap{}
+			continue
+		}
+		min, max, ok := width(sub)
+		if !ok {
+			return nil
+		}
+		gap.Min += min
+		if gap.Max != unbounded {
+			if max == unbounded {
+				gap.Max = unbounded
+			} else {
+				gap.Max += max
+			}
+		}
+	}
+	if len(p.Literals) < 2 {
+		return nil
+	}
+	return &p
+}
+
+// QueryPositionalPattern returns the positions of the first literal of p for
+// which all following literals of p occur, separated by their gaps. These
+// positions are candidates only, the regexp p was derived from needs to be
+// verified against the file.
+func (i *Index) QueryPositionalPattern(p *PositionalPattern) ([]Match, error) {
+	// A candidate is an occurrence of the first literal, together with the
+	// range of end positions which the literals matched so far can have.
+	type candidate struct {
+		docid  uint32
+		start  uint32
+		lo, hi int
+	}
+	first, err := i.QueryPositional(p.Literals[0])
+	if err == errNotFound {
+		return nil, nil // a trigram of the literal does not occur at all
+	}
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]candidate, len(first))
+	for idx, m := range first {
+		end := int(m.Position) + len(p.Literals[0])
+		candidates[idx] = candidate{
+			docid: m.Docid,
+			start: m.Position,
+			lo:    end,
+			hi:    end,
+		}
+	}
+
+	for k, lit := range p.Literals[1:] {
+		if len(candidates) == 0 {
+			break
+		}
+		gap := p.Gaps[k]
+		next, err := i.QueryPositional(lit)
+		if err == errNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		filtered := candidates[:0]
+		var docStart, docEnd int // next[docStart:docEnd] belong to the current docid
+		for _, c := range candidates {
+			if docEnd == docStart || next[docStart].Docid != c.docid {
+				for docStart = docEnd; docStart < len(next) && next[docStart].Docid < c.docid; docStart++ {
+				}
+				for docEnd = docStart; docEnd < len(next) && next[docEnd].Docid == c.docid; docEnd++ {
+				}
+			}
+			positions := next[docStart:docEnd]
+			lo := sort.Search(len(positions), func(j int) bool {
+				return int(positions[j].Position) >= c.lo+gap.Min
+			})
+			hi := len(positions)
+			if gap.Max != unbounded {
+				hi = sort.Search(len(positions), func(j int) bool {
+					return int(positions[j].Position) > c.hi+gap.Max
+				})
+			}
+			if lo >= hi {
+				continue
+			}
+			c.lo = int(positions[lo].Position) + len(lit)
+			c.hi = int(positions[hi-1].Position) + len(lit)
+			filtered = append(filtered, c)
+		}
+		candidates = filtered
+	}
+
+	entries := make([]Match, len(candidates))
+	for idx, c := range candidates {
+		entries[idx] = Match{Docid: c.docid, Position: c.start}
+	}
+	return entries, nil
+}
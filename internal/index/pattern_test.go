@@ -0,0 +1,97 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp/syntax"
+	"testing"
+)
+
+func TestNewPositionalPattern(t *testing.T) {
+	for _, tt := range []struct {
+		expr string
+		want *PositionalPattern
+	}{
+		{`foo.{0,20}bar`, &PositionalPattern{
+			Literals: []string{"foo", "bar"},
+			Gaps:     []Gap{{0, 80}},
+		}},
+		{`foo\s+bar`, &PositionalPattern{
+			Literals: []string{"foo", "bar"},
+			Gaps:     []Gap{{1, unbounded}},
+		}},
+		{`^func (\w+)\(ctx context\.Context`, &PositionalPattern{
+			Literals: []string{"func ", "(ctx context.Context"},
+			Gaps:     []Gap{{1, unbounded}},
+		}},
+		{`open\(.*, O_RDONLY\)`, &PositionalPattern{
+			Literals: []string{"open(", ", O_RDONLY)"},
+			Gaps:     []Gap{{0, unbounded}},
+		}},
+		// Short literals become part of the gap.
+		{`foo[0-9]=[0-9]bar`, &PositionalPattern{
+			Literals: []string{"foo", "bar"},
+			Gaps:     []Gap{{3, 3}},
+		}},
+
+		// A single literal (or none at all) is not a pattern.
+		{`foo`, nil},
+		{`foo\s+`, nil},
+		{`foo.*ba`, nil},
+		{`(?i)foo.*bar`, nil},
+		{`foo|bar`, nil},
+	} {
+		re, err := syntax.Parse(tt.expr, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NewPositionalPattern(re); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewPositionalPattern(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestQueryPositionalPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"foo  bar\n",
+		"foo\nxx bar foo bar\n",
+		"bar foo\n",
+		"foo xyz\nfoo 12345678901234567890 bar\n",
+	}
+	ix := createIndex(t, dir, files)
+	defer ix.Close()
+
+	for _, tt := range []struct {
+		expr string
+		want []Match
+	}{
+		// Gaps only constrain the distance between literals, so candidates
+		// are a superset of the actual matches (e.g. {1, 0} for foo.*bar).
+		{`foo\s+bar`, []Match{{0, 0}, {1, 0}, {1, 11}, {3, 0}, {3, 8}}},
+		{`foo.{0,5}bar`, []Match{{0, 0}, {1, 0}, {1, 11}}},
+		{`foo.*bar`, []Match{{0, 0}, {1, 0}, {1, 11}, {3, 0}, {3, 8}}},
+		{`foo.*baz`, nil},
+	} {
+		re, err := syntax.Parse(tt.expr, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ix.QueryPositionalPattern(NewPositionalPattern(re))
+		if err != nil {
+			t.Fatalf("QueryPositionalPattern(%q): %v", tt.expr, err)
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("QueryPositionalPattern(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Strategies which PlanPositional can choose.
+const (
+	// StrategyPrefix combines the posting lists of all trigrams starting
+	// with a query of fewer than 4 bytes.
+	StrategyPrefix = "prefix"
+
+	// StrategyFirstLast intersects the positions of the first and last
+	// trigram of the query.
+	StrategyFirstLast = "first+last"
+
+	// StrategyRarest intersects the positions of the rarest trigrams of the
+	// query.
+	StrategyRarest = "rarest"
+)
+
+// errNoTailTrigrams is returned for queries of fewer than 3 bytes in indexes
+// which predate the trigrams of the last 2 bytes of each file, as they cannot
+// locate all occurrences.
+var errNoTailTrigrams = errors.New("queries shorter than 3 bytes require an index of format version 2 or newer, please re-create the index")
+
+// plannerTrigrams is the number of trigrams which StrategyRarest intersects.
+const plannerTrigrams = 3
+
+// verifyCost is the estimated cost of verifying a candidate position (which
+// requires reading the file) relative to decoding a posting list entry.
+const verifyCost = 16
+
+// spacesTrigram ("   ") is skipped in the positional index.
+const spacesTrigram = Trigram(0x202020)
+
+// A PlanStep is a trigram whose positions are used to locate a query.
+type PlanStep struct {
+	Offset  int // byte offset of the trigram within the query
+	Trigram Trigram
+	Entries uint32 // number of positions in the posting list
+}
+
+func (ps PlanStep) String() string {
+	return fmt.Sprintf("%q@%d (%d entries)",
+		[]byte{byte(ps.Trigram >> 16), byte(ps.Trigram >> 8), byte(ps.Trigram)},
+		ps.Offset,
+		ps.Entries)
+}
+
+// A Plan describes how QueryPositional locates a query.
+type Plan struct {
+	Query    string
+	Strategy string
+	Steps    []PlanStep
+
+	// Cost is the estimated cost of the plan: the number of posting list
+	// entries to decode, plus verifyCost for each expected candidate.
+	Cost uint64
+
+	// Alternatives are the costs of the strategies which were considered.
+	Alternatives map[string]uint64
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "query %q: strategy %s, cost %d\n", p.Query, p.Strategy, p.Cost)
+	strategies := make([]string, 0, len(p.Alternatives))
+	for strategy := range p.Alternatives {
+		strategies = append(strategies, strategy)
+	}
+	sort.Strings(strategies)
+	for _, strategy := range strategies {
+		fmt.Fprintf(&b, "  considered %s, cost %d\n", strategy, p.Alternatives[strategy])
+	}
+	const maxSteps = 20
+	for idx, step := range p.Steps {
+		if idx == maxSteps {
+			fmt.Fprintf(&b, "  … %d more trigrams\n", len(p.Steps)-maxSteps)
+			break
+		}
+		fmt.Fprintf(&b, "  trigram %v\n", step)
+	}
+	return b.String()
+}
+
+// planCost returns the estimated cost of intersecting steps.
+func planCost(steps []PlanStep) uint64 {
+	var cost uint64
+	candidates := uint64(steps[0].Entries)
+	for _, step := range steps {
+		cost += uint64(step.Entries)
+		if uint64(step.Entries) < candidates {
+			candidates = uint64(step.Entries)
+		}
+	}
+	return cost + verifyCost*candidates
+}
+
+// PlanPositional returns the plan which QueryPositional uses for query.
+//
+// Queries of fewer than 4 bytes use StrategyPrefix (which requires format
+// version 2 for queries of fewer than 3 bytes). For longer queries, the
+// posting list sizes of all trigrams are looked up, and the cheaper of
+// StrategyFirstLast and StrategyRarest is used. Intersecting the first and
+// last trigram yields few false positives, as the whole query is spanned,
+// but the rarest trigrams are much cheaper to decode if the first or last
+// trigram is common (e.g. “int” in “int64_t”).
+func (i *Index) PlanPositional(query string) (*Plan, error) {
+	plan := &Plan{
+		Query:        query,
+		Alternatives: make(map[string]uint64),
+	}
+	if len(query) == 0 {
+		return plan, nil
+	}
+	qb := []byte(query)
+	if len(query) < 3 && !i.tailTrigrams {
+		return nil, errNoTailTrigrams
+	}
+	if len(query) < 4 {
+		plan.Strategy = StrategyPrefix
+		var trigrams []Trigram
+		if len(query) == 3 {
+			trigrams = []Trigram{Trigram(uint32(qb[0])<<16 | uint32(qb[1])<<8 | uint32(qb[2]))}
+		} else {
+			trigrams = i.Pos.trigramsWithPrefix(qb)
+		}
+		for _, t := range trigrams {
+			step := PlanStep{Trigram: t}
+			if meta, err := i.Pos.metaEntry1(t); err == nil {
+				step.Entries = meta.Entries
+			}
+			plan.Steps = append(plan.Steps, step)
+			plan.Cost += uint64(step.Entries)
+		}
+		plan.Alternatives[plan.Strategy] = plan.Cost
+		return plan, nil
+	}
+
+	steps := make([]PlanStep, 0, len(query)-2)
+	for j := 0; j < len(query)-2; j++ {
+		t := Trigram(uint32(qb[j])<<16 |
+			uint32(qb[j+1])<<8 |
+			uint32(qb[j+2]))
+		if t == spacesTrigram {
+			continue // not part of the positional index
+		}
+		step := PlanStep{Offset: j, Trigram: t}
+		meta, err := i.Pos.metaEntry1(t)
+		if err != nil && err != errNotFound {
+			return nil, err
+		}
+		if err == nil {
+			step.Entries = meta.Entries
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, errNotFound
+	}
+
+	var firstLast []PlanStep
+	if first, last := steps[0], steps[len(steps)-1]; first.Offset == 0 && last.Offset == len(query)-3 {
+		firstLast = []PlanStep{first, last}
+		plan.Alternatives[StrategyFirstLast] = planCost(firstLast)
+	}
+
+	rarest := append([]PlanStep(nil), steps...)
+	sort.SliceStable(rarest, func(i, j int) bool { return rarest[i].Entries < rarest[j].Entries })
+	if len(rarest) > plannerTrigrams {
+		rarest = rarest[:plannerTrigrams]
+	}
+	plan.Alternatives[StrategyRarest] = planCost(rarest)
+
+	if firstLast != nil && plan.Alternatives[StrategyFirstLast] <= plan.Alternatives[StrategyRarest] {
+		plan.Strategy = StrategyFirstLast
+		plan.Steps = firstLast
+	} else {
+		plan.Strategy = StrategyRarest
+		plan.Steps = rarest
+	}
+	plan.Cost = plan.Alternatives[plan.Strategy]
+	return plan, nil
+}
+
+// queryPlan returns the positions of plan.Query by executing plan.
+func (i *Index) queryPlan(plan *Plan) ([]Match, error) {
+	for _, step := range plan.Steps {
+		if step.Entries == 0 && plan.Strategy != StrategyPrefix {
+			return nil, nil // the trigram does not occur at all
+		}
+	}
+	switch plan.Strategy {
+	case StrategyPrefix:
+		return i.queryShort(plan.Steps)
+	case StrategyFirstLast:
+		return i.queryFirstLast(plan.Steps[0], plan.Steps[1])
+	case StrategyRarest:
+		return i.queryRarest(plan.Steps)
+	}
+	return nil, nil
+}
+
+// queryRarest intersects the positions of steps (ordered by ascending number
+// of entries), relative to the start of the query.
+func (i *Index) queryRarest(steps []PlanStep) ([]Match, error) {
+	buffers := newBufferPair()
+	var entries []Match
+	for idx, step := range steps {
+		matches, err := i.matchesWithBuffer(step.Trigram, buffers)
+		if err != nil {
+			return nil, err
+		}
+		// Translate trigram positions into query start positions.
+		start := matches[:0]
+		for _, m := range matches {
+			if int(m.Position) < step.Offset {
+				continue
+			}
+			m.Position -= uint32(step.Offset)
+			start = append(start, m)
+		}
+		if idx == 0 {
+			entries = start
+			continue
+		}
+		entries = intersectMatches(entries, start)
+		if len(entries) == 0 {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// intersectMatches returns the matches contained in both a and b, which must
+// be ordered by docid and position. The result is stored in a.
+func intersectMatches(a, b []Match) []Match {
+	result := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].Docid < b[j].Docid ||
+			a[i].Docid == b[j].Docid && a[i].Position < b[j].Position:
+			i++
+		case a[i] == b[j]:
+			result = append(result, a[i])
+			i++
+			j++
+		default:
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIntersectMatches(t *testing.T) {
+	a := []Match{{0, 1}, {0, 5}, {1, 2}, {3, 0}, {3, 7}}
+	b := []Match{{0, 5}, {1, 1}, {1, 2}, {2, 0}, {3, 7}, {4, 0}}
+	want := []Match{{0, 5}, {1, 2}, {3, 7}}
+	if got := intersectMatches(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("intersectMatches() = %v, want %v", got, want)
+	}
+}
+
+func TestPlanPositional(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// “int” and “_t;” are common, “64_” is rare.
+	files := []string{
+		"int a;\nint b;\nint c;\nint d;\n",
+		"uint8_t x;\nuint16_t y;\nint32_t z;\n",
+		"int64_t v;\nint64_t w;\n",
+		"int i;\nint j;\nint k;\nint l;\nint m;\n",
+	}
+	ix := createIndex(t, dir, files)
+	defer ix.Close()
+
+	for _, tt := range []struct {
+		query    string
+		strategy string
+	}{
+		{"in", StrategyPrefix},
+		{"int", StrategyPrefix},
+		{"int6", StrategyFirstLast},
+		{"int64_t", StrategyRarest},
+	} {
+		plan, err := ix.PlanPositional(tt.query)
+		if err != nil {
+			t.Fatalf("PlanPositional(%q): %v", tt.query, err)
+		}
+		if plan.Strategy != tt.strategy {
+			t.Errorf("PlanPositional(%q).Strategy = %q, want %q (plan: %v)", tt.query, plan.Strategy, tt.strategy, plan)
+		}
+	}
+
+	// All strategies must return the same positions.
+	const query = "int64_t"
+	plan, err := ix.PlanPositional(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rarest, err := ix.queryPlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLast, err := ix.queryFirstLast(
+		PlanStep{Offset: 0, Trigram: Trigram('i'<<16 | 'n'<<8 | 't')},
+		PlanStep{Offset: 4, Trigram: Trigram('4'<<16 | '_'<<8 | 't')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Match{{2, 0}, {2, 11}}
+	if !reflect.DeepEqual(rarest, want) {
+		t.Errorf("%s: got %v, want %v", plan.Strategy, rarest, want)
+	}
+	if !reflect.DeepEqual(firstLast, want) {
+		t.Errorf("%s: got %v, want %v", StrategyFirstLast, firstLast, want)
+	}
+}
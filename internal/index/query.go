@@ -5,8 +5,10 @@ import (
 	"sort"
 )
 
+// PostingQuery returns the documents which were not deleted and which
+// contain the trigrams of q.
 func (i *Index) PostingQuery(q *Query) (docids []uint32) {
-	return i.postingQuery(q, nil)
+	return i.live(i.postingQuery(q, nil, nil))
 }
 
 // Implements sort.Interface
@@ -30,7 +32,14 @@ func (t trigramCnts) Swap(i, j int) {
 	t[i], t[j] = t[j], t[i]
 }
 
-func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
+// postingQuery returns the docids matching qry, restricted to restrict if
+// non-nil. If ex is non-nil, it is filled with how qry was evaluated.
+func (ix *Index) postingQuery(qry *Query, restrict []uint32, ex *QueryExplanation) (ret []uint32) {
+	if ex != nil {
+		ex.Op = qry.Op
+		ex.StoppedAt = -1
+		defer func() { ex.Docids = len(ret) }()
+	}
 	var list []uint32
 	switch qry.Op {
 	case QNone:
@@ -63,6 +72,15 @@ func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
 		if len(withCount) > 0 {
 			//q.pfdocid.growBuffer(withCount[len(withCount)-1].count)
 		}
+		if ex != nil {
+			for _, t := range withCount {
+				ex.Trigrams = append(ex.Trigrams, TrigramExplanation{
+					Trigram: Trigram(t.trigram),
+					Entries: uint32(t.count),
+					Docids:  -1,
+				})
+			}
+		}
 
 		stoppedAt := 0
 		for idx, t := range withCount {
@@ -72,6 +90,9 @@ func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
 			} else {
 				list = ix.postingAnd(list, t.trigram, restrict)
 			}
+			if ex != nil {
+				ex.Trigrams[idx].Docids = len(list)
+			}
 			if len(list) == 0 {
 				return nil
 			}
@@ -85,6 +106,9 @@ func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
 			}
 			if previous > 0 && (previous-len(list)) < 10 {
 				//fmt.Printf("difference is %d, break!\n", previous - len(list))
+				if ex != nil {
+					ex.StoppedAt = idx
+				}
 				break
 			}
 		}
@@ -93,7 +117,7 @@ func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
 			if list == nil {
 				list = restrict
 			}
-			list = ix.postingQuery(sub, list)
+			list = ix.postingQuery(sub, list, ex.sub())
 			if len(list) == 0 {
 				return nil
 			}
@@ -106,9 +130,16 @@ func (ix *Index) postingQuery(qry *Query, restrict []uint32) (ret []uint32) {
 			} else {
 				list = ix.postingOr(list, tri, restrict)
 			}
+			if ex != nil {
+				te := TrigramExplanation{Trigram: Trigram(tri), Docids: len(list)}
+				if meta, _, err := ix.Docid.metaEntry(Trigram(tri)); err == nil {
+					te.Entries = meta.Entries
+				}
+				ex.Trigrams = append(ex.Trigrams, te)
+			}
 		}
 		for _, sub := range qry.Sub {
-			list1 := ix.postingQuery(sub, restrict)
+			list1 := ix.postingQuery(sub, restrict, ex.sub())
 			list = mergeOr(list, list1)
 		}
 	}
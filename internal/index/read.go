@@ -32,11 +32,20 @@ type DocidReader struct {
 }
 
 func newDocidReader(dir string) (*DocidReader, error) {
-	f, err := mmap.Open(filepath.Join(dir, "docid.map"))
+	fn := filepath.Join(dir, "docid.map")
+	f, err := mmap.Open(fn)
 	if err != nil {
 		return nil, err
 	}
+	if len(f.Data) < 4 {
+		f.Close()
+		return nil, fmt.Errorf("%s: truncated (%d bytes)", fn, len(f.Data))
+	}
 	indexOffset := binary.LittleEndian.Uint32(f.Data[len(f.Data)-4:])
+	if int64(indexOffset) > int64(len(f.Data)-4) {
+		f.Close()
+		return nil, fmt.Errorf("%s: index offset %d beyond end of file", fn, indexOffset)
+	}
 	return &DocidReader{
 		f:           f,
 		indexOffset: indexOffset,
@@ -168,6 +177,37 @@ func (sr *PForReader) metaEntry1(trigram Trigram) (*MetaEntry, error) {
 	return &result, nil
 }
 
+// trigramsWithPrefix returns all trigrams in the index which start with
+// prefix, which must be 1 or 2 bytes long.
+func (sr *PForReader) trigramsWithPrefix(prefix []byte) []Trigram {
+	var lo, hi Trigram
+	switch len(prefix) {
+	case 1:
+		lo = Trigram(prefix[0]) << 16
+		hi = lo + 1<<16
+	case 2:
+		lo = Trigram(prefix[0])<<16 | Trigram(prefix[1])<<8
+		hi = lo + 1<<8
+	default:
+		return nil
+	}
+	num := len(sr.meta.Data) / metaEntrySize
+	d := sr.meta.Data
+	n := sort.Search(num, func(i int) bool {
+		// MetaEntry.Trigram is the first member
+		return Trigram(binary.LittleEndian.Uint32(d[i*metaEntrySize:])) >= lo
+	})
+	var trigrams []Trigram
+	for ; n < num; n++ {
+		t := Trigram(binary.LittleEndian.Uint32(d[n*metaEntrySize:]))
+		if t >= hi {
+			break
+		}
+		trigrams = append(trigrams, t)
+	}
+	return trigrams
+}
+
 func (sr *PForReader) MetaEntry(trigram Trigram) (*MetaEntry, error) {
 	e, _, err := sr.metaEntry(trigram)
 	return e, err
@@ -333,16 +373,32 @@ type Index struct {
 	Pos      *PForReader   // positions for all trigrams
 	Posrel   *PosrelReader // position relationships for all trigrams
 
+	deleted deletedSet // nil if no documents were deleted
+
+	// tailTrigrams is set if the index contains the trigrams of the last 2
+	// bytes of each file (see FormatVersion).
+	tailTrigrams bool
+
+	// manifest is nil for indexes without a manifest.
+	manifest *manifest
+
 	// buffers for both i.Matches() calls
 	firstBuffer *bufferPair
 	lastBuffer  *bufferPair
 }
 
+// Open opens the index in dir. If the index has a manifest (see
+// FormatVersion), Open verifies the format version and the sizes of the index
+// files. The checksums are only verified by Verify, as computing them requires
+// reading the entire index.
 func Open(dir string) (*Index, error) {
 	var i Index
 	i.firstBuffer = newBufferPair()
 	i.lastBuffer = newBufferPair()
-	var err error
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
 	if i.DocidMap, err = newDocidReader(dir); err != nil {
 		return nil, err
 	}
@@ -359,9 +415,45 @@ func Open(dir string) (*Index, error) {
 		return nil, err
 	}
 
+	if i.deleted, err = readDeleted(dir); err != nil {
+		return nil, err
+	}
+
+	if m != nil {
+		if err := m.check(i.contents()); err != nil {
+			i.Close()
+			return nil, fmt.Errorf("%s: %v", dir, err)
+		}
+		i.manifest = m
+		i.tailTrigrams = m.Version >= 2
+	}
+
 	return &i, nil
 }
 
+// ShortQueries reports whether QueryPositional locates all occurrences of
+// queries shorter than 3 bytes, which requires format version 2.
+func (i *Index) ShortQueries() bool {
+	return i.tailTrigrams
+}
+
+// Paths returns the filenames of all documents which were not deleted, in
+// docid order.
+func (i *Index) Paths() ([]string, error) {
+	paths := make([]string, 0, i.DocidMap.Count)
+	scanner := bufio.NewScanner(i.DocidMap.All())
+	for docid := uint32(0); scanner.Scan(); docid++ {
+		if i.deleted.contains(docid) {
+			continue
+		}
+		paths = append(paths, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
 type Match struct {
 	Docid    uint32
 	Position uint32 // byte offset of the trigram within the document
@@ -434,95 +526,86 @@ func (i *Index) matchesWithBuffer(t Trigram, buffers *bufferPair) ([]Match, erro
 	return matches, nil
 }
 
-// FiveLines returns five \n-separated lines surrounding pos. The first two
-// lines are context above the line containing pos (which is always element
-// [2]), the last two lines are context above that line.
-func FiveLines(b []byte, pos int) [5]string {
-	//fmt.Printf("FiveLines(%q, %d)", string(b), pos)
-	var five [5]string
-	prev := pos
-	start := 2 // no before lines
-	if prev > 0 {
-		// start of line of match
-		if idx := bytes.LastIndexByte(b[:prev], '\n'); idx != -1 {
-			prev = idx + 1
-		}
-		// first context line
-		if idx := bytes.LastIndexByte(b[:prev-1], '\n'); idx != -1 {
-			prev = idx + 1
-			start--
-			// second context line (maybe start of file)
-			if idx := bytes.LastIndexByte(b[:prev-1], '\n'); idx != -1 {
-				prev = idx + 1
-			} else {
-				prev = 0
-			}
-			start--
-		} else {
-			prev = 0
-			start--
-		}
+// ContextLines returns the \n-separated line containing pos, together with
+// up to n lines of context before and after that line (in file order).
+func ContextLines(b []byte, pos, n int) (before []string, line string, after []string) {
+	start := bytes.LastIndexByte(b[:pos], '\n') + 1
+	end := len(b)
+	if idx := bytes.IndexByte(b[pos:], '\n'); idx != -1 {
+		end = pos + idx
 	}
+	line = string(b[start:end])
 
-	if prev == -1 {
-		return five // TODO: BUG
+	for prev := start; prev > 0 && len(before) < n; {
+		lineStart := bytes.LastIndexByte(b[:prev-1], '\n') + 1
+		before = append(before, string(b[lineStart:prev-1]))
+		prev = lineStart
+	}
+	for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+		before[i], before[j] = before[j], before[i]
 	}
-	//fmt.Printf("start=%d, prev=%d, window = %q\n", start, prev, b[prev:])
-	scanner := bufio.NewScanner(bytes.NewReader(b[prev:]))
-	for ; start < 5; start++ {
-		if scanner.Scan() {
-			five[start] = scanner.Text()
+
+	for next := end + 1; next < len(b) && len(after) < n; {
+		lineEnd := len(b)
+		if idx := bytes.IndexByte(b[next:], '\n'); idx != -1 {
+			lineEnd = next + idx
 		}
+		after = append(after, string(b[next:lineEnd]))
+		next = lineEnd + 1
 	}
-	return five
+	return before, line, after
 }
 
-func (i *Index) QueryPositional(query string) ([]Match, error) {
-	if len(query) < 4 {
-		return nil, nil // not yet implemented
-	}
-	type planEntry struct {
-		offset  int
-		t       Trigram
-		entries uint32
-	}
-	qb := []byte(query)
-	plan := make([]planEntry, len(query)-2)
-	// TODO: maybe parallelize building the plan?
-	for j := 0; j < len(query)-2; j++ {
-		t := Trigram(uint32(qb[j])<<16 |
-			uint32(qb[j+1])<<8 |
-			uint32(qb[j+2]))
-		meta, _, err := i.Pos.metaEntry(t)
+// queryShort returns the positions of a query shorter than 4 bytes by
+// combining the posting lists of steps, i.e. all trigrams starting with the
+// query. Occurrences within the last 2 bytes of a file are found via their
+// padded trigrams (see Writer.AddFile). Queries consisting only of spaces are
+// not found within runs of spaces, as "   " is not part of the positional
+// index; see IsShortLiteral.
+func (i *Index) queryShort(steps []PlanStep) ([]Match, error) {
+	buffers := newBufferPair()
+	var entries []Match
+	for _, step := range steps {
+		matches, err := i.matchesWithBuffer(step.Trigram, buffers)
+		if err == errNotFound {
+			continue // e.g. "   ", which is skipped in the positional index
+		}
 		if err != nil {
 			return nil, err
 		}
-		plan[j] = planEntry{
-			offset:  j,
-			t:       t,
-			entries: meta.Entries,
-		}
+		entries = append(entries, matches...)
+	}
+	if len(steps) > 1 {
+		// Callers expect the matches of each document to be adjacent and in
+		// ascending order.
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Docid != entries[j].Docid {
+				return entries[i].Docid < entries[j].Docid
+			}
+			return entries[i].Position < entries[j].Position
+		})
 	}
-	plan[1] = plan[len(plan)-1]
-	// TODO: figure out if query planning measurably decreases query latency in
-	// production or not. For querylog-benchpos.txt, it’s a net loss: while the
-	// posting lists for some queries are decoded much faster, the probability
-	// of false positives is much lower whenthe first and last trigram
-	// match. This results in more file/position tuples to verify, hence more
-	// mmap() syscalls, hence a longer overall runtime.
-	//
-	// sort.Slice(plan, func(i, j int) bool { return plan[i].entries < plan[j].entries })
-	first := plan[0]
-	last := plan[1]
-
-	// for _, p := range plan {
-	// 	if math.Abs(float64(p.offset)-float64(first.offset)) < 3 {
-	// 		continue
-	// 	}
-	// 	last = p
-	// 	break
-	// }
+	return entries, nil
+}
+
+// QueryPositional returns the positions of the literal query in documents
+// which were not deleted, ordered by docid and position. See PlanPositional
+// for how the positions are located.
+func (i *Index) QueryPositional(query string) ([]Match, error) {
+	plan, err := i.PlanPositional(query)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := i.queryPlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	return i.liveMatches(matches), nil
+}
 
+// queryFirstLast intersects the positions of the first and last trigram of a
+// query.
+func (i *Index) queryFirstLast(first, last PlanStep) ([]Match, error) {
 	var eg errgroup.Group
 
 	var (
@@ -537,13 +620,13 @@ func (i *Index) QueryPositional(query string) ([]Match, error) {
 
 	eg.Go(func() error {
 		var err error
-		fdocids, fpos, fposrel, err = i.matchesWithBufferDirect(first.t, i.firstBuffer)
+		fdocids, fpos, fposrel, err = i.matchesWithBufferDirect(first.Trigram, i.firstBuffer)
 		return err
 	})
 
 	eg.Go(func() error {
 		var err error
-		ldocids, lpos, lposrel, err = i.matchesWithBufferDirect(last.t, i.lastBuffer)
+		ldocids, lpos, lposrel, err = i.matchesWithBufferDirect(last.Trigram, i.lastBuffer)
 		return err
 	})
 
@@ -553,10 +636,10 @@ func (i *Index) QueryPositional(query string) ([]Match, error) {
 
 	// filter matches based on position constraints
 	//delta := len(query) - 3
-	delta := last.offset - first.offset
+	delta := last.Offset - first.Offset
 	var entries []Match
 
-	flipped := last.offset < first.offset //len(lpos) < len(fpos)
+	flipped := last.Offset < first.Offset //len(lpos) < len(fpos)
 	if flipped {
 		fdocids, ldocids = ldocids, fdocids
 		fpos, lpos = lpos, fpos
@@ -625,6 +708,19 @@ func (i *Index) QueryPositional(query string) ([]Match, error) {
 	return entries, nil
 }
 
+// contents returns the contents of the index files, keyed by file name.
+func (i *Index) contents() map[string][]byte {
+	return map[string][]byte{
+		"docid.map":               i.DocidMap.f.Data,
+		"posting.docid.meta":      i.Docid.meta.Data,
+		"posting.docid.turbopfor": i.Docid.data.Data,
+		"posting.pos.meta":        i.Pos.meta.Data,
+		"posting.pos.turbopfor":   i.Pos.data.Data,
+		"posting.posrel.meta":     i.Posrel.meta.Data,
+		"posting.posrel.data":     i.Posrel.data.Data,
+	}
+}
+
 func (i *Index) Close() error {
 	if i.Docid != nil {
 		if err := i.Docid.Close(); err != nil {
@@ -0,0 +1,146 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestContextLines(t *testing.T) {
+	const input = "l1\nl2\nmatch here\nl4\nl5"
+	pos := strings.Index(input, "here")
+	for _, tt := range []struct {
+		n             int
+		before, after []string
+	}{
+		{0, nil, nil},
+		{1, []string{"l2"}, []string{"l4"}},
+		{2, []string{"l1", "l2"}, []string{"l4", "l5"}},
+		{20, []string{"l1", "l2"}, []string{"l4", "l5"}},
+	} {
+		before, line, after := ContextLines([]byte(input), pos, tt.n)
+		if got, want := line, "match here"; got != want {
+			t.Errorf("ContextLines(n=%d): line = %q, want %q", tt.n, got, want)
+		}
+		if !reflect.DeepEqual(before, tt.before) {
+			t.Errorf("ContextLines(n=%d): before = %q, want %q", tt.n, before, tt.before)
+		}
+		if !reflect.DeepEqual(after, tt.after) {
+			t.Errorf("ContextLines(n=%d): after = %q, want %q", tt.n, after, tt.after)
+		}
+	}
+
+	before, line, after := ContextLines([]byte("match\n"), 0, 2)
+	if line != "match" || before != nil || after != nil {
+		t.Errorf("ContextLines(single line) = %q, %q, %q, want nil, %q, nil", before, line, after, "match")
+	}
+}
+
+// writeIndex writes files to a new index in idxdir. The files are named
+// prefix followed by their index in files.
+func writeIndex(t *testing.T, idxdir, prefix string, files []string) {
+	t.Helper()
+	w, err := Create(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, content := range files {
+		name := prefix + strconv.Itoa(idx)
+		fn := filepath.Join(filepath.Dir(idxdir), name)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddFile(fn, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createIndex writes files to a new index in dir and opens it.
+func createIndex(t *testing.T, dir string, files []string) *Index {
+	t.Helper()
+	writeIndex(t, filepath.Join(dir, "idx"), "", files)
+	ix, err := Open(filepath.Join(dir, "idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func TestQueryPositionalShort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"if (a != b) {\n}\n",
+		"a->b != c->d\n",
+		"std::string\n",
+		// Occurrences within the last 2 bytes of a file.
+		"return a !=",
+		"using std::",
+		"x = -1",
+	}
+	ix := createIndex(t, dir, files)
+	defer ix.Close()
+	if !ix.ShortQueries() {
+		t.Errorf("ShortQueries() = false, want true")
+	}
+
+	for _, query := range []string{"!", "!=", "->", "::", "->b", "s", "xyz", "1", "-1", "=", " ", "d::"} {
+		var want []Match
+		for docid, content := range files {
+			for pos := 0; pos < len(content); pos++ {
+				if strings.HasPrefix(content[pos:], query) {
+					want = append(want, Match{Docid: uint32(docid), Position: uint32(pos)})
+				}
+			}
+		}
+		got, err := ix.QueryPositional(query)
+		if err != nil {
+			t.Fatalf("QueryPositional(%q): %v", query, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryPositional(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestQueryPositionalShortFormatVersion1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "idx")
+	writeIndex(t, idxdir, "", []string{"x = -1"})
+	// Indexes of format version 1 lack the trigrams of the last 2 bytes of
+	// each file, so queries of fewer than 3 bytes would be incomplete.
+	if err := os.Remove(filepath.Join(idxdir, manifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if ix.ShortQueries() {
+		t.Errorf("ShortQueries() on a version 1 index = true, want false")
+	}
+	if _, err := ix.QueryPositional("-1"); err != errNoTailTrigrams {
+		t.Errorf("QueryPositional(-1) on a version 1 index: err = %v, want %v", err, errNoTailTrigrams)
+	}
+	if _, err := ix.QueryPositional("x ="); err != nil {
+		t.Errorf("QueryPositional(x =) on a version 1 index: %v", err)
+	}
+}
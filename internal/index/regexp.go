@@ -47,6 +47,18 @@ func (q *Query) or(r *Query) *Query {
 	return q.andOr(r, QOr)
 }
 
+// And returns the query q AND r, possibly reusing q's and r's storage. It
+// can be used to combine the queries of multiple regexps which must all
+// match a file.
+func (q *Query) And(r *Query) *Query {
+	return q.and(r)
+}
+
+// Or returns the query q OR r, possibly reusing q's and r's storage.
+func (q *Query) Or(r *Query) *Query {
+	return q.or(r)
+}
+
 // andOr returns the query q AND r or q OR r, possibly reusing q's and r's storage.
 // It works hard to avoid creating unnecessarily complicated structures.
 func (q *Query) andOr(r *Query, op QueryOp) (out *Query) {
@@ -337,6 +349,21 @@ func RegexpQuery(re *syntax.Regexp) *Query {
 	return info.match
 }
 
+// IsShortLiteral reports whether re is a case-sensitive literal of fewer than
+// 4 bytes. RegexpQuery returns QAll for such expressions, but
+// Index.QueryPositional can locate them without scanning all files. Literals
+// consisting only of spaces are excluded, as runs of spaces are not part of
+// the positional index.
+func IsShortLiteral(re *syntax.Regexp) bool {
+	simplified := re.Simplify()
+	if simplified.Op != syntax.OpLiteral || simplified.Flags&syntax.FoldCase != 0 {
+		return false
+	}
+	literal := string(simplified.Rune)
+	n := len(literal)
+	return n > 0 && n < 4 && strings.Trim(literal, " ") != ""
+}
+
 // A regexpInfo summarizes the results of analyzing a regexp.
 type regexpInfo struct {
 	// canEmpty records whether the regexp matches the empty string
@@ -92,3 +92,52 @@ func TestQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestQueryAndOr(t *testing.T) {
+	parse := func(expr string) *Query {
+		re, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return RegexpQuery(re)
+	}
+	for _, tt := range []struct {
+		a, b string
+		and  string
+		or   string
+	}{
+		{`setuid`, `setgid`, `"etg" "etu" "gid" "set" "tgi" "tui" "uid"`, `"set" ("etu" "tui" "uid")|("etg" "gid" "tgi")`},
+		{`abc`, `.`, `"abc"`, `+`},
+	} {
+		if got := parse(tt.a).And(parse(tt.b)).String(); got != tt.and {
+			t.Errorf("%#q AND %#q = %#q, want %#q", tt.a, tt.b, got, tt.and)
+		}
+		if got := parse(tt.a).Or(parse(tt.b)).String(); got != tt.or {
+			t.Errorf("%#q OR %#q = %#q, want %#q", tt.a, tt.b, got, tt.or)
+		}
+	}
+}
+
+func TestIsShortLiteral(t *testing.T) {
+	for _, tt := range []struct {
+		re   string
+		want bool
+	}{
+		{`!=`, true},
+		{`a b`, true},
+		{`abcd`, false},
+		{`(?i)ab`, false},
+		{`a.`, false},
+		// Runs of spaces are not part of the positional index.
+		{` `, false},
+		{`   `, false},
+	} {
+		re, err := syntax.Parse(tt.re, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := IsShortLiteral(re); got != tt.want {
+			t.Errorf("IsShortLiteral(%#q) = %v, want %v", tt.re, got, tt.want)
+		}
+	}
+}
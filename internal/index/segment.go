@@ -0,0 +1,274 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/renameio"
+)
+
+// segmentsFile lists the segments of a segmented index, one directory name
+// (relative to the index directory) per line, in docid order.
+const segmentsFile = "segments"
+
+// A Segment is one of the immutable indexes making up a SegmentedIndex.
+type Segment struct {
+	*Index
+
+	// Name is the directory of the segment, relative to the directory of
+	// the SegmentedIndex. It is empty for the index stored in the directory
+	// itself.
+	Name string
+
+	// Base is the docid (within the SegmentedIndex) of the first document
+	// of the segment.
+	Base uint32
+}
+
+func (s *Segment) rebase(matches []Match) []Match {
+	for idx := range matches {
+		matches[idx].Docid += s.Base
+	}
+	return matches
+}
+
+// A SegmentedIndex combines the index stored in a directory (if any) with the
+// segments listed in the segments file of that directory. Docids are
+// numbered consecutively across segments.
+//
+// New documents are made searchable by appending a small segment (see
+// AppendSegment) instead of merging them into the index, and segments are
+// merged with each other from time to time (see CompactSegments).
+type SegmentedIndex struct {
+	Segments []*Segment
+	count    uint32
+}
+
+// ReadSegments returns the names of the segments of the segmented index in
+// dir, or nil if dir does not contain a segments file.
+func ReadSegments(dir string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, segmentsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+func writeSegments(dir string, names []string) error {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "\n")
+	}
+	return renameio.WriteFile(filepath.Join(dir, segmentsFile), []byte(b.String()), 0644)
+}
+
+// OpenSegmented opens the segmented index in dir. A directory without a
+// segments file is opened as a segmented index with a single segment.
+func OpenSegmented(dir string) (*SegmentedIndex, error) {
+	names, err := ReadSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docid.map")); err == nil {
+		names = append([]string{""}, names...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s contains neither an index nor segments", dir)
+	}
+	var si SegmentedIndex
+	for _, name := range names {
+		ix, err := Open(filepath.Join(dir, name))
+		if err != nil {
+			si.Close()
+			return nil, fmt.Errorf("segment %q: %v", name, err)
+		}
+		si.Segments = append(si.Segments, &Segment{
+			Index: ix,
+			Name:  name,
+			Base:  si.count,
+		})
+		si.count += uint32(ix.DocidMap.Count)
+	}
+	return &si, nil
+}
+
+// Count returns the number of documents in all segments.
+func (si *SegmentedIndex) Count() int {
+	return int(si.count)
+}
+
+// Lookup returns the filename of docid.
+func (si *SegmentedIndex) Lookup(docid uint32) (string, error) {
+	idx := sort.Search(len(si.Segments), func(i int) bool {
+		return si.Segments[i].Base > docid
+	}) - 1
+	if idx < 0 || docid >= si.count {
+		return "", fmt.Errorf("docid %d outside of segmented index [0, %d)", docid, si.count)
+	}
+	seg := si.Segments[idx]
+	return seg.DocidMap.Lookup(docid - seg.Base)
+}
+
+// PostingQuery is like Index.PostingQuery, but for all segments.
+func (si *SegmentedIndex) PostingQuery(q *Query) []uint32 {
+	var docids []uint32
+	for _, seg := range si.Segments {
+		for _, docid := range seg.PostingQuery(q) {
+			docids = append(docids, seg.Base+docid)
+		}
+	}
+	return docids
+}
+
+// ExplainPostingQuery is like Index.ExplainPostingQuery, but for all
+// segments. It returns one explanation per segment.
+func (si *SegmentedIndex) ExplainPostingQuery(q *Query) ([]uint32, []*QueryExplanation) {
+	var (
+		docids []uint32
+		exs    []*QueryExplanation
+	)
+	for _, seg := range si.Segments {
+		post, ex := seg.ExplainPostingQuery(q)
+		for _, docid := range post {
+			docids = append(docids, seg.Base+docid)
+		}
+		exs = append(exs, ex)
+	}
+	return docids, exs
+}
+
+// ShortQueries reports whether all segments support short queries, see
+// Index.ShortQueries.
+func (si *SegmentedIndex) ShortQueries() bool {
+	for _, seg := range si.Segments {
+		if !seg.ShortQueries() {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryPositional is like Index.QueryPositional, but for all segments.
+func (si *SegmentedIndex) QueryPositional(query string) ([]Match, error) {
+	var entries []Match
+	for _, seg := range si.Segments {
+		matches, err := seg.QueryPositional(query)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, seg.rebase(matches)...)
+	}
+	return entries, nil
+}
+
+// QueryPositionalPattern is like Index.QueryPositionalPattern, but for all
+// segments.
+func (si *SegmentedIndex) QueryPositionalPattern(p *PositionalPattern) ([]Match, error) {
+	var entries []Match
+	for _, seg := range si.Segments {
+		matches, err := seg.QueryPositionalPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, seg.rebase(matches)...)
+	}
+	return entries, nil
+}
+
+func (si *SegmentedIndex) Close() error {
+	var firstErr error
+	for _, seg := range si.Segments {
+		if err := seg.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// newSegment merges srcdirs into a new segment directory within dir and
+// returns its name.
+func newSegment(dir string, srcdirs []string) (string, error) {
+	name := fmt.Sprintf("segment.%d", time.Now().UnixNano())
+	segdir := filepath.Join(dir, name)
+	if err := os.Mkdir(segdir, 0755); err != nil {
+		return "", err
+	}
+	if err := ConcatN(segdir, srcdirs); err != nil {
+		os.RemoveAll(segdir)
+		return "", err
+	}
+	return name, nil
+}
+
+// AppendSegment merges the indexes in srcdirs (see Create) into a new segment
+// of the segmented index in dir and returns the name of the segment. The
+// segment is part of all segmented indexes opened afterwards.
+//
+// AppendSegment and CompactSegments must not be called concurrently for the
+// same dir.
+func AppendSegment(dir string, srcdirs []string) (string, error) {
+	names, err := ReadSegments(dir)
+	if err != nil {
+		return "", err
+	}
+	name, err := newSegment(dir, srcdirs)
+	if err != nil {
+		return "", err
+	}
+	if err := writeSegments(dir, append(names, name)); err != nil {
+		os.RemoveAll(filepath.Join(dir, name))
+		return "", err
+	}
+	return name, nil
+}
+
+// CompactSegments merges all segments of the segmented index in dir into a
+// single segment and removes the merged segments. The index stored in dir
+// itself is left alone: it is replaced as a whole by merging the indexes of
+// all documents (see ConcatN), which also drops all segments.
+//
+// Indexes which were opened before CompactSegments can still be used until
+// they are closed, but need to be re-opened to use the merged segment.
+func CompactSegments(dir string) error {
+	names, err := ReadSegments(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) < 2 {
+		return nil // nothing to merge
+	}
+	srcdirs := make([]string, len(names))
+	for idx, name := range names {
+		srcdirs[idx] = filepath.Join(dir, name)
+	}
+	name, err := newSegment(dir, srcdirs)
+	if err != nil {
+		return err
+	}
+	if err := writeSegments(dir, []string{name}); err != nil {
+		os.RemoveAll(filepath.Join(dir, name))
+		return err
+	}
+	for _, srcdir := range srcdirs {
+		if err := os.RemoveAll(srcdir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
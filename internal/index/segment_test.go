@@ -0,0 +1,97 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp/syntax"
+	"testing"
+)
+
+func segmentedFilenames(t *testing.T, si *SegmentedIndex, docids []uint32) []string {
+	t.Helper()
+	var filenames []string
+	for _, docid := range docids {
+		fn, err := si.Lookup(docid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, fn)
+	}
+	return filenames
+}
+
+func TestSegmentedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shard := filepath.Join(dir, "shard")
+	writeIndex(t, shard, "base", []string{"foobar\n", "nothing\n"})
+	writeIndex(t, filepath.Join(dir, "a"), "a", []string{"x := foobar()\n"})
+	writeIndex(t, filepath.Join(dir, "b"), "b", []string{"nothing\n", "foobar foobar\n"})
+	for _, src := range []string{"a", "b"} {
+		if _, err := AppendSegment(shard, []string{filepath.Join(dir, src)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	re, err := syntax.Parse("foobar", syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := RegexpQuery(re)
+	want := []string{"base0", "a0", "b1"}
+	wantPos := []uint32{0, 5, 0, 7}
+
+	check := func(wantSegments int) {
+		t.Helper()
+		si, err := OpenSegmented(shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer si.Close()
+		if got := len(si.Segments); got != wantSegments {
+			t.Errorf("len(Segments) = %d, want %d", got, wantSegments)
+		}
+		if got, want := si.Count(), 5; got != want {
+			t.Errorf("Count() = %d, want %d", got, want)
+		}
+		if got := segmentedFilenames(t, si, si.PostingQuery(q)); !reflect.DeepEqual(got, want) {
+			t.Errorf("PostingQuery(%v) = %v, want %v", q, got, want)
+		}
+		matches, err := si.QueryPositional("foobar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var docids, pos []uint32
+		for _, m := range matches {
+			if len(docids) == 0 || docids[len(docids)-1] != m.Docid {
+				docids = append(docids, m.Docid)
+			}
+			pos = append(pos, m.Position)
+		}
+		if got := segmentedFilenames(t, si, docids); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryPositional(foobar) files = %v, want %v", got, want)
+		}
+		if !reflect.DeepEqual(pos, wantPos) {
+			t.Errorf("QueryPositional(foobar) positions = %v, want %v", pos, wantPos)
+		}
+	}
+	check(3)
+
+	if err := CompactSegments(shard); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ReadSegments(shard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(names), 1; got != want {
+		t.Errorf("after CompactSegments: %d segments, want %d", got, want)
+	}
+	check(2)
+}
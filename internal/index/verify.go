@@ -0,0 +1,206 @@
+package index
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/Debian/dcs/internal/turbopfor"
+)
+
+// Verify checks the checksums of the manifest (if any), then checks the
+// internal consistency of the index by walking every trigram: meta entries
+// must be sorted by trigram and point into the data files, posting lists must
+// decode within their bounds, docids must be strictly increasing and covered
+// by the docid map, and the posrel bits of each trigram must mark as many
+// documents as its docid posting list lists.
+//
+// Unlike the checksums, the consistency checks also detect indexes which were
+// written incorrectly.
+func (i *Index) Verify() error {
+	if i.manifest != nil {
+		if err := i.manifest.checkChecksums(i.contents()); err != nil {
+			return err
+		}
+	}
+	if err := i.verifyDocidMap(); err != nil {
+		return err
+	}
+	docids, err := verifyMeta("posting.docid.meta", i.Docid.meta.Data, len(i.Docid.data.Data))
+	if err != nil {
+		return err
+	}
+	pos, err := verifyMeta("posting.pos.meta", i.Pos.meta.Data, len(i.Pos.data.Data))
+	if err != nil {
+		return err
+	}
+	posrel, err := verifyMeta("posting.posrel.meta", i.Posrel.meta.Data, len(i.Posrel.data.Data))
+	if err != nil {
+		return err
+	}
+	if got, want := len(pos), len(posrel); got != want {
+		return fmt.Errorf("posting.pos.meta has %d trigrams, posting.posrel.meta has %d", got, want)
+	}
+
+	var pidx int // index into pos and posrel
+	for idx, me := range docids {
+		t := me.Trigram
+		if err := verifyDocids(i.Docid.data.Data, docids, idx, uint32(i.DocidMap.Count)); err != nil {
+			return fmt.Errorf("trigram %q: posting.docid: %v", trigramString(t), err)
+		}
+		if t == spacesTrigram { // has no positions, see writePos
+			continue
+		}
+		if pidx >= len(pos) || pos[pidx].Trigram != t {
+			return fmt.Errorf("trigram %q: missing from posting.pos.meta", trigramString(t))
+		}
+		if posrel[pidx].Trigram != t {
+			return fmt.Errorf("trigram %q: missing from posting.posrel.meta", trigramString(t))
+		}
+		if err := decodeChecked(i.Pos.data.Data, pos, pidx, func([]uint32) error { return nil }); err != nil {
+			return fmt.Errorf("trigram %q: posting.pos: %v", trigramString(t), err)
+		}
+		if err := verifyPosrel(i.Posrel.data.Data, posrel, pidx, pos[pidx].Entries, me.Entries); err != nil {
+			return fmt.Errorf("trigram %q: posting.posrel: %v", trigramString(t), err)
+		}
+		pidx++
+	}
+	if pidx < len(pos) {
+		return fmt.Errorf("trigram %q: missing from posting.docid.meta", trigramString(pos[pidx].Trigram))
+	}
+	return nil
+}
+
+func trigramString(t Trigram) string {
+	return string([]byte{byte(t >> 16), byte(t >> 8), byte(t)})
+}
+
+// verifyDocidMap checks that the file name offsets of the docid map are
+// increasing and point into the file name section.
+func (i *Index) verifyDocidMap() error {
+	d := i.DocidMap.f.Data
+	var last uint32
+	for docid := 0; docid < i.DocidMap.Count; docid++ {
+		offset := binary.LittleEndian.Uint32(d[int(i.DocidMap.indexOffset)+docid*4:])
+		if offset < last || offset >= i.DocidMap.indexOffset {
+			return fmt.Errorf("docid.map: docid %d: invalid file name offset %d", docid, offset)
+		}
+		last = offset
+	}
+	return nil
+}
+
+// verifyMeta decodes the meta entries in b and checks that they are sorted by
+// trigram and that their offsets are increasing and within the data file of
+// size dataLen.
+func verifyMeta(name string, b []byte, dataLen int) ([]MetaEntry, error) {
+	if len(b)%metaEntrySize != 0 {
+		return nil, fmt.Errorf("%s: size %d is not a multiple of %d", name, len(b), metaEntrySize)
+	}
+	entries := make([]MetaEntry, len(b)/metaEntrySize)
+	for idx := range entries {
+		me := &entries[idx]
+		me.Unmarshal(b[idx*metaEntrySize:])
+		if idx > 0 && me.Trigram <= entries[idx-1].Trigram {
+			return nil, fmt.Errorf("%s: entry %d: trigram %q not sorted", name, idx, trigramString(me.Trigram))
+		}
+		if idx > 0 && me.OffsetData < entries[idx-1].OffsetData {
+			return nil, fmt.Errorf("%s: entry %d: offset %d not increasing", name, idx, me.OffsetData)
+		}
+		if me.OffsetData < 0 || me.OffsetData > int64(dataLen) {
+			return nil, fmt.Errorf("%s: entry %d: offset %d beyond end of data (%d bytes)", name, idx, me.OffsetData, dataLen)
+		}
+	}
+	return entries, nil
+}
+
+// dataEnd returns the offset at which the data of entries[idx] ends.
+func dataEnd(entries []MetaEntry, idx int, dataLen int) int64 {
+	if idx < len(entries)-1 {
+		return entries[idx+1].OffsetData
+	}
+	return int64(dataLen)
+}
+
+// decodeChecked calls fn with the deltas of the posting list of entries[idx],
+// up to 256 at a time, and returns an error if the posting list extends beyond
+// the start of the next posting list.
+func decodeChecked(data []byte, entries []MetaEntry, idx int, fn func(deltas []uint32) error) error {
+	me := entries[idx]
+	b := data[me.OffsetData:dataEnd(entries, idx, len(data))]
+	if me.Entries > 0 && len(b) == 0 {
+		return fmt.Errorf("%d entries, but no data", me.Entries)
+	}
+	buf := make([]uint32, 256)
+	for n := int(me.Entries); n > 0; {
+		var read int
+		if n >= 256 {
+			read = turbopfor.P4dec256v32(b, buf)
+		} else {
+			buf = buf[:n]
+			read = turbopfor.P4dec32(b, buf)
+		}
+		if read > len(b) {
+			return fmt.Errorf("posting list exceeds its %d bytes of data", dataEnd(entries, idx, len(data))-me.OffsetData)
+		}
+		b = b[read:]
+		n -= len(buf)
+		if err := fn(buf); err != nil {
+			return err
+		}
+		if n > 0 && len(b) == 0 {
+			return fmt.Errorf("data ends with %d entries remaining", n)
+		}
+	}
+	return nil
+}
+
+// verifyDocids checks that the docids of the posting list of entries[idx] are
+// strictly increasing and smaller than count.
+func verifyDocids(data []byte, entries []MetaEntry, idx int, count uint32) error {
+	var (
+		docid uint32
+		first = true
+	)
+	return decodeChecked(data, entries, idx, func(deltas []uint32) error {
+		for _, d := range deltas {
+			if d == 0 && !first {
+				return fmt.Errorf("docid %d listed twice", docid)
+			}
+			first = false
+			if docid+d < docid {
+				return fmt.Errorf("docid overflow after docid %d", docid)
+			}
+			docid += d
+			if docid >= count {
+				return fmt.Errorf("docid %d outside of docid map [0, %d)", docid, count)
+			}
+		}
+		return nil
+	})
+}
+
+// verifyPosrel checks that the posrel bits of the posting list of
+// entries[idx], which has one bit per position, mark the first position of
+// exactly numDocs documents.
+func verifyPosrel(data []byte, entries []MetaEntry, idx int, numPos, numDocs uint32) error {
+	me := entries[idx]
+	b := data[me.OffsetData:dataEnd(entries, idx, len(data))]
+	if need := (int(numPos) + 7) / 8; len(b) < need {
+		return fmt.Errorf("%d bytes of data, need %d for %d positions", len(b), need, numPos)
+	}
+	if numPos > 0 && b[0]&1 == 0 {
+		return fmt.Errorf("first position does not start a document")
+	}
+	var ones int
+	for _, v := range b[:numPos/8] {
+		ones += bits.OnesCount8(v)
+	}
+	if rem := numPos % 8; rem > 0 {
+		ones += bits.OnesCount8(b[numPos/8] & (1<<rem - 1))
+	}
+	if uint32(ones) != numDocs {
+		return fmt.Errorf("%d documents marked for %d positions, posting.docid lists %d documents", ones, numPos, numDocs)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "idx")
+	files := []string{"foobar\n", "nothing\n", strings.Repeat("foobar foobar\n", 100)}
+	for i := 0; i < 300; i++ {
+		files = append(files, "x := foobar()\n")
+	}
+	writeIndex(t, idxdir, "doc", files)
+
+	ix, err := Open(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Verify(); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+	ix.Close()
+
+	// Corrupt the index behind the manifest’s back.
+	fn := filepath.Join(idxdir, "posting.posrel.data")
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 1
+	if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Open only checks the sizes, Verify checks the checksums.
+	ix, err = Open(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Verify(); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Verify(corrupted index) = %v, want checksum error", err)
+	}
+	ix.Close()
+
+	// Without a manifest, Open succeeds, but Verify detects the corruption.
+	if err := os.Remove(filepath.Join(idxdir, manifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	ix, err = Open(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if err := ix.Verify(); err == nil || !strings.Contains(err.Error(), "posting.posrel") {
+		t.Errorf("Verify(corrupted index) = %v, want posting.posrel error", err)
+	}
+}
+
+func TestOpenTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "idx")
+	writeIndex(t, idxdir, "doc", []string{"foobar\n", "nothing\n"})
+	if err := os.Truncate(filepath.Join(idxdir, "posting.pos.turbopfor"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(idxdir); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Errorf("Open(truncated index) = %v, want size error", err)
+	}
+}
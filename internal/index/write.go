@@ -174,7 +174,7 @@ func (w *Writer) AddFile(fn, name string) error {
 		n       = 0
 		linelen = 0
 		buf     = w.inbuf[:0]
-		entries = make([]uint64, st.Size()-2)
+		entries = make([]uint64, st.Size())
 	)
 	for {
 		tv = (tv << 8) & (1<<24 - 1)
@@ -212,7 +212,16 @@ func (w *Writer) AddFile(fn, name string) error {
 	if w.set.Len() > maxTextTrigrams {
 		return errors.New("too many trigrams, probably not text, ignoring")
 	}
-	for _, e := range entries {
+	if n < 3 {
+		return errors.New("too short, ignoring")
+	}
+	// The last 2 bytes of the file do not start a trigram. Index them padded
+	// with NUL bytes, so that queries of fewer than 3 bytes find occurrences
+	// at the end of the file (see Index.queryShort).
+	// tv was shifted once more before EOF was detected.
+	entries[n-2] = uint64(tv)<<32 | uint64(n-2)
+	entries[n-1] = uint64((tv<<8)&(1<<24-1))<<32 | uint64(n-1)
+	for _, e := range entries[:n] {
 		t := Trigram(e >> 32)
 		w.index[t] = append(w.index[t], entry{docid: docid, position: uint32(e)})
 	}
@@ -243,7 +252,7 @@ func (w *Writer) Flush() error {
 		return err
 	}
 
-	return nil
+	return writeManifest(w.dir, FormatVersion)
 }
 
 // writeDocidMap creates the index’s docid.map file, which is a list of
@@ -388,6 +388,7 @@ func Start() (addr string, _ error) {
 		"-listen_address="+*listenWeb,
 		"-listen_address_http=localhost:0",
 		"-query_results_path="+filepath.Join(*localdcsPath, "qr"),
+		"-ranking_data_path="+filepath.Join(*localdcsPath, "ranking.json"),
 		"-tls_require_client_auth=false")
 	if err != nil {
 		return "", err
@@ -8,7 +8,10 @@ import (
 	fmt "fmt"
 	sourcebackendpb "github.com/Debian/dcs/internal/proto/sourcebackendpb"
 	proto "github.com/golang/protobuf/proto"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
 	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
 	math "math"
 )
 
@@ -21,7 +24,7 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 type Error_ErrorType int32
 
@@ -57,11 +60,12 @@ func (Error_ErrorType) EnumDescriptor() ([]byte, []int) {
 type Event_Type int32
 
 const (
-	Event_ERROR      Event_Type = 0
-	Event_PROGRESS   Event_Type = 1
-	Event_MATCH      Event_Type = 2
-	Event_PAGINATION Event_Type = 3
-	Event_DONE       Event_Type = 4
+	Event_ERROR        Event_Type = 0
+	Event_PROGRESS     Event_Type = 1
+	Event_MATCH        Event_Type = 2
+	Event_PAGINATION   Event_Type = 3
+	Event_DONE         Event_Type = 4
+	Event_FILE_SUMMARY Event_Type = 5
 )
 
 var Event_Type_name = map[int32]string{
@@ -70,14 +74,16 @@ var Event_Type_name = map[int32]string{
 	2: "MATCH",
 	3: "PAGINATION",
 	4: "DONE",
+	5: "FILE_SUMMARY",
 }
 
 var Event_Type_value = map[string]int32{
-	"ERROR":      0,
-	"PROGRESS":   1,
-	"MATCH":      2,
-	"PAGINATION": 3,
-	"DONE":       4,
+	"ERROR":        0,
+	"PROGRESS":     1,
+	"MATCH":        2,
+	"PAGINATION":   3,
+	"DONE":         4,
+	"FILE_SUMMARY": 5,
 }
 
 func (x Event_Type) String() string {
@@ -89,8 +95,21 @@ func (Event_Type) EnumDescriptor() ([]byte, []int) {
 }
 
 type SearchRequest struct {
-	Query                string   `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
-	Literal              bool     `protobuf:"varint,2,opt,name=literal,proto3" json:"literal,omitempty"`
+	Query           string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Literal         bool   `protobuf:"varint,2,opt,name=literal,proto3" json:"literal,omitempty"`
+	CaseInsensitive bool   `protobuf:"varint,3,opt,name=case_insensitive,json=caseInsensitive,proto3" json:"case_insensitive,omitempty"`
+	WholeWord       bool   `protobuf:"varint,4,opt,name=whole_word,json=wholeWord,proto3" json:"whole_word,omitempty"`
+	// Number of lines of context to return before and after each match, at
+	// most 20. Unset means the default of 2 lines.
+	ContextLines *wrappers.UInt32Value `protobuf:"bytes,8,opt,name=context_lines,json=contextLines,proto3" json:"context_lines,omitempty"`
+	// Whether to return matches (the default), only the paths of matching
+	// files, or only the number of matches per file. The latter two are
+	// returned as FILE_SUMMARY events.
+	ResultMode sourcebackendpb.SearchRequest_ResultMode `protobuf:"varint,6,opt,name=result_mode,json=resultMode,proto3,enum=sourcebackendpb.SearchRequest_ResultMode" json:"result_mode,omitempty"`
+	// Return matches in identical files (e.g. copies of vendored libraries)
+	// separately instead of collapsing them into one match with
+	// sourcebackendpb.Match.also_in set.
+	KeepDuplicates       bool     `protobuf:"varint,7,opt,name=keep_duplicates,json=keepDuplicates,proto3" json:"keep_duplicates,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -135,6 +154,41 @@ func (m *SearchRequest) GetLiteral() bool {
 	return false
 }
 
+func (m *SearchRequest) GetCaseInsensitive() bool {
+	if m != nil {
+		return m.CaseInsensitive
+	}
+	return false
+}
+
+func (m *SearchRequest) GetWholeWord() bool {
+	if m != nil {
+		return m.WholeWord
+	}
+	return false
+}
+
+func (m *SearchRequest) GetContextLines() *wrappers.UInt32Value {
+	if m != nil {
+		return m.ContextLines
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetResultMode() sourcebackendpb.SearchRequest_ResultMode {
+	if m != nil {
+		return m.ResultMode
+	}
+	return sourcebackendpb.SearchRequest_MATCHES
+}
+
+func (m *SearchRequest) GetKeepDuplicates() bool {
+	if m != nil {
+		return m.KeepDuplicates
+	}
+	return false
+}
+
 type Error struct {
 	Type                 Error_ErrorType `protobuf:"varint,1,opt,name=type,proto3,enum=dcspb.Error_ErrorType" json:"type,omitempty"`
 	Message              string          `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
@@ -183,10 +237,12 @@ func (m *Error) GetMessage() string {
 }
 
 type Progress struct {
-	QueryId              string   `protobuf:"bytes,1,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
-	FilesProcessed       int64    `protobuf:"varint,2,opt,name=files_processed,json=filesProcessed,proto3" json:"files_processed,omitempty"`
-	FilesTotal           int64    `protobuf:"varint,3,opt,name=files_total,json=filesTotal,proto3" json:"files_total,omitempty"`
-	Results              int64    `protobuf:"varint,4,opt,name=results,proto3" json:"results,omitempty"`
+	QueryId        string `protobuf:"bytes,1,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
+	FilesProcessed int64  `protobuf:"varint,2,opt,name=files_processed,json=filesProcessed,proto3" json:"files_processed,omitempty"`
+	FilesTotal     int64  `protobuf:"varint,3,opt,name=files_total,json=filesTotal,proto3" json:"files_total,omitempty"`
+	Results        int64  `protobuf:"varint,4,opt,name=results,proto3" json:"results,omitempty"`
+	// Whether at least one source backend stopped searching early.
+	Truncated            bool     `protobuf:"varint,5,opt,name=truncated,proto3" json:"truncated,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -245,6 +301,13 @@ func (m *Progress) GetResults() int64 {
 	return 0
 }
 
+func (m *Progress) GetTruncated() bool {
+	if m != nil {
+		return m.Truncated
+	}
+	return false
+}
+
 type Pagination struct {
 	QueryId              string   `protobuf:"bytes,1,opt,name=query_id,json=queryId,proto3" json:"query_id,omitempty"`
 	ResultPages          int64    `protobuf:"varint,2,opt,name=result_pages,json=resultPages,proto3" json:"result_pages,omitempty"`
@@ -298,6 +361,7 @@ type Event struct {
 	//	*Event_Progress
 	//	*Event_Match
 	//	*Event_Pagination
+	//	*Event_FileSummary
 	Data                 isEvent_Data `protobuf_oneof:"data"`
 	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
 	XXX_unrecognized     []byte       `json:"-"`
@@ -349,6 +413,10 @@ type Event_Pagination struct {
 	Pagination *Pagination `protobuf:"bytes,4,opt,name=pagination,proto3,oneof"`
 }
 
+type Event_FileSummary struct {
+	FileSummary *sourcebackendpb.FileSummary `protobuf:"bytes,5,opt,name=file_summary,json=fileSummary,proto3,oneof"`
+}
+
 func (*Event_Error) isEvent_Data() {}
 
 func (*Event_Progress) isEvent_Data() {}
@@ -357,6 +425,8 @@ func (*Event_Match) isEvent_Data() {}
 
 func (*Event_Pagination) isEvent_Data() {}
 
+func (*Event_FileSummary) isEvent_Data() {}
+
 func (m *Event) GetData() isEvent_Data {
 	if m != nil {
 		return m.Data
@@ -392,116 +462,22 @@ func (m *Event) GetPagination() *Pagination {
 	return nil
 }
 
-// XXX_OneofFuncs is for the internal use of the proto package.
-func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
-	return _Event_OneofMarshaler, _Event_OneofUnmarshaler, _Event_OneofSizer, []interface{}{
-		(*Event_Error)(nil),
-		(*Event_Progress)(nil),
-		(*Event_Match)(nil),
-		(*Event_Pagination)(nil),
-	}
-}
-
-func _Event_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
-	m := msg.(*Event)
-	// data
-	switch x := m.Data.(type) {
-	case *Event_Error:
-		b.EncodeVarint(1<<3 | proto.WireBytes)
-		if err := b.EncodeMessage(x.Error); err != nil {
-			return err
-		}
-	case *Event_Progress:
-		b.EncodeVarint(2<<3 | proto.WireBytes)
-		if err := b.EncodeMessage(x.Progress); err != nil {
-			return err
-		}
-	case *Event_Match:
-		b.EncodeVarint(3<<3 | proto.WireBytes)
-		if err := b.EncodeMessage(x.Match); err != nil {
-			return err
-		}
-	case *Event_Pagination:
-		b.EncodeVarint(4<<3 | proto.WireBytes)
-		if err := b.EncodeMessage(x.Pagination); err != nil {
-			return err
-		}
-	case nil:
-	default:
-		return fmt.Errorf("Event.Data has unexpected type %T", x)
+func (m *Event) GetFileSummary() *sourcebackendpb.FileSummary {
+	if x, ok := m.GetData().(*Event_FileSummary); ok {
+		return x.FileSummary
 	}
 	return nil
 }
 
-func _Event_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
-	m := msg.(*Event)
-	switch tag {
-	case 1: // data.error
-		if wire != proto.WireBytes {
-			return true, proto.ErrInternalBadWireType
-		}
-		msg := new(Error)
-		err := b.DecodeMessage(msg)
-		m.Data = &Event_Error{msg}
-		return true, err
-	case 2: // data.progress
-		if wire != proto.WireBytes {
-			return true, proto.ErrInternalBadWireType
-		}
-		msg := new(Progress)
-		err := b.DecodeMessage(msg)
-		m.Data = &Event_Progress{msg}
-		return true, err
-	case 3: // data.match
-		if wire != proto.WireBytes {
-			return true, proto.ErrInternalBadWireType
-		}
-		msg := new(sourcebackendpb.Match)
-		err := b.DecodeMessage(msg)
-		m.Data = &Event_Match{msg}
-		return true, err
-	case 4: // data.pagination
-		if wire != proto.WireBytes {
-			return true, proto.ErrInternalBadWireType
-		}
-		msg := new(Pagination)
-		err := b.DecodeMessage(msg)
-		m.Data = &Event_Pagination{msg}
-		return true, err
-	default:
-		return false, nil
-	}
-}
-
-func _Event_OneofSizer(msg proto.Message) (n int) {
-	m := msg.(*Event)
-	// data
-	switch x := m.Data.(type) {
-	case *Event_Error:
-		s := proto.Size(x.Error)
-		n += 1 // tag and wire
-		n += proto.SizeVarint(uint64(s))
-		n += s
-	case *Event_Progress:
-		s := proto.Size(x.Progress)
-		n += 1 // tag and wire
-		n += proto.SizeVarint(uint64(s))
-		n += s
-	case *Event_Match:
-		s := proto.Size(x.Match)
-		n += 1 // tag and wire
-		n += proto.SizeVarint(uint64(s))
-		n += s
-	case *Event_Pagination:
-		s := proto.Size(x.Pagination)
-		n += 1 // tag and wire
-		n += proto.SizeVarint(uint64(s))
-		n += s
-	case nil:
-	default:
-		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Event) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Event_Error)(nil),
+		(*Event_Progress)(nil),
+		(*Event_Match)(nil),
+		(*Event_Pagination)(nil),
+		(*Event_FileSummary)(nil),
 	}
-	return n
 }
 
 func init() {
@@ -517,43 +493,57 @@ func init() {
 func init() { proto.RegisterFile("dcs.proto", fileDescriptor_14f789ee6ef427d2) }
 
 var fileDescriptor_14f789ee6ef427d2 = []byte{
-	// 567 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0xcd, 0x6e, 0xd3, 0x4c,
-	0x14, 0x8d, 0x93, 0x38, 0x4d, 0x6e, 0xfa, 0xe3, 0xce, 0x57, 0xf5, 0x0b, 0xdd, 0x50, 0x0c, 0x12,
-	0x55, 0x05, 0x76, 0xe5, 0x2e, 0x58, 0x22, 0x27, 0x36, 0x8d, 0x21, 0x75, 0xcc, 0x24, 0xad, 0x04,
-	0x9b, 0x68, 0x6c, 0x0f, 0xa9, 0x85, 0x6b, 0xbb, 0x33, 0x13, 0xa4, 0x3c, 0x02, 0x2b, 0x9e, 0x81,
-	0x37, 0x45, 0x1e, 0xc7, 0x51, 0xcb, 0x82, 0x4d, 0xa4, 0xf3, 0x33, 0x77, 0xee, 0x39, 0x19, 0x43,
-	0x2f, 0x8e, 0xb8, 0x51, 0xb0, 0x5c, 0xe4, 0x48, 0x8d, 0x23, 0x5e, 0x84, 0x27, 0x2f, 0x79, 0xbe,
-	0x62, 0x11, 0x0d, 0x49, 0xf4, 0x9d, 0x66, 0x71, 0x11, 0x9a, 0x4f, 0x70, 0xe5, 0xd5, 0xdf, 0xc3,
-	0xde, 0x8c, 0x12, 0x16, 0xdd, 0x61, 0xfa, 0xb0, 0xa2, 0x5c, 0xa0, 0x23, 0x50, 0x1f, 0x56, 0x94,
-	0xad, 0x07, 0xca, 0xa9, 0x72, 0xd6, 0xc3, 0x15, 0x40, 0x03, 0xd8, 0x49, 0x13, 0x41, 0x19, 0x49,
-	0x07, 0xcd, 0x53, 0xe5, 0xac, 0x8b, 0x6b, 0xa8, 0xff, 0x56, 0x40, 0x75, 0x19, 0xcb, 0x19, 0x3a,
-	0x87, 0xb6, 0x58, 0x17, 0x54, 0x1e, 0xdc, 0xb7, 0x8e, 0x0d, 0xb9, 0x85, 0x21, 0xb5, 0xea, 0x77,
-	0xbe, 0x2e, 0x28, 0x96, 0x9e, 0x72, 0xde, 0x3d, 0xe5, 0x9c, 0x2c, 0xa9, 0x9c, 0xd7, 0xc3, 0x35,
-	0xd4, 0x31, 0xf4, 0xb6, 0x66, 0xb4, 0x07, 0xbd, 0x91, 0xed, 0x8f, 0xdc, 0xc9, 0xc4, 0x75, 0xb4,
-	0x06, 0xfa, 0x1f, 0xfe, 0x1b, 0xda, 0xa3, 0x4f, 0xae, 0xef, 0x2c, 0x6e, 0x7c, 0xfb, 0xd6, 0xf6,
-	0x26, 0xf6, 0x70, 0xe2, 0x6a, 0x0a, 0x02, 0xe8, 0x7c, 0xb0, 0xbd, 0xd2, 0xd4, 0x44, 0x87, 0xb0,
-	0xe7, 0xf9, 0xb7, 0xf6, 0xc4, 0x73, 0x16, 0x9f, 0x6f, 0x5c, 0xfc, 0x45, 0x6b, 0xe9, 0x3f, 0x15,
-	0xe8, 0x06, 0x2c, 0x5f, 0x32, 0xca, 0x39, 0x7a, 0x06, 0x5d, 0x99, 0x69, 0x91, 0xc4, 0x9b, 0x8c,
-	0x3b, 0x12, 0x7b, 0x31, 0x7a, 0x0d, 0x07, 0xdf, 0x92, 0x94, 0xf2, 0x45, 0xc1, 0xf2, 0x88, 0x72,
-	0x4e, 0x63, 0xb9, 0x5d, 0x0b, 0xef, 0x4b, 0x3a, 0xa8, 0x59, 0xf4, 0x1c, 0xfa, 0x95, 0x51, 0xe4,
-	0x82, 0xa4, 0x83, 0x96, 0x34, 0x81, 0xa4, 0xe6, 0x25, 0x53, 0xe6, 0x63, 0x94, 0xaf, 0x52, 0xc1,
-	0x07, 0x6d, 0x29, 0xd6, 0x50, 0xff, 0x08, 0x10, 0x90, 0x65, 0x92, 0x11, 0x91, 0xe4, 0xd9, 0xbf,
-	0x96, 0x79, 0x01, 0xbb, 0xd5, 0x99, 0x45, 0x41, 0x96, 0x94, 0x6f, 0x36, 0xe9, 0x57, 0x5c, 0x50,
-	0x52, 0xfa, 0xaf, 0x26, 0xa8, 0xee, 0x0f, 0x9a, 0x09, 0xf4, 0x0a, 0x54, 0x5a, 0xb6, 0x26, 0x87,
-	0xf4, 0xad, 0xdd, 0xc7, 0xe5, 0x8f, 0x1b, 0xb8, 0x12, 0xd1, 0x5b, 0xe8, 0x16, 0x9b, 0x1a, 0xe4,
-	0xb8, 0xbe, 0x75, 0xb0, 0x31, 0xd6, 0xed, 0x8c, 0x1b, 0x78, 0x6b, 0x41, 0x06, 0xa8, 0xf7, 0x44,
-	0x44, 0x77, 0x32, 0x5f, 0xdf, 0x3a, 0x36, 0xfe, 0x7a, 0x50, 0xc6, 0x75, 0xa9, 0x96, 0xe3, 0xa5,
-	0x0d, 0x5d, 0x02, 0x14, 0xdb, 0x68, 0x32, 0x77, 0xdf, 0x3a, 0xac, 0x2f, 0xd8, 0x0a, 0xe3, 0x06,
-	0x7e, 0x64, 0xd3, 0x1d, 0x68, 0xcb, 0xbf, 0xba, 0x07, 0xaa, 0x8b, 0xf1, 0x14, 0x6b, 0x0d, 0xb4,
-	0x0b, 0xdd, 0x00, 0x4f, 0xaf, 0xb0, 0x3b, 0x9b, 0x69, 0x4a, 0x29, 0x5c, 0xdb, 0xf3, 0xd1, 0x58,
-	0x6b, 0xa2, 0x7d, 0x80, 0xc0, 0xbe, 0xf2, 0x7c, 0x7b, 0xee, 0x4d, 0x7d, 0xad, 0x85, 0xba, 0xd0,
-	0x76, 0xa6, 0xbe, 0xab, 0xb5, 0x87, 0x1d, 0x68, 0xc7, 0x44, 0x10, 0xeb, 0x1d, 0xb4, 0x9c, 0xd1,
-	0x0c, 0x5d, 0x40, 0xa7, 0x7a, 0xd5, 0xe8, 0x68, 0x73, 0xff, 0x93, 0x47, 0x7e, 0xb2, 0xed, 0xa7,
-	0x2c, 0x4f, 0x6f, 0x5c, 0x28, 0xc3, 0x37, 0x5f, 0xcf, 0x97, 0x89, 0xb8, 0x5b, 0x85, 0x46, 0x94,
-	0xdf, 0x9b, 0x0e, 0x0d, 0x13, 0x92, 0x99, 0x71, 0xc4, 0xcd, 0x24, 0x13, 0x94, 0x65, 0x24, 0x35,
-	0xe5, 0xf7, 0x62, 0xca, 0x73, 0x61, 0x47, 0x82, 0xcb, 0x3f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xa0,
-	0x29, 0x80, 0x03, 0x75, 0x03, 0x00, 0x00,
+	// 790 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x54, 0x5d, 0x73, 0xda, 0x46,
+	0x14, 0x45, 0x80, 0x30, 0x5c, 0x30, 0x56, 0xb6, 0x99, 0x54, 0xf5, 0xa4, 0xad, 0x4b, 0x3b, 0x53,
+	0x27, 0xd3, 0x8a, 0x8c, 0xfc, 0xd0, 0x67, 0x19, 0xe4, 0x20, 0x17, 0x30, 0x5d, 0x6c, 0x77, 0xd2,
+	0x17, 0xcd, 0x22, 0x5d, 0x63, 0x4d, 0x84, 0xa4, 0xec, 0xae, 0xe2, 0xf2, 0x73, 0xfa, 0xd4, 0x9f,
+	0xd2, 0x3f, 0xd2, 0x1f, 0xd2, 0xd1, 0x4a, 0x90, 0x38, 0x9d, 0xc9, 0x0b, 0xc3, 0x3d, 0xf7, 0xec,
+	0xc7, 0x39, 0xe7, 0xae, 0xa0, 0x13, 0x06, 0xc2, 0xca, 0x78, 0x2a, 0x53, 0xa2, 0x87, 0x81, 0xc8,
+	0x56, 0xc7, 0xdf, 0xac, 0xd3, 0x74, 0x1d, 0xe3, 0x50, 0x81, 0xab, 0xfc, 0x6e, 0xf8, 0xc0, 0x59,
+	0x96, 0x21, 0xaf, 0x68, 0xc7, 0xdf, 0x8b, 0x34, 0xe7, 0x01, 0xae, 0x58, 0xf0, 0x16, 0x93, 0x30,
+	0x5b, 0x0d, 0x1f, 0xd5, 0x25, 0x69, 0xf0, 0x4f, 0x1d, 0x0e, 0x97, 0xc8, 0x78, 0x70, 0x4f, 0xf1,
+	0x5d, 0x8e, 0x42, 0x92, 0xa7, 0xa0, 0xbf, 0xcb, 0x91, 0x6f, 0x4d, 0xed, 0x44, 0x3b, 0xed, 0xd0,
+	0xb2, 0x20, 0x26, 0x1c, 0xc4, 0x91, 0x44, 0xce, 0x62, 0xb3, 0x7e, 0xa2, 0x9d, 0xb6, 0xe9, 0xae,
+	0x24, 0x2f, 0xc0, 0x08, 0x98, 0x40, 0x3f, 0x4a, 0x04, 0x26, 0x22, 0x92, 0xd1, 0x7b, 0x34, 0x1b,
+	0x8a, 0x72, 0x54, 0xe0, 0xde, 0x07, 0x98, 0x7c, 0x0d, 0xf0, 0x70, 0x9f, 0xc6, 0xe8, 0x3f, 0xa4,
+	0x3c, 0x34, 0x9b, 0x8a, 0xd4, 0x51, 0xc8, 0xef, 0x29, 0x0f, 0x89, 0x03, 0x87, 0x41, 0x9a, 0x48,
+	0xfc, 0x53, 0xfa, 0x71, 0x94, 0xa0, 0x30, 0xdb, 0x27, 0xda, 0x69, 0xd7, 0x7e, 0x6e, 0x95, 0x42,
+	0xad, 0x9d, 0x50, 0xeb, 0xc6, 0x4b, 0xe4, 0x99, 0x7d, 0xcb, 0xe2, 0x1c, 0x69, 0xaf, 0x5a, 0x32,
+	0x2d, 0x56, 0x90, 0x4b, 0xe8, 0x72, 0x14, 0x79, 0x2c, 0xfd, 0x4d, 0x1a, 0xa2, 0xd9, 0x3a, 0xd1,
+	0x4e, 0xfb, 0xf6, 0x0b, 0xeb, 0x13, 0x27, 0xac, 0x47, 0x8a, 0x2d, 0xaa, 0x56, 0xcc, 0xd2, 0x10,
+	0x29, 0xf0, 0xfd, 0x7f, 0xf2, 0x23, 0x1c, 0xbd, 0x45, 0xcc, 0xfc, 0x30, 0xcf, 0xe2, 0x28, 0x60,
+	0x12, 0x85, 0x79, 0xa0, 0xae, 0xdc, 0x2f, 0xe0, 0xf1, 0x1e, 0xbd, 0x6c, 0xb6, 0x75, 0xa3, 0x35,
+	0xf8, 0x4b, 0x03, 0xdd, 0xe5, 0x3c, 0xe5, 0xe4, 0x25, 0x34, 0xe5, 0x36, 0x43, 0x65, 0x60, 0xdf,
+	0x7e, 0x66, 0xa9, 0xb8, 0x2c, 0xd5, 0x2b, 0x7f, 0xaf, 0xb7, 0x19, 0x52, 0xc5, 0x29, 0x7c, 0xdd,
+	0xa0, 0x10, 0x6c, 0x8d, 0xca, 0xd7, 0x0e, 0xdd, 0x95, 0x03, 0x0a, 0x9d, 0x3d, 0x99, 0x1c, 0x42,
+	0x67, 0xe4, 0xcc, 0x47, 0xee, 0x74, 0xea, 0x8e, 0x8d, 0x1a, 0xf9, 0x12, 0xbe, 0x38, 0x77, 0x46,
+	0xbf, 0xba, 0xf3, 0xb1, 0x7f, 0x33, 0x77, 0x6e, 0x1d, 0x6f, 0xea, 0x9c, 0x4f, 0x5d, 0x43, 0x23,
+	0x00, 0xad, 0x0b, 0xc7, 0x2b, 0x48, 0x75, 0xf2, 0x04, 0x0e, 0xbd, 0xf9, 0xad, 0x33, 0xf5, 0xc6,
+	0xfe, 0x6f, 0x37, 0x2e, 0x7d, 0x63, 0x34, 0x06, 0x7f, 0x6b, 0xd0, 0x5e, 0xf0, 0x74, 0xcd, 0x51,
+	0x08, 0xf2, 0x15, 0xb4, 0x55, 0xb6, 0x7e, 0x14, 0x56, 0x59, 0x1f, 0xa8, 0xda, 0x0b, 0x0b, 0xe9,
+	0x77, 0x51, 0x8c, 0xc2, 0xcf, 0x78, 0x1a, 0xa0, 0x10, 0x18, 0xaa, 0xdb, 0x35, 0x68, 0x5f, 0xc1,
+	0x8b, 0x1d, 0x4a, 0xbe, 0x85, 0x6e, 0x49, 0x94, 0xa9, 0x64, 0xb1, 0xca, 0xbd, 0x41, 0x41, 0x41,
+	0xd7, 0x05, 0x52, 0xe8, 0x2b, 0x2d, 0x15, 0x2a, 0xef, 0x06, 0xdd, 0x95, 0xe4, 0x39, 0x74, 0x24,
+	0xcf, 0x93, 0xc2, 0xc2, 0xd0, 0xd4, 0xcb, 0x59, 0xd8, 0x03, 0x83, 0x4b, 0x80, 0x05, 0x5b, 0x47,
+	0x09, 0x93, 0x51, 0x9a, 0x7c, 0xee, 0xaa, 0xdf, 0x41, 0xaf, 0x4a, 0x3c, 0x63, 0x6b, 0x14, 0xd5,
+	0x3d, 0xab, 0x29, 0x58, 0x14, 0xd0, 0xe0, 0xdf, 0x3a, 0xe8, 0xee, 0x7b, 0x4c, 0x24, 0xf9, 0x01,
+	0x74, 0x2c, 0x3c, 0x55, 0x9b, 0x74, 0xed, 0xde, 0xc7, 0xd1, 0x4c, 0x6a, 0xb4, 0x6c, 0x92, 0x9f,
+	0xa1, 0x9d, 0x55, 0x26, 0xa9, 0xed, 0xba, 0xf6, 0x51, 0x45, 0xdc, 0x79, 0x37, 0xa9, 0xd1, 0x3d,
+	0x85, 0x58, 0xa0, 0x6f, 0x98, 0x0c, 0xee, 0x95, 0xfa, 0xae, 0xfd, 0xec, 0x7f, 0xd3, 0x36, 0x2b,
+	0xba, 0xc5, 0xf6, 0x8a, 0x46, 0xce, 0x00, 0xb2, 0xbd, 0x34, 0xe5, 0x4a, 0xd7, 0x7e, 0xb2, 0x3b,
+	0x60, 0xdf, 0x98, 0xd4, 0xe8, 0x47, 0x34, 0xe2, 0x40, 0xaf, 0x70, 0xd5, 0x17, 0xf9, 0x66, 0xc3,
+	0xf8, 0xd6, 0xd4, 0xab, 0xa7, 0xf1, 0xe9, 0x59, 0x17, 0x51, 0x8c, 0xcb, 0x92, 0x33, 0xa9, 0xd1,
+	0xee, 0xdd, 0x87, 0x72, 0x70, 0x0b, 0x4d, 0x35, 0x4b, 0x1d, 0xd0, 0x5d, 0x4a, 0xaf, 0xa8, 0x51,
+	0x23, 0x3d, 0x68, 0x2f, 0xe8, 0xd5, 0x6b, 0xea, 0x2e, 0x97, 0x86, 0x56, 0x34, 0x66, 0xce, 0xf5,
+	0x68, 0x62, 0xd4, 0x49, 0x1f, 0x60, 0xe1, 0xbc, 0xf6, 0xe6, 0xce, 0xb5, 0x77, 0x35, 0x37, 0x1a,
+	0xa4, 0x0d, 0xcd, 0xf1, 0xd5, 0xdc, 0x35, 0x9a, 0xc4, 0x80, 0xde, 0x85, 0x37, 0x75, 0xfd, 0xe5,
+	0xcd, 0x6c, 0xe6, 0xd0, 0x37, 0x86, 0x7e, 0xde, 0x82, 0x66, 0xc8, 0x24, 0xb3, 0x7f, 0x81, 0xc6,
+	0x78, 0xb4, 0x24, 0xaf, 0xa0, 0x55, 0x3e, 0x2f, 0xf2, 0xb4, 0x12, 0xf5, 0xe8, 0xb5, 0x1d, 0xef,
+	0x4d, 0x2f, 0x12, 0x19, 0xd4, 0x5e, 0x69, 0xe7, 0x3f, 0xfd, 0xf1, 0x72, 0x1d, 0xc9, 0xfb, 0x7c,
+	0x65, 0x05, 0xe9, 0x66, 0x38, 0xc6, 0x55, 0xc4, 0x92, 0x61, 0x18, 0x88, 0x61, 0x94, 0x48, 0xe4,
+	0x09, 0x8b, 0xcb, 0x4f, 0xdc, 0x50, 0xad, 0x5b, 0xb5, 0x54, 0x71, 0xf6, 0xdf, 0x00, 0xd6, 0xcd,
+	0xb0, 0x90, 0x11, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -616,6 +606,14 @@ type DCSServer interface {
 	Search(*SearchRequest, DCS_SearchServer) error
 }
 
+// UnimplementedDCSServer can be embedded to have forward compatible implementations.
+type UnimplementedDCSServer struct {
+}
+
+func (*UnimplementedDCSServer) Search(req *SearchRequest, srv DCS_SearchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+
 func RegisterDCSServer(s *grpc.Server, srv DCSServer) {
 	s.RegisterService(&_DCS_serviceDesc, srv)
 }
@@ -1,15 +1,17 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // source: sourcebackend.proto
 
-package sourcebackendpb // import "github.com/Debian/dcs/internal/proto/sourcebackendpb"
-
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
+package sourcebackendpb
 
 import (
-	context "golang.org/x/net/context"
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
 	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -21,29 +23,66 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type SearchRequest_ResultMode int32
+
+const (
+	// Send a MATCH reply for each match.
+	SearchRequest_MATCHES SearchRequest_ResultMode = 0
+	// Only send a FILE_SUMMARY reply for each file containing a match.
+	SearchRequest_FILES_ONLY SearchRequest_ResultMode = 1
+	// Only send a FILE_SUMMARY reply with the number of matches for each
+	// file containing a match.
+	SearchRequest_COUNT_ONLY SearchRequest_ResultMode = 2
+)
+
+var SearchRequest_ResultMode_name = map[int32]string{
+	0: "MATCHES",
+	1: "FILES_ONLY",
+	2: "COUNT_ONLY",
+}
+
+var SearchRequest_ResultMode_value = map[string]int32{
+	"MATCHES":    0,
+	"FILES_ONLY": 1,
+	"COUNT_ONLY": 2,
+}
+
+func (x SearchRequest_ResultMode) String() string {
+	return proto.EnumName(SearchRequest_ResultMode_name, int32(x))
+}
+
+func (SearchRequest_ResultMode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{2, 0}
+}
 
 type SearchReply_Type int32
 
 const (
 	SearchReply_MATCH           SearchReply_Type = 0
 	SearchReply_PROGRESS_UPDATE SearchReply_Type = 1
+	SearchReply_FILE_SUMMARY    SearchReply_Type = 2
 )
 
 var SearchReply_Type_name = map[int32]string{
 	0: "MATCH",
 	1: "PROGRESS_UPDATE",
+	2: "FILE_SUMMARY",
 }
+
 var SearchReply_Type_value = map[string]int32{
 	"MATCH":           0,
 	"PROGRESS_UPDATE": 1,
+	"FILE_SUMMARY":    2,
 }
 
 func (x SearchReply_Type) String() string {
 	return proto.EnumName(SearchReply_Type_name, int32(x))
 }
+
 func (SearchReply_Type) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{5, 0}
+	return fileDescriptor_3cfc33f67cd882b8, []int{7, 0}
 }
 
 type FileRequest struct {
@@ -57,16 +96,17 @@ func (m *FileRequest) Reset()         { *m = FileRequest{} }
 func (m *FileRequest) String() string { return proto.CompactTextString(m) }
 func (*FileRequest) ProtoMessage()    {}
 func (*FileRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{0}
+	return fileDescriptor_3cfc33f67cd882b8, []int{0}
 }
+
 func (m *FileRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FileRequest.Unmarshal(m, b)
 }
 func (m *FileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_FileRequest.Marshal(b, m, deterministic)
 }
-func (dst *FileRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_FileRequest.Merge(dst, src)
+func (m *FileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileRequest.Merge(m, src)
 }
 func (m *FileRequest) XXX_Size() int {
 	return xxx_messageInfo_FileRequest.Size(m)
@@ -95,16 +135,17 @@ func (m *FileReply) Reset()         { *m = FileReply{} }
 func (m *FileReply) String() string { return proto.CompactTextString(m) }
 func (*FileReply) ProtoMessage()    {}
 func (*FileReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{1}
+	return fileDescriptor_3cfc33f67cd882b8, []int{1}
 }
+
 func (m *FileReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FileReply.Unmarshal(m, b)
 }
 func (m *FileReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_FileReply.Marshal(b, m, deterministic)
 }
-func (dst *FileReply) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_FileReply.Merge(dst, src)
+func (m *FileReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileReply.Merge(m, src)
 }
 func (m *FileReply) XXX_Size() int {
 	return xxx_messageInfo_FileReply.Size(m)
@@ -126,7 +167,40 @@ type SearchRequest struct {
 	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
 	// Rewritten URL (after RewriteQuery()) with all the parameters that
 	// are relevant for ranking.
-	RewrittenUrl         string   `protobuf:"bytes,2,opt,name=rewritten_url,json=rewrittenUrl,proto3" json:"rewritten_url,omitempty"`
+	RewrittenUrl string `protobuf:"bytes,2,opt,name=rewritten_url,json=rewrittenUrl,proto3" json:"rewritten_url,omitempty"`
+	// Maximum number of matches to send. Once reached, the search is stopped
+	// and the final progress update has truncated set. 0 means no limit.
+	MaxResults uint32 `protobuf:"varint,3,opt,name=max_results,json=maxResults,proto3" json:"max_results,omitempty"`
+	// Number of milliseconds after which the search is stopped and the final
+	// progress update has truncated set. 0 means no deadline.
+	TimeoutMs uint32 `protobuf:"varint,4,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// Match the query case-insensitively, as if it was prefixed with (?i).
+	CaseInsensitive bool `protobuf:"varint,5,opt,name=case_insensitive,json=caseInsensitive,proto3" json:"case_insensitive,omitempty"`
+	// Only match the query at word boundaries, as if it was surrounded by \b.
+	WholeWord bool `protobuf:"varint,6,opt,name=whole_word,json=wholeWord,proto3" json:"whole_word,omitempty"`
+	// Number of lines of context to return before and after each match, at
+	// most 20. Unset means 2 lines, which clients predating context_lines
+	// expect (see Match.ctxp2 etc.).
+	ContextLines *wrappers.UInt32Value `protobuf:"bytes,14,opt,name=context_lines,json=contextLines,proto3" json:"context_lines,omitempty"`
+	// Return every occurrence of the query instead of at most one match per
+	// line. Further occurrences on the same line are sent as separate matches
+	// which only differ in match_range and submatch_ranges.
+	AllMatches bool `protobuf:"varint,8,opt,name=all_matches,json=allMatches,proto3" json:"all_matches,omitempty"`
+	// Send a FILE_SUMMARY reply after the matches of each file.
+	FileSummaries bool `protobuf:"varint,9,opt,name=file_summaries,json=fileSummaries,proto3" json:"file_summaries,omitempty"`
+	// In the FILES_ONLY and COUNT_ONLY modes, no context is gathered,
+	// context_lines and file_summaries are ignored and max_results limits the
+	// number of FILE_SUMMARY replies.
+	ResultMode SearchRequest_ResultMode `protobuf:"varint,10,opt,name=result_mode,json=resultMode,proto3,enum=sourcebackendpb.SearchRequest_ResultMode" json:"result_mode,omitempty"`
+	// Regular expressions which a file must all match (required_patterns),
+	// respectively must not match (excluded_patterns), anywhere in the file
+	// for any results to be returned from that file. They are interpreted
+	// according to case_insensitive and whole_word, just like query.
+	RequiredPatterns []string `protobuf:"bytes,11,rep,name=required_patterns,json=requiredPatterns,proto3" json:"required_patterns,omitempty"`
+	ExcludedPatterns []string `protobuf:"bytes,12,rep,name=excluded_patterns,json=excludedPatterns,proto3" json:"excluded_patterns,omitempty"`
+	// Set Match.file_digest, so that matches in identical files (e.g. copies
+	// of vendored libraries in many packages) can be recognized.
+	FileDigests          bool     `protobuf:"varint,13,opt,name=file_digests,json=fileDigests,proto3" json:"file_digests,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -136,16 +210,17 @@ func (m *SearchRequest) Reset()         { *m = SearchRequest{} }
 func (m *SearchRequest) String() string { return proto.CompactTextString(m) }
 func (*SearchRequest) ProtoMessage()    {}
 func (*SearchRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{2}
+	return fileDescriptor_3cfc33f67cd882b8, []int{2}
 }
+
 func (m *SearchRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SearchRequest.Unmarshal(m, b)
 }
 func (m *SearchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_SearchRequest.Marshal(b, m, deterministic)
 }
-func (dst *SearchRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_SearchRequest.Merge(dst, src)
+func (m *SearchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchRequest.Merge(m, src)
 }
 func (m *SearchRequest) XXX_Size() int {
 	return xxx_messageInfo_SearchRequest.Size(m)
@@ -170,22 +245,165 @@ func (m *SearchRequest) GetRewrittenUrl() string {
 	return ""
 }
 
+func (m *SearchRequest) GetMaxResults() uint32 {
+	if m != nil {
+		return m.MaxResults
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetTimeoutMs() uint32 {
+	if m != nil {
+		return m.TimeoutMs
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetCaseInsensitive() bool {
+	if m != nil {
+		return m.CaseInsensitive
+	}
+	return false
+}
+
+func (m *SearchRequest) GetWholeWord() bool {
+	if m != nil {
+		return m.WholeWord
+	}
+	return false
+}
+
+func (m *SearchRequest) GetContextLines() *wrappers.UInt32Value {
+	if m != nil {
+		return m.ContextLines
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetAllMatches() bool {
+	if m != nil {
+		return m.AllMatches
+	}
+	return false
+}
+
+func (m *SearchRequest) GetFileSummaries() bool {
+	if m != nil {
+		return m.FileSummaries
+	}
+	return false
+}
+
+func (m *SearchRequest) GetResultMode() SearchRequest_ResultMode {
+	if m != nil {
+		return m.ResultMode
+	}
+	return SearchRequest_MATCHES
+}
+
+func (m *SearchRequest) GetRequiredPatterns() []string {
+	if m != nil {
+		return m.RequiredPatterns
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetExcludedPatterns() []string {
+	if m != nil {
+		return m.ExcludedPatterns
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetFileDigests() bool {
+	if m != nil {
+		return m.FileDigests
+	}
+	return false
+}
+
+// Range is a half-open interval [start, end) of byte offsets into
+// Match.context.
+type Range struct {
+	Start                int32    `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End                  int32    `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Range) Reset()         { *m = Range{} }
+func (m *Range) String() string { return proto.CompactTextString(m) }
+func (*Range) ProtoMessage()    {}
+func (*Range) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{3}
+}
+
+func (m *Range) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Range.Unmarshal(m, b)
+}
+func (m *Range) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Range.Marshal(b, m, deterministic)
+}
+func (m *Range) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Range.Merge(m, src)
+}
+func (m *Range) XXX_Size() int {
+	return xxx_messageInfo_Range.Size(m)
+}
+func (m *Range) XXX_DiscardUnknown() {
+	xxx_messageInfo_Range.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Range proto.InternalMessageInfo
+
+func (m *Range) GetStart() int32 {
+	if m != nil {
+		return m.Start
+	}
+	return 0
+}
+
+func (m *Range) GetEnd() int32 {
+	if m != nil {
+		return m.End
+	}
+	return 0
+}
+
 type Match struct {
 	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
 	Line uint32 `protobuf:"varint,2,opt,name=line,proto3" json:"line,omitempty"`
-	// Contents of line-2.
-	Ctxp2 string `protobuf:"bytes,3,opt,name=ctxp2,proto3" json:"ctxp2,omitempty"`
-	// Contents of line-1.
-	Ctxp1 string `protobuf:"bytes,4,opt,name=ctxp1,proto3" json:"ctxp1,omitempty"`
+	// Contents of line-2, line-1, line+1 and line+2. Use before and after
+	// instead, which respect SearchRequest.context_lines.
+	Ctxp2 string `protobuf:"bytes,3,opt,name=ctxp2,proto3" json:"ctxp2,omitempty"` // Deprecated: Do not use.
+	Ctxp1 string `protobuf:"bytes,4,opt,name=ctxp1,proto3" json:"ctxp1,omitempty"` // Deprecated: Do not use.
+	Ctxn1 string `protobuf:"bytes,6,opt,name=ctxn1,proto3" json:"ctxn1,omitempty"` // Deprecated: Do not use.
+	Ctxn2 string `protobuf:"bytes,7,opt,name=ctxn2,proto3" json:"ctxn2,omitempty"` // Deprecated: Do not use.
+	// Contents of the (at most SearchRequest.context_lines) lines before the
+	// line containing the match, in file order.
+	Before []string `protobuf:"bytes,11,rep,name=before,proto3" json:"before,omitempty"`
 	// Contents of the line containing the match.
 	Context string `protobuf:"bytes,5,opt,name=context,proto3" json:"context,omitempty"`
-	// Contents of line+1.
-	Ctxn1 string `protobuf:"bytes,6,opt,name=ctxn1,proto3" json:"ctxn1,omitempty"`
-	// Contents of line+2.
-	Ctxn2                string   `protobuf:"bytes,7,opt,name=ctxn2,proto3" json:"ctxn2,omitempty"`
-	Pathrank             float32  `protobuf:"fixed32,8,opt,name=pathrank,proto3" json:"pathrank,omitempty"`
-	Ranking              float32  `protobuf:"fixed32,9,opt,name=ranking,proto3" json:"ranking,omitempty"`
-	Package              string   `protobuf:"bytes,10,opt,name=package,proto3" json:"package,omitempty"`
+	// Contents of the (at most SearchRequest.context_lines) lines after the
+	// line containing the match, in file order.
+	After []string `protobuf:"bytes,12,rep,name=after,proto3" json:"after,omitempty"`
+	// Position of the match within context.
+	MatchRange *Range `protobuf:"bytes,13,opt,name=match_range,json=matchRange,proto3" json:"match_range,omitempty"`
+	// Positions of the capture groups of the query within context, in order.
+	// Capture groups which did not participate in the match have start and
+	// end set to -1.
+	SubmatchRanges []*Range `protobuf:"bytes,14,rep,name=submatch_ranges,json=submatchRanges,proto3" json:"submatch_ranges,omitempty"`
+	Pathrank       float32  `protobuf:"fixed32,8,opt,name=pathrank,proto3" json:"pathrank,omitempty"`
+	Ranking        float32  `protobuf:"fixed32,9,opt,name=ranking,proto3" json:"ranking,omitempty"`
+	Package        string   `protobuf:"bytes,10,opt,name=package,proto3" json:"package,omitempty"`
+	// SHA-256 digest of the contents of the file, if SearchRequest.file_digests
+	// was set.
+	FileDigest []byte `protobuf:"bytes,15,opt,name=file_digest,json=fileDigest,proto3" json:"file_digest,omitempty"`
+	// Packages containing an identical match (i.e. the same line of a file with
+	// the same file_digest), which dcs-web collapsed into this match. Not set by
+	// source backends.
+	AlsoIn               []string `protobuf:"bytes,16,rep,name=also_in,json=alsoIn,proto3" json:"also_in,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -195,16 +413,17 @@ func (m *Match) Reset()         { *m = Match{} }
 func (m *Match) String() string { return proto.CompactTextString(m) }
 func (*Match) ProtoMessage()    {}
 func (*Match) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{3}
+	return fileDescriptor_3cfc33f67cd882b8, []int{4}
 }
+
 func (m *Match) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Match.Unmarshal(m, b)
 }
 func (m *Match) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_Match.Marshal(b, m, deterministic)
 }
-func (dst *Match) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Match.Merge(dst, src)
+func (m *Match) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Match.Merge(m, src)
 }
 func (m *Match) XXX_Size() int {
 	return xxx_messageInfo_Match.Size(m)
@@ -229,6 +448,7 @@ func (m *Match) GetLine() uint32 {
 	return 0
 }
 
+// Deprecated: Do not use.
 func (m *Match) GetCtxp2() string {
 	if m != nil {
 		return m.Ctxp2
@@ -236,6 +456,7 @@ func (m *Match) GetCtxp2() string {
 	return ""
 }
 
+// Deprecated: Do not use.
 func (m *Match) GetCtxp1() string {
 	if m != nil {
 		return m.Ctxp1
@@ -243,27 +464,57 @@ func (m *Match) GetCtxp1() string {
 	return ""
 }
 
-func (m *Match) GetContext() string {
+// Deprecated: Do not use.
+func (m *Match) GetCtxn1() string {
 	if m != nil {
-		return m.Context
+		return m.Ctxn1
 	}
 	return ""
 }
 
-func (m *Match) GetCtxn1() string {
+// Deprecated: Do not use.
+func (m *Match) GetCtxn2() string {
 	if m != nil {
-		return m.Ctxn1
+		return m.Ctxn2
 	}
 	return ""
 }
 
-func (m *Match) GetCtxn2() string {
+func (m *Match) GetBefore() []string {
 	if m != nil {
-		return m.Ctxn2
+		return m.Before
+	}
+	return nil
+}
+
+func (m *Match) GetContext() string {
+	if m != nil {
+		return m.Context
 	}
 	return ""
 }
 
+func (m *Match) GetAfter() []string {
+	if m != nil {
+		return m.After
+	}
+	return nil
+}
+
+func (m *Match) GetMatchRange() *Range {
+	if m != nil {
+		return m.MatchRange
+	}
+	return nil
+}
+
+func (m *Match) GetSubmatchRanges() []*Range {
+	if m != nil {
+		return m.SubmatchRanges
+	}
+	return nil
+}
+
 func (m *Match) GetPathrank() float32 {
 	if m != nil {
 		return m.Pathrank
@@ -285,9 +536,26 @@ func (m *Match) GetPackage() string {
 	return ""
 }
 
+func (m *Match) GetFileDigest() []byte {
+	if m != nil {
+		return m.FileDigest
+	}
+	return nil
+}
+
+func (m *Match) GetAlsoIn() []string {
+	if m != nil {
+		return m.AlsoIn
+	}
+	return nil
+}
+
 type ProgressUpdate struct {
-	FilesProcessed       uint64   `protobuf:"varint,1,opt,name=files_processed,json=filesProcessed,proto3" json:"files_processed,omitempty"`
-	FilesTotal           uint64   `protobuf:"varint,2,opt,name=files_total,json=filesTotal,proto3" json:"files_total,omitempty"`
+	FilesProcessed uint64 `protobuf:"varint,1,opt,name=files_processed,json=filesProcessed,proto3" json:"files_processed,omitempty"`
+	FilesTotal     uint64 `protobuf:"varint,2,opt,name=files_total,json=filesTotal,proto3" json:"files_total,omitempty"`
+	// Set on the final progress update if the search was stopped before all
+	// files were searched (see SearchRequest.max_results and timeout_ms).
+	Truncated            bool     `protobuf:"varint,3,opt,name=truncated,proto3" json:"truncated,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -297,16 +565,17 @@ func (m *ProgressUpdate) Reset()         { *m = ProgressUpdate{} }
 func (m *ProgressUpdate) String() string { return proto.CompactTextString(m) }
 func (*ProgressUpdate) ProtoMessage()    {}
 func (*ProgressUpdate) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{4}
+	return fileDescriptor_3cfc33f67cd882b8, []int{5}
 }
+
 func (m *ProgressUpdate) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ProgressUpdate.Unmarshal(m, b)
 }
 func (m *ProgressUpdate) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_ProgressUpdate.Marshal(b, m, deterministic)
 }
-func (dst *ProgressUpdate) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_ProgressUpdate.Merge(dst, src)
+func (m *ProgressUpdate) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProgressUpdate.Merge(m, src)
 }
 func (m *ProgressUpdate) XXX_Size() int {
 	return xxx_messageInfo_ProgressUpdate.Size(m)
@@ -331,10 +600,70 @@ func (m *ProgressUpdate) GetFilesTotal() uint64 {
 	return 0
 }
 
+func (m *ProgressUpdate) GetTruncated() bool {
+	if m != nil {
+		return m.Truncated
+	}
+	return false
+}
+
+// FileSummary is sent after all matches of a file were sent. It is not sent
+// for files without matches or whose matches were not all sent (see
+// SearchRequest.max_results and timeout_ms).
+type FileSummary struct {
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// Number of matches in path. Unset in the FILES_ONLY result mode, where
+	// searching a file stops at its first match.
+	Matches              uint32   `protobuf:"varint,2,opt,name=matches,proto3" json:"matches,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileSummary) Reset()         { *m = FileSummary{} }
+func (m *FileSummary) String() string { return proto.CompactTextString(m) }
+func (*FileSummary) ProtoMessage()    {}
+func (*FileSummary) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{6}
+}
+
+func (m *FileSummary) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileSummary.Unmarshal(m, b)
+}
+func (m *FileSummary) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileSummary.Marshal(b, m, deterministic)
+}
+func (m *FileSummary) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileSummary.Merge(m, src)
+}
+func (m *FileSummary) XXX_Size() int {
+	return xxx_messageInfo_FileSummary.Size(m)
+}
+func (m *FileSummary) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileSummary.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileSummary proto.InternalMessageInfo
+
+func (m *FileSummary) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *FileSummary) GetMatches() uint32 {
+	if m != nil {
+		return m.Matches
+	}
+	return 0
+}
+
 type SearchReply struct {
 	Type                 SearchReply_Type `protobuf:"varint,1,opt,name=type,proto3,enum=sourcebackendpb.SearchReply_Type" json:"type,omitempty"`
 	Match                *Match           `protobuf:"bytes,2,opt,name=match,proto3" json:"match,omitempty"`
 	ProgressUpdate       *ProgressUpdate  `protobuf:"bytes,3,opt,name=progress_update,json=progressUpdate,proto3" json:"progress_update,omitempty"`
+	FileSummary          *FileSummary     `protobuf:"bytes,4,opt,name=file_summary,json=fileSummary,proto3" json:"file_summary,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
 	XXX_unrecognized     []byte           `json:"-"`
 	XXX_sizecache        int32            `json:"-"`
@@ -344,16 +673,17 @@ func (m *SearchReply) Reset()         { *m = SearchReply{} }
 func (m *SearchReply) String() string { return proto.CompactTextString(m) }
 func (*SearchReply) ProtoMessage()    {}
 func (*SearchReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{5}
+	return fileDescriptor_3cfc33f67cd882b8, []int{7}
 }
+
 func (m *SearchReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SearchReply.Unmarshal(m, b)
 }
 func (m *SearchReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_SearchReply.Marshal(b, m, deterministic)
 }
-func (dst *SearchReply) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_SearchReply.Merge(dst, src)
+func (m *SearchReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SearchReply.Merge(m, src)
 }
 func (m *SearchReply) XXX_Size() int {
 	return xxx_messageInfo_SearchReply.Size(m)
@@ -385,6 +715,13 @@ func (m *SearchReply) GetProgressUpdate() *ProgressUpdate {
 	return nil
 }
 
+func (m *SearchReply) GetFileSummary() *FileSummary {
+	if m != nil {
+		return m.FileSummary
+	}
+	return nil
+}
+
 type ReplaceIndexRequest struct {
 	ReplacementPath      string   `protobuf:"bytes,1,opt,name=replacement_path,json=replacementPath,proto3" json:"replacement_path,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -396,16 +733,17 @@ func (m *ReplaceIndexRequest) Reset()         { *m = ReplaceIndexRequest{} }
 func (m *ReplaceIndexRequest) String() string { return proto.CompactTextString(m) }
 func (*ReplaceIndexRequest) ProtoMessage()    {}
 func (*ReplaceIndexRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{6}
+	return fileDescriptor_3cfc33f67cd882b8, []int{8}
 }
+
 func (m *ReplaceIndexRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplaceIndexRequest.Unmarshal(m, b)
 }
 func (m *ReplaceIndexRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_ReplaceIndexRequest.Marshal(b, m, deterministic)
 }
-func (dst *ReplaceIndexRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_ReplaceIndexRequest.Merge(dst, src)
+func (m *ReplaceIndexRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplaceIndexRequest.Merge(m, src)
 }
 func (m *ReplaceIndexRequest) XXX_Size() int {
 	return xxx_messageInfo_ReplaceIndexRequest.Size(m)
@@ -433,16 +771,17 @@ func (m *ReplaceIndexReply) Reset()         { *m = ReplaceIndexReply{} }
 func (m *ReplaceIndexReply) String() string { return proto.CompactTextString(m) }
 func (*ReplaceIndexReply) ProtoMessage()    {}
 func (*ReplaceIndexReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_sourcebackend_1a3dc62c025055f3, []int{7}
+	return fileDescriptor_3cfc33f67cd882b8, []int{9}
 }
+
 func (m *ReplaceIndexReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplaceIndexReply.Unmarshal(m, b)
 }
 func (m *ReplaceIndexReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_ReplaceIndexReply.Marshal(b, m, deterministic)
 }
-func (dst *ReplaceIndexReply) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_ReplaceIndexReply.Merge(dst, src)
+func (m *ReplaceIndexReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplaceIndexReply.Merge(m, src)
 }
 func (m *ReplaceIndexReply) XXX_Size() int {
 	return xxx_messageInfo_ReplaceIndexReply.Size(m)
@@ -453,16 +792,466 @@ func (m *ReplaceIndexReply) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ReplaceIndexReply proto.InternalMessageInfo
 
+type ReloadIndexRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadIndexRequest) Reset()         { *m = ReloadIndexRequest{} }
+func (m *ReloadIndexRequest) String() string { return proto.CompactTextString(m) }
+func (*ReloadIndexRequest) ProtoMessage()    {}
+func (*ReloadIndexRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{10}
+}
+
+func (m *ReloadIndexRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadIndexRequest.Unmarshal(m, b)
+}
+func (m *ReloadIndexRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadIndexRequest.Marshal(b, m, deterministic)
+}
+func (m *ReloadIndexRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadIndexRequest.Merge(m, src)
+}
+func (m *ReloadIndexRequest) XXX_Size() int {
+	return xxx_messageInfo_ReloadIndexRequest.Size(m)
+}
+func (m *ReloadIndexRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadIndexRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadIndexRequest proto.InternalMessageInfo
+
+type ReloadIndexReply struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadIndexReply) Reset()         { *m = ReloadIndexReply{} }
+func (m *ReloadIndexReply) String() string { return proto.CompactTextString(m) }
+func (*ReloadIndexReply) ProtoMessage()    {}
+func (*ReloadIndexReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{11}
+}
+
+func (m *ReloadIndexReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadIndexReply.Unmarshal(m, b)
+}
+func (m *ReloadIndexReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadIndexReply.Marshal(b, m, deterministic)
+}
+func (m *ReloadIndexReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadIndexReply.Merge(m, src)
+}
+func (m *ReloadIndexReply) XXX_Size() int {
+	return xxx_messageInfo_ReloadIndexReply.Size(m)
+}
+func (m *ReloadIndexReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadIndexReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadIndexReply proto.InternalMessageInfo
+
+type CapabilitiesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CapabilitiesRequest) Reset()         { *m = CapabilitiesRequest{} }
+func (m *CapabilitiesRequest) String() string { return proto.CompactTextString(m) }
+func (*CapabilitiesRequest) ProtoMessage()    {}
+func (*CapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{12}
+}
+
+func (m *CapabilitiesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CapabilitiesRequest.Unmarshal(m, b)
+}
+func (m *CapabilitiesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CapabilitiesRequest.Marshal(b, m, deterministic)
+}
+func (m *CapabilitiesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CapabilitiesRequest.Merge(m, src)
+}
+func (m *CapabilitiesRequest) XXX_Size() int {
+	return xxx_messageInfo_CapabilitiesRequest.Size(m)
+}
+func (m *CapabilitiesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CapabilitiesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CapabilitiesRequest proto.InternalMessageInfo
+
+type CapabilitiesReply struct {
+	// Whether Search locates case-sensitive literals of fewer than 4 bytes
+	// (see index.IsShortLiteral) using the positional index. Without it, such
+	// queries would require reading all files and are rejected. Requires
+	// -use_positional_index and an index of format version 2 or newer.
+	ShortLiterals        bool     `protobuf:"varint,1,opt,name=short_literals,json=shortLiterals,proto3" json:"short_literals,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CapabilitiesReply) Reset()         { *m = CapabilitiesReply{} }
+func (m *CapabilitiesReply) String() string { return proto.CompactTextString(m) }
+func (*CapabilitiesReply) ProtoMessage()    {}
+func (*CapabilitiesReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{13}
+}
+
+func (m *CapabilitiesReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CapabilitiesReply.Unmarshal(m, b)
+}
+func (m *CapabilitiesReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CapabilitiesReply.Marshal(b, m, deterministic)
+}
+func (m *CapabilitiesReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CapabilitiesReply.Merge(m, src)
+}
+func (m *CapabilitiesReply) XXX_Size() int {
+	return xxx_messageInfo_CapabilitiesReply.Size(m)
+}
+func (m *CapabilitiesReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_CapabilitiesReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CapabilitiesReply proto.InternalMessageInfo
+
+func (m *CapabilitiesReply) GetShortLiterals() bool {
+	if m != nil {
+		return m.ShortLiterals
+	}
+	return false
+}
+
+type TrigramExplanation struct {
+	Trigram []byte `protobuf:"bytes,1,opt,name=trigram,proto3" json:"trigram,omitempty"`
+	// Length of the posting list of the trigram.
+	Entries uint32 `protobuf:"varint,2,opt,name=entries,proto3" json:"entries,omitempty"`
+	// Number of candidate files after the posting list was combined with
+	// those of the preceding trigrams, or -1 if the posting list was not read.
+	Docids               int32    `protobuf:"varint,3,opt,name=docids,proto3" json:"docids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TrigramExplanation) Reset()         { *m = TrigramExplanation{} }
+func (m *TrigramExplanation) String() string { return proto.CompactTextString(m) }
+func (*TrigramExplanation) ProtoMessage()    {}
+func (*TrigramExplanation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{14}
+}
+
+func (m *TrigramExplanation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TrigramExplanation.Unmarshal(m, b)
+}
+func (m *TrigramExplanation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TrigramExplanation.Marshal(b, m, deterministic)
+}
+func (m *TrigramExplanation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TrigramExplanation.Merge(m, src)
+}
+func (m *TrigramExplanation) XXX_Size() int {
+	return xxx_messageInfo_TrigramExplanation.Size(m)
+}
+func (m *TrigramExplanation) XXX_DiscardUnknown() {
+	xxx_messageInfo_TrigramExplanation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TrigramExplanation proto.InternalMessageInfo
+
+func (m *TrigramExplanation) GetTrigram() []byte {
+	if m != nil {
+		return m.Trigram
+	}
+	return nil
+}
+
+func (m *TrigramExplanation) GetEntries() uint32 {
+	if m != nil {
+		return m.Entries
+	}
+	return 0
+}
+
+func (m *TrigramExplanation) GetDocids() int32 {
+	if m != nil {
+		return m.Docids
+	}
+	return 0
+}
+
+type QueryExplanation struct {
+	// One of all, none, and, or.
+	Op string `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	// Trigrams in the order in which they were evaluated.
+	Trigrams []*TrigramExplanation `protobuf:"bytes,2,rep,name=trigrams,proto3" json:"trigrams,omitempty"`
+	// Index into trigrams of the trigram after which the intersection was
+	// stopped early, or -1.
+	StoppedAt int32               `protobuf:"varint,3,opt,name=stopped_at,json=stoppedAt,proto3" json:"stopped_at,omitempty"`
+	Sub       []*QueryExplanation `protobuf:"bytes,4,rep,name=sub,proto3" json:"sub,omitempty"`
+	// Number of candidate files of the query.
+	Docids               uint32   `protobuf:"varint,5,opt,name=docids,proto3" json:"docids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueryExplanation) Reset()         { *m = QueryExplanation{} }
+func (m *QueryExplanation) String() string { return proto.CompactTextString(m) }
+func (*QueryExplanation) ProtoMessage()    {}
+func (*QueryExplanation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{15}
+}
+
+func (m *QueryExplanation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryExplanation.Unmarshal(m, b)
+}
+func (m *QueryExplanation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryExplanation.Marshal(b, m, deterministic)
+}
+func (m *QueryExplanation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryExplanation.Merge(m, src)
+}
+func (m *QueryExplanation) XXX_Size() int {
+	return xxx_messageInfo_QueryExplanation.Size(m)
+}
+func (m *QueryExplanation) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryExplanation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryExplanation proto.InternalMessageInfo
+
+func (m *QueryExplanation) GetOp() string {
+	if m != nil {
+		return m.Op
+	}
+	return ""
+}
+
+func (m *QueryExplanation) GetTrigrams() []*TrigramExplanation {
+	if m != nil {
+		return m.Trigrams
+	}
+	return nil
+}
+
+func (m *QueryExplanation) GetStoppedAt() int32 {
+	if m != nil {
+		return m.StoppedAt
+	}
+	return 0
+}
+
+func (m *QueryExplanation) GetSub() []*QueryExplanation {
+	if m != nil {
+		return m.Sub
+	}
+	return nil
+}
+
+func (m *QueryExplanation) GetDocids() uint32 {
+	if m != nil {
+		return m.Docids
+	}
+	return 0
+}
+
+type ExplainReply struct {
+	// Path of the index shard which the source backend serves.
+	Shard string `protobuf:"bytes,1,opt,name=shard,proto3" json:"shard,omitempty"`
+	// Trigram query (see index.RegexpQuery) which is used to find candidate
+	// files.
+	Query string `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// How the trigram query is evaluated, one explanation per index segment.
+	Explanations []*QueryExplanation `protobuf:"bytes,3,rep,name=explanations,proto3" json:"explanations,omitempty"`
+	// Number of candidate files which need to be searched.
+	Candidates uint32 `protobuf:"varint,4,opt,name=candidates,proto3" json:"candidates,omitempty"`
+	// If set, candidate files are found using the positional index instead
+	// of the trigram query, and positional_plan describes how.
+	PositionalPlan       string   `protobuf:"bytes,5,opt,name=positional_plan,json=positionalPlan,proto3" json:"positional_plan,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExplainReply) Reset()         { *m = ExplainReply{} }
+func (m *ExplainReply) String() string { return proto.CompactTextString(m) }
+func (*ExplainReply) ProtoMessage()    {}
+func (*ExplainReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cfc33f67cd882b8, []int{16}
+}
+
+func (m *ExplainReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExplainReply.Unmarshal(m, b)
+}
+func (m *ExplainReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExplainReply.Marshal(b, m, deterministic)
+}
+func (m *ExplainReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExplainReply.Merge(m, src)
+}
+func (m *ExplainReply) XXX_Size() int {
+	return xxx_messageInfo_ExplainReply.Size(m)
+}
+func (m *ExplainReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExplainReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExplainReply proto.InternalMessageInfo
+
+func (m *ExplainReply) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+func (m *ExplainReply) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *ExplainReply) GetExplanations() []*QueryExplanation {
+	if m != nil {
+		return m.Explanations
+	}
+	return nil
+}
+
+func (m *ExplainReply) GetCandidates() uint32 {
+	if m != nil {
+		return m.Candidates
+	}
+	return 0
+}
+
+func (m *ExplainReply) GetPositionalPlan() string {
+	if m != nil {
+		return m.PositionalPlan
+	}
+	return ""
+}
+
 func init() {
+	proto.RegisterEnum("sourcebackendpb.SearchRequest_ResultMode", SearchRequest_ResultMode_name, SearchRequest_ResultMode_value)
+	proto.RegisterEnum("sourcebackendpb.SearchReply_Type", SearchReply_Type_name, SearchReply_Type_value)
 	proto.RegisterType((*FileRequest)(nil), "sourcebackendpb.FileRequest")
 	proto.RegisterType((*FileReply)(nil), "sourcebackendpb.FileReply")
 	proto.RegisterType((*SearchRequest)(nil), "sourcebackendpb.SearchRequest")
+	proto.RegisterType((*Range)(nil), "sourcebackendpb.Range")
 	proto.RegisterType((*Match)(nil), "sourcebackendpb.Match")
 	proto.RegisterType((*ProgressUpdate)(nil), "sourcebackendpb.ProgressUpdate")
+	proto.RegisterType((*FileSummary)(nil), "sourcebackendpb.FileSummary")
 	proto.RegisterType((*SearchReply)(nil), "sourcebackendpb.SearchReply")
 	proto.RegisterType((*ReplaceIndexRequest)(nil), "sourcebackendpb.ReplaceIndexRequest")
 	proto.RegisterType((*ReplaceIndexReply)(nil), "sourcebackendpb.ReplaceIndexReply")
-	proto.RegisterEnum("sourcebackendpb.SearchReply_Type", SearchReply_Type_name, SearchReply_Type_value)
+	proto.RegisterType((*ReloadIndexRequest)(nil), "sourcebackendpb.ReloadIndexRequest")
+	proto.RegisterType((*ReloadIndexReply)(nil), "sourcebackendpb.ReloadIndexReply")
+	proto.RegisterType((*CapabilitiesRequest)(nil), "sourcebackendpb.CapabilitiesRequest")
+	proto.RegisterType((*CapabilitiesReply)(nil), "sourcebackendpb.CapabilitiesReply")
+	proto.RegisterType((*TrigramExplanation)(nil), "sourcebackendpb.TrigramExplanation")
+	proto.RegisterType((*QueryExplanation)(nil), "sourcebackendpb.QueryExplanation")
+	proto.RegisterType((*ExplainReply)(nil), "sourcebackendpb.ExplainReply")
+}
+
+func init() { proto.RegisterFile("sourcebackend.proto", fileDescriptor_3cfc33f67cd882b8) }
+
+var fileDescriptor_3cfc33f67cd882b8 = []byte{
+	// 1374 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0xdb, 0x72, 0xdb, 0x36,
+	0x13, 0xb6, 0x64, 0xc9, 0x96, 0x56, 0x27, 0x06, 0xce, 0x9f, 0x9f, 0xa3, 0xc9, 0xc1, 0x66, 0xfe,
+	0x4c, 0x9c, 0xf9, 0x3b, 0x72, 0xa3, 0xf4, 0xdc, 0x8b, 0xd4, 0x4e, 0x9c, 0xc6, 0x1e, 0x3b, 0x51,
+	0x21, 0xbb, 0x99, 0xe4, 0x86, 0x85, 0x48, 0x58, 0xe2, 0x84, 0x02, 0x19, 0x00, 0xac, 0xa5, 0x27,
+	0xeb, 0x3b, 0xf4, 0xa6, 0x0f, 0xd1, 0xab, 0xbe, 0x43, 0x2f, 0x3a, 0x00, 0x48, 0x89, 0xb2, 0x14,
+	0xa7, 0x57, 0xe4, 0x7e, 0x7b, 0x00, 0x76, 0xf1, 0xed, 0x02, 0xb0, 0x25, 0xa2, 0x84, 0x7b, 0x74,
+	0x40, 0xbc, 0xf7, 0x94, 0xf9, 0x9d, 0x98, 0x47, 0x32, 0x42, 0xad, 0x05, 0x30, 0x1e, 0xb4, 0xef,
+	0x0e, 0xa3, 0x68, 0x18, 0xd2, 0x3d, 0xad, 0x1e, 0x24, 0x17, 0x7b, 0x97, 0x9c, 0xc4, 0x31, 0xe5,
+	0xc2, 0x38, 0x38, 0x3b, 0x50, 0x7b, 0x11, 0x84, 0x14, 0xd3, 0x0f, 0x09, 0x15, 0x12, 0x21, 0x28,
+	0xc5, 0x44, 0x8e, 0xec, 0xc2, 0x76, 0x61, 0xb7, 0x8a, 0xf5, 0xbf, 0xf3, 0x10, 0xaa, 0xc6, 0x24,
+	0x0e, 0xa7, 0xa8, 0x0d, 0x15, 0x2f, 0x62, 0x92, 0x32, 0x29, 0xb4, 0x51, 0x1d, 0xcf, 0x64, 0xe7,
+	0xaf, 0x12, 0x34, 0xfa, 0x94, 0x70, 0x6f, 0x94, 0x85, 0xbb, 0x09, 0xe5, 0x0f, 0x09, 0xe5, 0xd3,
+	0x34, 0x9e, 0x11, 0xd0, 0x7d, 0x68, 0x70, 0x7a, 0xc9, 0x03, 0x29, 0x29, 0x73, 0x13, 0x1e, 0xda,
+	0x45, 0xad, 0xad, 0xcf, 0xc0, 0x73, 0x1e, 0xa2, 0x7b, 0x50, 0x1b, 0x93, 0x89, 0xcb, 0xa9, 0x48,
+	0x42, 0x29, 0xec, 0xf5, 0xed, 0xc2, 0x6e, 0x03, 0xc3, 0x98, 0x4c, 0xb0, 0x41, 0xd0, 0x1d, 0x00,
+	0x19, 0x8c, 0x69, 0x94, 0x48, 0x77, 0x2c, 0xec, 0x92, 0xd6, 0x57, 0x53, 0xe4, 0x54, 0xa0, 0x47,
+	0x60, 0x79, 0x44, 0x50, 0x37, 0x60, 0x82, 0x32, 0x11, 0xc8, 0xe0, 0x57, 0x6a, 0x97, 0xb7, 0x0b,
+	0xbb, 0x15, 0xdc, 0x52, 0xf8, 0xd1, 0x1c, 0x56, 0x91, 0x2e, 0x47, 0x51, 0x48, 0xdd, 0xcb, 0x88,
+	0xfb, 0xf6, 0x86, 0x36, 0xaa, 0x6a, 0xe4, 0x4d, 0xc4, 0x7d, 0xb4, 0x0f, 0x0d, 0x9d, 0xe2, 0x44,
+	0xba, 0x61, 0xc0, 0xa8, 0xb0, 0x9b, 0xdb, 0x85, 0xdd, 0x5a, 0xf7, 0x76, 0xc7, 0x94, 0xb6, 0x93,
+	0x95, 0xb6, 0x73, 0x7e, 0xc4, 0xe4, 0x93, 0xee, 0xcf, 0x24, 0x4c, 0x28, 0xae, 0xa7, 0x2e, 0x27,
+	0xca, 0x43, 0x25, 0x43, 0xc2, 0xd0, 0x1d, 0x13, 0xe9, 0x8d, 0xa8, 0xb0, 0x2b, 0x7a, 0x09, 0x20,
+	0x61, 0x78, 0x6a, 0x10, 0xf4, 0x00, 0x9a, 0x17, 0x41, 0x48, 0x5d, 0x91, 0x8c, 0xc7, 0x84, 0x07,
+	0x54, 0xd8, 0x55, 0x6d, 0xd3, 0x50, 0x68, 0x3f, 0x03, 0xd1, 0x31, 0xd4, 0x4c, 0x41, 0xdc, 0x71,
+	0xe4, 0x53, 0x1b, 0xb6, 0x0b, 0xbb, 0xcd, 0xee, 0xa3, 0xce, 0x95, 0x43, 0xef, 0x2c, 0x1c, 0x42,
+	0xc7, 0x14, 0xec, 0x34, 0xf2, 0x29, 0x06, 0x3e, 0xfb, 0x47, 0xff, 0x87, 0x1b, 0x9c, 0x7e, 0x48,
+	0x02, 0x4e, 0x7d, 0x37, 0x26, 0x52, 0x52, 0xce, 0x84, 0x5d, 0xdb, 0x5e, 0xdf, 0xad, 0x62, 0x2b,
+	0x53, 0xf4, 0x52, 0x5c, 0x19, 0xd3, 0x89, 0x17, 0x26, 0x7e, 0xde, 0xb8, 0x6e, 0x8c, 0x33, 0xc5,
+	0xcc, 0x78, 0x07, 0xea, 0x3a, 0x19, 0x3f, 0x18, 0x52, 0x21, 0x85, 0xdd, 0xd0, 0xa9, 0xd4, 0x14,
+	0xf6, 0xdc, 0x40, 0xce, 0xb7, 0x00, 0xf3, 0x6d, 0xa1, 0x1a, 0x6c, 0x9e, 0xee, 0x9f, 0x3d, 0x7b,
+	0x79, 0xd8, 0xb7, 0xd6, 0x50, 0x13, 0xe0, 0xc5, 0xd1, 0xc9, 0x61, 0xdf, 0x7d, 0xfd, 0xea, 0xe4,
+	0xad, 0x55, 0x50, 0xf2, 0xb3, 0xd7, 0xe7, 0xaf, 0xce, 0x8c, 0x5c, 0x3c, 0x2e, 0x55, 0x36, 0xad,
+	0x8a, 0xb3, 0x07, 0x65, 0x4c, 0xd8, 0x90, 0x2a, 0x8a, 0x09, 0x49, 0xb8, 0xd4, 0x14, 0x2b, 0x63,
+	0x23, 0x20, 0x0b, 0xd6, 0x29, 0xf3, 0x35, 0xb1, 0xca, 0x58, 0xfd, 0x3a, 0x7f, 0xae, 0x43, 0x59,
+	0x57, 0x7b, 0x15, 0xc7, 0x15, 0xa6, 0xce, 0x56, 0x3b, 0x34, 0xb0, 0xfe, 0x47, 0x36, 0x94, 0x3d,
+	0x39, 0x89, 0xbb, 0x9a, 0x7b, 0xd5, 0x83, 0xa2, 0x5d, 0xc0, 0x06, 0xc8, 0x34, 0x8f, 0xed, 0xd2,
+	0xa2, 0xe6, 0x71, 0xaa, 0x61, 0x8f, 0xed, 0x8d, 0x05, 0x0d, 0x9b, 0x69, 0xba, 0xf6, 0xe6, 0xa2,
+	0xa6, 0x8b, 0x6e, 0xc1, 0xc6, 0x80, 0x5e, 0x44, 0x9c, 0xa6, 0xd5, 0x4f, 0x25, 0x64, 0xc3, 0x66,
+	0x4a, 0x22, 0x4d, 0xdc, 0x2a, 0xce, 0x44, 0x95, 0x33, 0xb9, 0x90, 0x94, 0xa7, 0x27, 0x60, 0x04,
+	0xf4, 0xb5, 0xea, 0x18, 0xe9, 0x8d, 0x5c, 0xae, 0x0a, 0xa3, 0xab, 0x5e, 0xeb, 0xde, 0x5a, 0x22,
+	0x87, 0x2e, 0x9b, 0xea, 0x24, 0xe9, 0x8d, 0xf4, 0x3f, 0x7a, 0x0a, 0x2d, 0x91, 0x0c, 0x72, 0xbe,
+	0x8a, 0xe2, 0xeb, 0xd7, 0x38, 0x37, 0x33, 0x73, 0x2d, 0x0a, 0x35, 0x14, 0x54, 0x15, 0x39, 0x61,
+	0xef, 0x35, 0xb7, 0x8b, 0x78, 0x26, 0xab, 0x2c, 0xd4, 0x37, 0x60, 0x43, 0x4d, 0xe9, 0x22, 0xce,
+	0x44, 0xa5, 0x89, 0x89, 0xf7, 0x9e, 0x0c, 0x0d, 0x91, 0xab, 0x38, 0x13, 0x55, 0xbb, 0xe4, 0x08,
+	0x64, 0xb7, 0xf4, 0x9c, 0x81, 0x39, 0x7f, 0xd0, 0x7f, 0x61, 0x93, 0x84, 0x22, 0x72, 0x03, 0x66,
+	0x5b, 0xa6, 0x66, 0x4a, 0x3c, 0x62, 0xce, 0x04, 0x9a, 0x3d, 0x1e, 0x0d, 0x39, 0x15, 0xe2, 0x3c,
+	0xf6, 0x89, 0xa4, 0xe8, 0x21, 0xb4, 0x94, 0xa3, 0x70, 0x63, 0x1e, 0x79, 0x54, 0x08, 0xea, 0xeb,
+	0x83, 0x2f, 0x61, 0xdd, 0x70, 0xa2, 0x97, 0xa1, 0xd9, 0xa2, 0xc2, 0x95, 0x91, 0x24, 0x66, 0x26,
+	0x95, 0xcc, 0xa2, 0xe2, 0x4c, 0x21, 0xe8, 0x36, 0x54, 0x25, 0x4f, 0x98, 0x47, 0x24, 0xf5, 0x35,
+	0x27, 0x2a, 0x78, 0x0e, 0x38, 0xdf, 0x9b, 0x41, 0x6a, 0x7a, 0x75, 0xba, 0x92, 0x64, 0x36, 0x6c,
+	0x66, 0x13, 0xc0, 0xf0, 0x2c, 0x13, 0x9d, 0xdf, 0x8a, 0x50, 0xcb, 0x9a, 0x56, 0x4d, 0xd9, 0x2f,
+	0xa1, 0x24, 0xa7, 0x31, 0xd5, 0xde, 0xcd, 0xee, 0xce, 0x47, 0x1b, 0x3c, 0x0e, 0xa7, 0x9d, 0xb3,
+	0x69, 0x4c, 0xb1, 0x36, 0x47, 0x9f, 0x41, 0x59, 0x47, 0xd4, 0xe1, 0x57, 0x1d, 0x9f, 0x6e, 0x00,
+	0x6c, 0x8c, 0xd0, 0x4b, 0x68, 0xc5, 0x69, 0xad, 0xdc, 0x44, 0x17, 0x4b, 0x67, 0x55, 0xeb, 0xde,
+	0x5b, 0xf2, 0x5b, 0xac, 0x29, 0x6e, 0xc6, 0x8b, 0x35, 0x7e, 0x0a, 0xf5, 0xdc, 0xf4, 0x9a, 0xda,
+	0xa5, 0x74, 0x40, 0x5e, 0x0d, 0x93, 0x2b, 0x90, 0x19, 0x07, 0xa9, 0xe0, 0x7c, 0x03, 0x25, 0x95,
+	0x06, 0xaa, 0x42, 0x59, 0x0f, 0x02, 0x6b, 0x0d, 0x6d, 0x41, 0xab, 0x87, 0x5f, 0xff, 0x88, 0x0f,
+	0xfb, 0x7d, 0xf7, 0xbc, 0xf7, 0x7c, 0xff, 0xec, 0xd0, 0x2a, 0x20, 0x0b, 0xea, 0x6a, 0x36, 0xb8,
+	0xfd, 0xf3, 0xd3, 0xd3, 0x7d, 0xfc, 0xd6, 0x2a, 0x3a, 0x3f, 0xc0, 0x96, 0x2a, 0x03, 0xf1, 0xe8,
+	0x11, 0xf3, 0xe9, 0x24, 0xbb, 0x78, 0x1e, 0x81, 0xc5, 0x0d, 0x3c, 0xa6, 0x4c, 0xba, 0xb9, 0xa3,
+	0x68, 0xe5, 0xf0, 0x9e, 0xba, 0xde, 0xb6, 0xe0, 0xc6, 0x62, 0x84, 0x38, 0x9c, 0x3a, 0x37, 0x01,
+	0x61, 0x1a, 0x46, 0xc4, 0xcf, 0x47, 0x75, 0x10, 0x58, 0x0b, 0xa8, 0xb2, 0xfc, 0x0f, 0x6c, 0x3d,
+	0x23, 0x31, 0x19, 0x04, 0x61, 0x20, 0x03, 0x2a, 0x32, 0xd3, 0xef, 0xe0, 0xc6, 0x22, 0xac, 0x8e,
+	0xf5, 0x01, 0x34, 0xc5, 0x28, 0xe2, 0xea, 0x1e, 0x91, 0x94, 0x93, 0xd0, 0x5c, 0xa1, 0x15, 0xdc,
+	0xd0, 0xe8, 0x49, 0x0a, 0x3a, 0xbf, 0x00, 0x3a, 0xe3, 0xc1, 0x90, 0x93, 0xf1, 0xe1, 0x24, 0x0e,
+	0x09, 0x23, 0x32, 0x88, 0x98, 0x62, 0x8f, 0x34, 0x68, 0x7a, 0xf1, 0x66, 0xa2, 0xd2, 0x50, 0x26,
+	0xf5, 0xad, 0x91, 0xf2, 0x2a, 0x15, 0xd5, 0x68, 0xf1, 0x23, 0x2f, 0xf0, 0xcd, 0xfd, 0x59, 0xc6,
+	0xa9, 0xe4, 0xfc, 0x51, 0x00, 0xeb, 0x27, 0x75, 0x17, 0xe7, 0x17, 0x68, 0x42, 0x31, 0x8a, 0xd3,
+	0x2a, 0x15, 0xa3, 0x18, 0x3d, 0x85, 0x4a, 0xba, 0x82, 0x8a, 0xab, 0xe6, 0xc1, 0xfd, 0xa5, 0x13,
+	0x5d, 0xde, 0x27, 0x9e, 0x39, 0xa9, 0x7b, 0x55, 0xc8, 0x28, 0x8e, 0xa9, 0xef, 0x12, 0x99, 0xee,
+	0xa0, 0x9a, 0x22, 0xfb, 0x12, 0x3d, 0x81, 0x75, 0x91, 0x0c, 0xec, 0x92, 0x0e, 0xbd, 0xcc, 0xf1,
+	0xab, 0xfb, 0xc3, 0xca, 0x3a, 0x97, 0x51, 0x59, 0xa7, 0x9a, 0x65, 0xf4, 0x7b, 0x01, 0xea, 0xda,
+	0x38, 0x60, 0xa6, 0xd6, 0xea, 0x5e, 0x18, 0x11, 0xee, 0x67, 0x4f, 0x0f, 0x2d, 0xcc, 0x1f, 0x24,
+	0xc5, 0xfc, 0x83, 0xe4, 0x10, 0xea, 0x74, 0xbe, 0x90, 0x2a, 0xd6, 0xbf, 0xdc, 0xd2, 0x82, 0x1b,
+	0xba, 0x0b, 0xe0, 0x11, 0xe6, 0x07, 0xaa, 0x27, 0xb2, 0x17, 0x49, 0x0e, 0x51, 0xa3, 0x28, 0x8e,
+	0xd4, 0x9b, 0x23, 0x62, 0x24, 0x74, 0x95, 0x63, 0x3a, 0xd8, 0x9b, 0x73, 0xb8, 0x17, 0x12, 0xd6,
+	0xfd, 0x7b, 0x1d, 0x1a, 0x7d, 0xbd, 0xf6, 0x81, 0x59, 0x1b, 0x1d, 0x40, 0x49, 0x35, 0x0f, 0x5a,
+	0xdd, 0x53, 0x29, 0xe9, 0xda, 0xed, 0x8f, 0x68, 0x15, 0x4f, 0xd7, 0xd0, 0x31, 0x6c, 0x98, 0xb9,
+	0x81, 0xee, 0x5e, 0xff, 0x62, 0x68, 0xdf, 0xbe, 0x6e, 0xe0, 0x38, 0x6b, 0x9f, 0x17, 0xd0, 0x31,
+	0x6c, 0xa6, 0xd5, 0xfe, 0x64, 0xb0, 0x3b, 0x4b, 0xfa, 0xfc, 0x39, 0x39, 0x6b, 0xe8, 0x1d, 0xd4,
+	0xf3, 0xad, 0x82, 0xfe, 0xb7, 0xe4, 0xb0, 0xa2, 0xc1, 0xda, 0xce, 0x27, 0xac, 0x66, 0xb1, 0xf3,
+	0xcd, 0xbd, 0x22, 0xf6, 0x8a, 0xe9, 0xd1, 0x76, 0x3e, 0x61, 0x65, 0x62, 0xbf, 0x81, 0x5a, 0x6e,
+	0x1a, 0xa0, 0xfb, 0x2b, 0x9c, 0xae, 0x4e, 0x90, 0xf6, 0xce, 0xf5, 0x46, 0x3a, 0xf0, 0xc1, 0x57,
+	0xef, 0xbe, 0x18, 0x06, 0x72, 0x94, 0x0c, 0x3a, 0x5e, 0x34, 0xde, 0x7b, 0x4e, 0x07, 0x01, 0x61,
+	0x7b, 0xbe, 0x27, 0xf6, 0x02, 0xa6, 0x1e, 0x58, 0x24, 0x34, 0xaf, 0xf9, 0xbd, 0x2b, 0xa1, 0x06,
+	0x1b, 0x1a, 0x7e, 0xf2, 0xcf, 0x00, 0xcc, 0x5f, 0xe4, 0x5d, 0x1a, 0x0c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -481,10 +1270,18 @@ type SourceBackendClient interface {
 	File(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileReply, error)
 	// Search performs the given query and streams matches/progress updates.
 	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (SourceBackend_SearchClient, error)
+	// Explain describes how Search finds the candidate files for the given
+	// query, without searching.
+	Explain(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*ExplainReply, error)
+	// Capabilities describes which queries Search can answer from the index.
+	Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesReply, error)
 	// Replaces the loaded index with the specified replacement index. On a file
 	// system level, the specified file is mv'ed to the file specified by
 	// -index_path.
 	ReplaceIndex(ctx context.Context, in *ReplaceIndexRequest, opts ...grpc.CallOption) (*ReplaceIndexReply, error)
+	// Re-opens the index specified by -index_path, e.g. after a segment was
+	// appended to it.
+	ReloadIndex(ctx context.Context, in *ReloadIndexRequest, opts ...grpc.CallOption) (*ReloadIndexReply, error)
 }
 
 type sourceBackendClient struct {
@@ -536,6 +1333,24 @@ func (x *sourceBackendSearchClient) Recv() (*SearchReply, error) {
 	return m, nil
 }
 
+func (c *sourceBackendClient) Explain(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*ExplainReply, error) {
+	out := new(ExplainReply)
+	err := c.cc.Invoke(ctx, "/sourcebackendpb.SourceBackend/Explain", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sourceBackendClient) Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesReply, error) {
+	out := new(CapabilitiesReply)
+	err := c.cc.Invoke(ctx, "/sourcebackendpb.SourceBackend/Capabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *sourceBackendClient) ReplaceIndex(ctx context.Context, in *ReplaceIndexRequest, opts ...grpc.CallOption) (*ReplaceIndexReply, error) {
 	out := new(ReplaceIndexReply)
 	err := c.cc.Invoke(ctx, "/sourcebackendpb.SourceBackend/ReplaceIndex", in, out, opts...)
@@ -545,16 +1360,56 @@ func (c *sourceBackendClient) ReplaceIndex(ctx context.Context, in *ReplaceIndex
 	return out, nil
 }
 
+func (c *sourceBackendClient) ReloadIndex(ctx context.Context, in *ReloadIndexRequest, opts ...grpc.CallOption) (*ReloadIndexReply, error) {
+	out := new(ReloadIndexReply)
+	err := c.cc.Invoke(ctx, "/sourcebackendpb.SourceBackend/ReloadIndex", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SourceBackendServer is the server API for SourceBackend service.
 type SourceBackendServer interface {
 	// File reads the file and returns its contents.
 	File(context.Context, *FileRequest) (*FileReply, error)
 	// Search performs the given query and streams matches/progress updates.
 	Search(*SearchRequest, SourceBackend_SearchServer) error
+	// Explain describes how Search finds the candidate files for the given
+	// query, without searching.
+	Explain(context.Context, *SearchRequest) (*ExplainReply, error)
+	// Capabilities describes which queries Search can answer from the index.
+	Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesReply, error)
 	// Replaces the loaded index with the specified replacement index. On a file
 	// system level, the specified file is mv'ed to the file specified by
 	// -index_path.
 	ReplaceIndex(context.Context, *ReplaceIndexRequest) (*ReplaceIndexReply, error)
+	// Re-opens the index specified by -index_path, e.g. after a segment was
+	// appended to it.
+	ReloadIndex(context.Context, *ReloadIndexRequest) (*ReloadIndexReply, error)
+}
+
+// UnimplementedSourceBackendServer can be embedded to have forward compatible implementations.
+type UnimplementedSourceBackendServer struct {
+}
+
+func (*UnimplementedSourceBackendServer) File(ctx context.Context, req *FileRequest) (*FileReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method File not implemented")
+}
+func (*UnimplementedSourceBackendServer) Search(req *SearchRequest, srv SourceBackend_SearchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (*UnimplementedSourceBackendServer) Explain(ctx context.Context, req *SearchRequest) (*ExplainReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Explain not implemented")
+}
+func (*UnimplementedSourceBackendServer) Capabilities(ctx context.Context, req *CapabilitiesRequest) (*CapabilitiesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Capabilities not implemented")
+}
+func (*UnimplementedSourceBackendServer) ReplaceIndex(ctx context.Context, req *ReplaceIndexRequest) (*ReplaceIndexReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplaceIndex not implemented")
+}
+func (*UnimplementedSourceBackendServer) ReloadIndex(ctx context.Context, req *ReloadIndexRequest) (*ReloadIndexReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadIndex not implemented")
 }
 
 func RegisterSourceBackendServer(s *grpc.Server, srv SourceBackendServer) {
@@ -600,6 +1455,42 @@ func (x *sourceBackendSearchServer) Send(m *SearchReply) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _SourceBackend_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sourcebackendpb.SourceBackend/Explain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).Explain(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SourceBackend_Capabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).Capabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sourcebackendpb.SourceBackend/Capabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).Capabilities(ctx, req.(*CapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _SourceBackend_ReplaceIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReplaceIndexRequest)
 	if err := dec(in); err != nil {
@@ -618,6 +1509,24 @@ func _SourceBackend_ReplaceIndex_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SourceBackend_ReloadIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadIndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).ReloadIndex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sourcebackendpb.SourceBackend/ReloadIndex",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).ReloadIndex(ctx, req.(*ReloadIndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "sourcebackendpb.SourceBackend",
 	HandlerType: (*SourceBackendServer)(nil),
@@ -626,10 +1535,22 @@ var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 			MethodName: "File",
 			Handler:    _SourceBackend_File_Handler,
 		},
+		{
+			MethodName: "Explain",
+			Handler:    _SourceBackend_Explain_Handler,
+		},
+		{
+			MethodName: "Capabilities",
+			Handler:    _SourceBackend_Capabilities_Handler,
+		},
 		{
 			MethodName: "ReplaceIndex",
 			Handler:    _SourceBackend_ReplaceIndex_Handler,
 		},
+		{
+			MethodName: "ReloadIndex",
+			Handler:    _SourceBackend_ReloadIndex_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -640,46 +1561,3 @@ var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "sourcebackend.proto",
 }
-
-func init() { proto.RegisterFile("sourcebackend.proto", fileDescriptor_sourcebackend_1a3dc62c025055f3) }
-
-var fileDescriptor_sourcebackend_1a3dc62c025055f3 = []byte{
-	// 582 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x54, 0x5f, 0x6f, 0xda, 0x3e,
-	0x14, 0x6d, 0xfa, 0x0b, 0x6d, 0xb9, 0x14, 0xe8, 0xcf, 0x4c, 0x53, 0x84, 0xaa, 0xb5, 0xcd, 0xa6,
-	0xb5, 0x93, 0x26, 0x18, 0xd9, 0x9f, 0xe7, 0xb5, 0x6b, 0xb7, 0xae, 0x52, 0x35, 0x64, 0xe8, 0x0b,
-	0x2f, 0xc8, 0x84, 0x3b, 0x88, 0x08, 0x8e, 0xeb, 0x38, 0x1a, 0xf9, 0xbe, 0xfb, 0x02, 0x7b, 0xde,
-	0xcb, 0x64, 0x87, 0x50, 0x28, 0xed, 0xf6, 0x44, 0xce, 0xf1, 0xf1, 0xbd, 0xe7, 0xfe, 0x31, 0x50,
-	0x8b, 0xa3, 0x44, 0xfa, 0x38, 0x60, 0xfe, 0x04, 0xf9, 0xb0, 0x21, 0x64, 0xa4, 0x22, 0x52, 0x5d,
-	0x21, 0xc5, 0xc0, 0x3d, 0x82, 0xd2, 0xe7, 0x20, 0x44, 0x8a, 0xb7, 0x09, 0xc6, 0x8a, 0x10, 0xb0,
-	0x05, 0x53, 0x63, 0xc7, 0x3a, 0xb4, 0x4e, 0x8a, 0xd4, 0x7c, 0xbb, 0xc7, 0x50, 0xcc, 0x24, 0x22,
-	0x4c, 0x49, 0x1d, 0x76, 0xfc, 0x88, 0x2b, 0xe4, 0x2a, 0x36, 0xa2, 0x5d, 0xba, 0xc0, 0xee, 0x15,
-	0x94, 0x3b, 0xc8, 0xa4, 0x3f, 0xce, 0xa3, 0x3d, 0x81, 0xc2, 0x6d, 0x82, 0x32, 0x9d, 0x87, 0xcb,
-	0x00, 0x79, 0x0e, 0x65, 0x89, 0x3f, 0x64, 0xa0, 0x14, 0xf2, 0x7e, 0x22, 0x43, 0x67, 0xd3, 0x9c,
-	0xee, 0x2e, 0xc8, 0x1b, 0x19, 0xba, 0xbf, 0x2c, 0x28, 0x5c, 0x33, 0xe5, 0x8f, 0x1f, 0xb2, 0xa4,
-	0xb9, 0x30, 0xe0, 0x68, 0x6e, 0x96, 0xa9, 0xf9, 0xd6, 0xc9, 0x7c, 0x35, 0x13, 0x9e, 0xf3, 0x5f,
-	0x96, 0xcc, 0x80, 0x9c, 0x6d, 0x39, 0xf6, 0x1d, 0xdb, 0x22, 0x0e, 0x6c, 0x1b, 0xd7, 0x33, 0xe5,
-	0x14, 0x0c, 0x9f, 0xc3, 0xb9, 0x9e, 0xb7, 0x9c, 0xad, 0x85, 0x9e, 0xb7, 0x72, 0xd6, 0x73, 0xb6,
-	0xef, 0x58, 0x4f, 0xf7, 0x42, 0xbb, 0x91, 0x8c, 0x4f, 0x9c, 0x9d, 0x43, 0xeb, 0x64, 0x93, 0x2e,
-	0xb0, 0xce, 0xa0, 0x7f, 0x03, 0x3e, 0x72, 0x8a, 0xe6, 0x28, 0x87, 0xfa, 0x44, 0x30, 0x7f, 0xc2,
-	0x46, 0xe8, 0x40, 0x96, 0x7b, 0x0e, 0xdd, 0x1e, 0x54, 0xda, 0x32, 0x1a, 0x49, 0x8c, 0xe3, 0x1b,
-	0x31, 0x64, 0x0a, 0xc9, 0x31, 0x54, 0xbf, 0x07, 0x21, 0xc6, 0x7d, 0x21, 0x23, 0x1f, 0xe3, 0x18,
-	0x87, 0xa6, 0x0d, 0x36, 0xad, 0x18, 0xba, 0x9d, 0xb3, 0xe4, 0x00, 0x4a, 0x99, 0x50, 0x45, 0x8a,
-	0x65, 0x1d, 0xb5, 0x29, 0x18, 0xaa, 0xab, 0x19, 0xf7, 0xa7, 0x05, 0xa5, 0x7c, 0x38, 0x7a, 0x8e,
-	0xef, 0xc1, 0x56, 0xa9, 0x40, 0x13, 0xae, 0xe2, 0x1d, 0x35, 0xee, 0xed, 0x45, 0x63, 0x49, 0xdb,
-	0xe8, 0xa6, 0x02, 0xa9, 0x91, 0x93, 0xd7, 0x50, 0x98, 0xea, 0xa9, 0x98, 0x0c, 0x25, 0xef, 0xe9,
-	0xda, 0x3d, 0x33, 0x33, 0x9a, 0x89, 0xc8, 0x25, 0x54, 0xc5, 0xbc, 0xa0, 0x7e, 0x62, 0x2a, 0x32,
-	0xc3, 0x29, 0x79, 0x07, 0x6b, 0xf7, 0x56, 0x0b, 0xa7, 0x15, 0xb1, 0x82, 0xdd, 0x97, 0x60, 0x6b,
-	0x17, 0xa4, 0x08, 0x85, 0xeb, 0xd3, 0xee, 0xa7, 0xcb, 0xbd, 0x0d, 0x52, 0x83, 0x6a, 0x9b, 0x7e,
-	0xfb, 0x42, 0x2f, 0x3a, 0x9d, 0xfe, 0x4d, 0xfb, 0xfc, 0xb4, 0x7b, 0xb1, 0x67, 0xb9, 0x1f, 0xa1,
-	0xa6, 0x3d, 0x33, 0x1f, 0xbf, 0xf2, 0x21, 0xce, 0xf2, 0x45, 0x7c, 0x05, 0x7b, 0x32, 0xa3, 0xa7,
-	0xc8, 0x55, 0x7f, 0x69, 0x9f, 0xaa, 0x4b, 0x7c, 0x5b, 0x6f, 0x7b, 0x0d, 0xfe, 0x5f, 0x8d, 0x20,
-	0xc2, 0xd4, 0xfb, 0x6d, 0x41, 0xb9, 0x63, 0x1c, 0x9f, 0x65, 0x8e, 0xc9, 0x19, 0xd8, 0xfa, 0x51,
-	0x90, 0xfd, 0xb5, 0x4a, 0x96, 0x9e, 0x53, 0xbd, 0xfe, 0xc8, 0xa9, 0x08, 0x53, 0x77, 0x83, 0x5c,
-	0xc1, 0x56, 0xd6, 0x66, 0xf2, 0xec, 0xd1, 0xfe, 0x67, 0x71, 0xf6, 0xff, 0x36, 0x1f, 0x77, 0xe3,
-	0x8d, 0x45, 0x7a, 0xb0, 0xbb, 0x6c, 0x9b, 0xbc, 0x58, 0xbb, 0xf1, 0x40, 0x5f, 0xea, 0xee, 0x3f,
-	0x54, 0x26, 0xfa, 0xd9, 0x87, 0xde, 0xbb, 0x51, 0xa0, 0xc6, 0xc9, 0xa0, 0xe1, 0x47, 0xd3, 0xe6,
-	0x39, 0x0e, 0x02, 0xc6, 0x9b, 0x43, 0x3f, 0x6e, 0x06, 0x5c, 0xa1, 0xe4, 0x2c, 0x6c, 0x9a, 0x3f,
-	0x97, 0xe6, 0xbd, 0x58, 0x83, 0x2d, 0x43, 0xbf, 0xfd, 0x13, 0x00, 0x00, 0xff, 0xff, 0x4b, 0x0a,
-	0x96, 0x6b, 0x8a, 0x04, 0x00, 0x00,
-}
@@ -0,0 +1,154 @@
+package sourcebackend
+
+import (
+	"context"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/Debian/dcs/internal/index"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/regexp"
+)
+
+var queryOps = map[index.QueryOp]string{
+	index.QAll:  "all",
+	index.QNone: "none",
+	index.QAnd:  "and",
+	index.QOr:   "or",
+}
+
+func explanationProto(ex *index.QueryExplanation) *sourcebackendpb.QueryExplanation {
+	pb := &sourcebackendpb.QueryExplanation{
+		Op:        queryOps[ex.Op],
+		StoppedAt: int32(ex.StoppedAt),
+		Docids:    uint32(ex.Docids),
+	}
+	for _, te := range ex.Trigrams {
+		pb.Trigrams = append(pb.Trigrams, &sourcebackendpb.TrigramExplanation{
+			Trigram: []byte{byte(te.Trigram >> 16), byte(te.Trigram >> 8), byte(te.Trigram)},
+			Entries: te.Entries,
+			Docids:  int32(te.Docids),
+		})
+	}
+	for _, sub := range ex.Sub {
+		pb.Sub = append(pb.Sub, explanationProto(sub))
+	}
+	return pb
+}
+
+// explainQuery is like query, but additionally returns how query was
+// evaluated.
+func (s *Server) explainQuery(query *index.Query) ([]string, []*sourcebackendpb.QueryExplanation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, exs := s.Index.ExplainPostingQuery(query)
+	possible := make([]string, len(post))
+	var err error
+	for idx, docid := range post {
+		possible[idx], err = s.Index.Lookup(docid)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	explanations := make([]*sourcebackendpb.QueryExplanation, len(exs))
+	for idx, ex := range exs {
+		explanations[idx] = explanationProto(ex)
+	}
+	return possible, explanations, nil
+}
+
+func (s *Server) planPositional(literals []string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var plans strings.Builder
+	for _, seg := range s.Index.Segments {
+		if len(s.Index.Segments) > 1 {
+			fmt.Fprintf(&plans, "segment %q:\n", seg.Name)
+		}
+		for _, literal := range literals {
+			plan, err := seg.PlanPositional(literal)
+			if err != nil {
+				return "", fmt.Errorf("ix.PlanPositional(%q): %v", literal, err)
+			}
+			plans.WriteString(plan.String())
+		}
+	}
+	return plans.String(), nil
+}
+
+// Explain describes how Search finds the candidate files for the given
+// query, without searching them.
+func (s *Server) Explain(ctx context.Context, in *sourcebackendpb.SearchRequest) (*sourcebackendpb.ExplainReply, error) {
+	logprefix := fmt.Sprintf("[%q]", in.Query)
+	opts := regexp.Options{
+		FoldCase:  in.CaseInsensitive,
+		WholeWord: in.WholeWord,
+	}
+	re, err := regexp.CompileOptions(in.Query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s Could not compile regexp: %v\n", logprefix, err)
+	}
+	filter, err := newFileFilter(in, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v\n", logprefix, err)
+	}
+	query := index.RegexpQuery(re.Syntax)
+	for _, re := range filter.required {
+		query = query.And(index.RegexpQuery(re.Syntax))
+	}
+	reply := &sourcebackendpb.ExplainReply{
+		Shard: s.IndexPath,
+		Query: query.String(),
+	}
+
+	// Keep in sync with the choice of index in Search.
+	simplified := re.Syntax.Simplify()
+	if s.UsePositionalIndex &&
+		simplified.Op == syntax.OpLiteral &&
+		simplified.Flags&syntax.FoldCase == 0 {
+		literal := string(simplified.Rune)
+		if reply.PositionalPlan, err = s.planPositional([]string{literal}); err != nil {
+			return nil, err
+		}
+		possible, err := s.queryPositional(literal)
+		if err != nil {
+			return nil, err
+		}
+		for idx, entry := range possible {
+			if idx == 0 || possible[idx-1].fn != entry.fn {
+				reply.Candidates++
+			}
+		}
+		return reply, nil
+	}
+
+	pattern := index.NewPositionalPattern(re.Syntax)
+	if s.UsePositionalIndex && pattern != nil {
+		if reply.PositionalPlan, err = s.planPositional(pattern.Literals); err != nil {
+			return nil, err
+		}
+		possible, err := s.queryPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter.required) > 0 {
+			candidates, explanations, err := s.explainQuery(query)
+			if err != nil {
+				return nil, err
+			}
+			reply.Explanations = explanations
+			possible = intersect(possible, candidates)
+		}
+		reply.Candidates = uint32(len(possible))
+		return reply, nil
+	}
+
+	possible, explanations, err := s.explainQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	reply.Explanations = explanations
+	reply.Candidates = uint32(len(possible))
+	return reply, nil
+}
@@ -0,0 +1,204 @@
+package sourcebackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Debian/dcs/internal/index"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/shardmapping"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// A Searcher searches a corpus which is split into multiple shards (see
+// shardmapping) within the current process, i.e. without talking to source
+// backends. Each shard is searched by its own Server.
+type Searcher struct {
+	Shards []*Server
+}
+
+// OpenSearcher opens the (segmented) index of each shard. The files of the
+// shard whose index is in idxdirs[i] are read from unpackedPaths[i].
+func OpenSearcher(idxdirs, unpackedPaths []string, usePositionalIndex bool) (*Searcher, error) {
+	if got, want := len(unpackedPaths), len(idxdirs); got != want {
+		return nil, fmt.Errorf("got %d unpacked paths for %d indexes", got, want)
+	}
+	s := &Searcher{}
+	for idx, dir := range idxdirs {
+		ix, err := index.OpenSegmented(dir)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		unpacked := unpackedPaths[idx]
+		if unpacked != "" && !strings.HasSuffix(unpacked, "/") {
+			unpacked += "/"
+		}
+		s.Shards = append(s.Shards, &Server{
+			Index:              ix,
+			UnpackedPath:       unpacked,
+			IndexPath:          dir,
+			UsePositionalIndex: usePositionalIndex,
+		})
+	}
+	return s, nil
+}
+
+// Close closes the indexes of all shards.
+func (s *Searcher) Close() error {
+	var firstErr error
+	for _, srv := range s.Shards {
+		if err := srv.Index.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// PostingQuery returns the filenames (i.e. the unpacked path of the shard
+// followed by the document name) of all documents which may match query,
+// ordered by shard and docid.
+func (s *Searcher) PostingQuery(query *index.Query) ([]string, error) {
+	perShard := make([][]string, len(s.Shards))
+	var eg errgroup.Group
+	for idx, srv := range s.Shards {
+		idx, srv := idx, srv // copy
+		eg.Go(func() error {
+			possible, err := srv.query(query)
+			if err != nil {
+				return err
+			}
+			for i, fn := range possible {
+				possible[i] = srv.UnpackedPath + fn
+			}
+			perShard[idx] = possible
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	var n int
+	for _, possible := range perShard {
+		n += len(possible)
+	}
+	filenames := make([]string, 0, n)
+	for _, possible := range perShard {
+		filenames = append(filenames, possible...)
+	}
+	return filenames, nil
+}
+
+// A PositionalMatch is a position at which a file contains a literal.
+type PositionalMatch struct {
+	Filename string // unpacked path of the shard followed by the document name
+	Position uint32 // byte offset within the file
+}
+
+// QueryPositional returns the positions of literal in all documents (see
+// index.Index.QueryPositional), ordered by shard, docid and position.
+func (s *Searcher) QueryPositional(literal string) ([]PositionalMatch, error) {
+	perShard := make([][]entry, len(s.Shards))
+	var eg errgroup.Group
+	for idx, srv := range s.Shards {
+		idx, srv := idx, srv // copy
+		eg.Go(func() error {
+			var err error
+			perShard[idx], err = srv.queryPositional(literal)
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	var n int
+	for _, possible := range perShard {
+		n += len(possible)
+	}
+	matches := make([]PositionalMatch, 0, n)
+	for idx, possible := range perShard {
+		for _, e := range possible {
+			matches = append(matches, PositionalMatch{
+				Filename: s.Shards[idx].UnpackedPath + e.fn,
+				Position: e.pos,
+			})
+		}
+	}
+	return matches, nil
+}
+
+// localStream implements sourcebackendpb.SourceBackend_SearchServer for
+// calling Server.Search within the current process. Only Send and Context
+// are implemented.
+type localStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	send func(*sourcebackendpb.SearchReply) error
+}
+
+func (ls *localStream) Context() context.Context { return ls.ctx }
+
+func (ls *localStream) Send(reply *sourcebackendpb.SearchReply) error { return ls.send(reply) }
+
+// Search searches all shards in parallel, like Server.Search, and calls fn
+// with each reply (matches, file summaries and progress updates) and the
+// index of the shard which sent it. fn is never called concurrently.
+//
+// in.MaxResults applies to each shard. If fn returns an error, the search is
+// cancelled and Search returns that error.
+func (s *Searcher) Search(ctx context.Context, in *sourcebackendpb.SearchRequest, fn func(shard int, reply *sourcebackendpb.SearchReply) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		fnErr error // guarded by mu
+	)
+	var eg errgroup.Group
+	for idx, srv := range s.Shards {
+		idx, srv := idx, srv // copy
+		eg.Go(func() error {
+			return srv.Search(in, &localStream{
+				ctx: ctx,
+				send: func(reply *sourcebackendpb.SearchReply) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if fnErr != nil {
+						return fnErr
+					}
+					if err := fn(idx, reply); err != nil {
+						fnErr = err
+						cancel()
+						return err
+					}
+					return nil
+				},
+			})
+		})
+	}
+	err := eg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// File returns the contents of the file at path (e.g.
+// i3-wm_4.16.1-1/i3bar/src/xcb.c), which is read from the shard that
+// shardmapping assigns its package to.
+func (s *Searcher) File(ctx context.Context, path string) ([]byte, error) {
+	idx := strings.IndexByte(path, '/')
+	if idx == -1 {
+		return nil, fmt.Errorf("path %q does not start with a package", path)
+	}
+	shard := shardmapping.TaskIdxForPackage(path[:idx], len(s.Shards))
+	reply, err := s.Shards[shard].File(ctx, &sourcebackendpb.FileRequest{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Contents, nil
+}
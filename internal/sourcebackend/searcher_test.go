@@ -0,0 +1,360 @@
+package sourcebackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Debian/dcs/internal/index"
+	"github.com/Debian/dcs/internal/proto/sourcebackendpb"
+	"github.com/Debian/dcs/shardmapping"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestSearcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-searcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"i3-wm_4.16/i3.c":      "int main() { i3Font(); }\n",
+		"zsh_5.7/zsh.c":        "int main() { return 0; }\n",
+		"xterm_344/xterm.c":    "void setup() { i3Font(); }\n",
+		"libx11_1.6/xlib.c":    "i3Font is not used here\n",
+		"sway_1.2/sway/sway.c": "nothing\n",
+	}
+	const shards = 2
+	var idxdirs, unpackedPaths []string
+	writers := make([]*index.Writer, shards)
+	for i := 0; i < shards; i++ {
+		shard := filepath.Join(dir, fmt.Sprintf("shard%d", i))
+		idxdir := filepath.Join(shard, "full")
+		unpacked := filepath.Join(shard, "src")
+		if writers[i], err = index.Create(idxdir); err != nil {
+			t.Fatal(err)
+		}
+		idxdirs = append(idxdirs, idxdir)
+		unpackedPaths = append(unpackedPaths, unpacked)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	shardOf := make(map[string]int)
+	for _, name := range names {
+		pkg := name[:strings.Index(name, "/")]
+		shard := shardmapping.TaskIdxForPackage(pkg, shards)
+		shardOf[name] = shard
+		fn := filepath.Join(unpackedPaths[shard], name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writers[shard].AddFile(fn, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	searcher, err := OpenSearcher(idxdirs, unpackedPaths, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	var want []string
+	for _, name := range []string{"i3-wm_4.16/i3.c", "libx11_1.6/xlib.c", "xterm_344/xterm.c"} {
+		want = append(want, unpackedPaths[shardOf[name]]+"/"+name)
+	}
+	sort.Strings(want)
+
+	re, err := syntax.Parse("i3Font", syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	possible, err := searcher.PostingQuery(index.RegexpQuery(re))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(possible)
+	if !reflect.DeepEqual(possible, want) {
+		t.Errorf("PostingQuery(i3Font) = %v, want %v", possible, want)
+	}
+
+	positional, err := searcher.QueryPositional("i3Font")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, match := range positional {
+		got = append(got, match.Filename)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryPositional(i3Font) = %v, want %v", got, want)
+	}
+
+	for _, pos := range []bool{false, true} {
+		for _, srv := range searcher.Shards {
+			srv.UsePositionalIndex = pos
+		}
+		var matches []string
+		if err := searcher.Search(context.Background(), &sourcebackendpb.SearchRequest{
+			Query:       "i3Font",
+			FileDigests: true,
+		}, func(shard int, reply *sourcebackendpb.SearchReply) error {
+			if reply.Type == sourcebackendpb.SearchReply_MATCH {
+				matches = append(matches, searcher.Shards[shard].UnpackedPath+reply.Match.Path)
+				digest := sha256.Sum256([]byte(files[reply.Match.Path]))
+				if !bytes.Equal(reply.Match.FileDigest, digest[:]) {
+					t.Errorf("Search(i3Font, positional=%v): %s: FileDigest = %x, want %x", pos, reply.Match.Path, reply.Match.FileDigest, digest)
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(matches)
+		if !reflect.DeepEqual(matches, want) {
+			t.Errorf("Search(i3Font, positional=%v) = %v, want %v", pos, matches, want)
+		}
+	}
+
+	b, err := searcher.File(context.Background(), "xterm_344/xterm.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), files["xterm_344/xterm.c"]; got != want {
+		t.Errorf("File(xterm_344/xterm.c) = %q, want %q", got, want)
+	}
+}
+
+func TestSetLegacyContext(t *testing.T) {
+	m := &sourcebackendpb.Match{
+		Before: []string{"a", "b", "c"},
+		After:  []string{"e"},
+	}
+	setLegacyContext(m)
+	if got, want := []string{m.Ctxp2, m.Ctxp1, m.Ctxn1, m.Ctxn2}, []string{"b", "c", "e", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("setLegacyContext: ctxp2, ctxp1, ctxn1, ctxn2 = %q, want %q", got, want)
+	}
+}
+
+func TestSearchContextLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-searcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "full")
+	unpacked := filepath.Join(dir, "src")
+	fn := filepath.Join(unpacked, "i3-wm_4.16", "i3.c")
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte("a\nb\nc\ni3Font();\nd\ne\nf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := index.Create(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile(fn, "i3-wm_4.16/i3.c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := OpenSearcher([]string{idxdir}, []string{unpacked}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	equal := func(a, b []string) bool {
+		return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+	}
+	for _, tt := range []struct {
+		desc         string
+		contextLines *wrappers.UInt32Value
+		before       []string
+		after        []string
+	}{
+		// Unset means DefaultContextLines, as for clients which predate
+		// context_lines.
+		{"unset", nil, []string{"b", "c"}, []string{"d", "e"}},
+		{"0", &wrappers.UInt32Value{Value: 0}, nil, nil},
+		{"1", &wrappers.UInt32Value{Value: 1}, []string{"c"}, []string{"d"}},
+	} {
+		for _, pos := range []bool{false, true} {
+			searcher.Shards[0].UsePositionalIndex = pos
+			var matches []*sourcebackendpb.Match
+			if err := searcher.Search(context.Background(), &sourcebackendpb.SearchRequest{
+				Query:        "i3Font",
+				ContextLines: tt.contextLines,
+			}, func(shard int, reply *sourcebackendpb.SearchReply) error {
+				if reply.Type == sourcebackendpb.SearchReply_MATCH {
+					matches = append(matches, reply.Match)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 1 {
+				t.Fatalf("Search(context_lines=%s, positional=%v): got %d matches, want 1", tt.desc, pos, len(matches))
+			}
+			m := matches[0]
+			if !equal(m.Before, tt.before) || !equal(m.After, tt.after) {
+				t.Errorf("Search(context_lines=%s, positional=%v): before, after = %q, %q, want %q, %q", tt.desc, pos, m.Before, m.After, tt.before, tt.after)
+			}
+		}
+	}
+}
+
+func TestSearchShortLiterals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-searcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "full")
+	unpacked := filepath.Join(dir, "src")
+	fn := filepath.Join(unpacked, "i3-wm_4.16", "i3.c")
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte("if (a != b) {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := index.Create(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile(fn, "i3-wm_4.16/i3.c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := OpenSearcher([]string{idxdir}, []string{unpacked}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	search := func() (int, error) {
+		var matches int
+		err := searcher.Search(context.Background(), &sourcebackendpb.SearchRequest{
+			Query: "!=",
+		}, func(shard int, reply *sourcebackendpb.SearchReply) error {
+			if reply.Type == sourcebackendpb.SearchReply_MATCH {
+				matches++
+			}
+			return nil
+		})
+		return matches, err
+	}
+	srv := searcher.Shards[0]
+	for _, pos := range []bool{true, false} {
+		srv.UsePositionalIndex = pos
+		reply, err := srv.Capabilities(context.Background(), &sourcebackendpb.CapabilitiesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := reply.ShortLiterals, pos; got != want {
+			t.Errorf("Capabilities(positional=%v): ShortLiterals = %v, want %v", pos, got, want)
+		}
+		matches, err := search()
+		if pos {
+			if err != nil || matches != 1 {
+				t.Errorf("Search(!=, positional=true) = %d matches, %v, want 1 match", matches, err)
+			}
+		} else if err == nil {
+			// Without the positional index, all files would be searched.
+			t.Errorf("Search(!=, positional=false) unexpectedly succeeded")
+		}
+	}
+}
+
+func TestSearchFileDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-searcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idxdir := filepath.Join(dir, "full")
+	unpacked := filepath.Join(dir, "src")
+	fn := filepath.Join(unpacked, "i3-wm_4.16", "i3.c")
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The positional index path only reads the beginning of the file to
+	// verify the match, and the file is larger than grep’s buffer.
+	contents := "i3Font();\n" + strings.Repeat("abcdefghijklmnopqrstuvwxyz\n", 64*1024)
+	if err := ioutil.WriteFile(fn, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := index.Create(idxdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile(fn, "i3-wm_4.16/i3.c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := OpenSearcher([]string{idxdir}, []string{unpacked}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer searcher.Close()
+
+	want := sha256.Sum256([]byte(contents))
+	for _, pos := range []bool{false, true} {
+		searcher.Shards[0].UsePositionalIndex = pos
+		for _, fileDigests := range []bool{false, true} {
+			var digests [][]byte
+			if err := searcher.Search(context.Background(), &sourcebackendpb.SearchRequest{
+				Query:       "i3Font",
+				FileDigests: fileDigests,
+			}, func(shard int, reply *sourcebackendpb.SearchReply) error {
+				if reply.Type == sourcebackendpb.SearchReply_MATCH {
+					digests = append(digests, reply.Match.FileDigest)
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(digests) != 1 {
+				t.Fatalf("Search(positional=%v, file_digests=%v): got %d matches, want 1", pos, fileDigests, len(digests))
+			}
+			if got := digests[0]; fileDigests && !bytes.Equal(got, want[:]) {
+				t.Errorf("Search(positional=%v): FileDigest = %x, want %x", pos, got, want)
+			} else if !fileDigests && got != nil {
+				t.Errorf("Search(positional=%v, file_digests=false): FileDigest = %x, want none", pos, got)
+			}
+		}
+	}
+}
@@ -3,8 +3,10 @@ package sourcebackend
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"html"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -25,6 +27,7 @@ import (
 	"github.com/google/renameio"
 	opentracing "github.com/opentracing/opentracing-go"
 	olog "github.com/opentracing/opentracing-go/log"
+	"google.golang.org/grpc/status"
 )
 
 func FilterByKeywords(rewritten *url.URL, files []ranking.ResultPath) []ranking.ResultPath {
@@ -137,9 +140,19 @@ type SourceReply struct {
 	AllMatches []regexp.Match
 }
 
+const (
+	// DefaultContextLines is the number of lines of context around each
+	// match when SearchRequest.ContextLines is unset.
+	DefaultContextLines = 2
+
+	// MaxContextLines is the maximum SearchRequest.ContextLines which Search
+	// accepts.
+	MaxContextLines = 20
+)
+
 type Server struct {
 	mu                 sync.Mutex
-	Index              *index.Index
+	Index              *index.SegmentedIndex
 	UnpackedPath       string
 	IndexPath          string
 	UsePositionalIndex bool
@@ -164,7 +177,7 @@ func (s *Server) File(ctx context.Context, in *sourcebackendpb.FileRequest) (*so
 	}, nil
 }
 
-func sendProgressUpdate(stream sourcebackendpb.SourceBackend_SearchServer, connMu *sync.Mutex, filesProcessed, filesTotal int) error {
+func sendProgressUpdate(stream sourcebackendpb.SourceBackend_SearchServer, connMu *sync.Mutex, filesProcessed, filesTotal int, truncated bool) error {
 	connMu.Lock()
 	defer connMu.Unlock()
 	return stream.Send(&sourcebackendpb.SearchReply{
@@ -172,6 +185,7 @@ func sendProgressUpdate(stream sourcebackendpb.SourceBackend_SearchServer, connM
 		ProgressUpdate: &sourcebackendpb.ProgressUpdate{
 			FilesProcessed: uint64(filesProcessed),
 			FilesTotal:     uint64(filesTotal),
+			Truncated:      truncated,
 		},
 	})
 }
@@ -194,6 +208,129 @@ func countNL(b []byte) int {
 	return n
 }
 
+// escapeLines returns lines with html.EscapeString applied to each element.
+func escapeLines(lines []string) []string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = html.EscapeString(line)
+	}
+	return escaped
+}
+
+// setLegacyContext populates the deprecated ctxp2, ctxp1, ctxn1 and ctxn2
+// fields of m from m.Before and m.After, for clients which predate them.
+func setLegacyContext(m *sourcebackendpb.Match) {
+	if n := len(m.Before); n > 0 {
+		m.Ctxp1 = m.Before[n-1]
+		if n > 1 {
+			m.Ctxp2 = m.Before[n-2]
+		}
+	}
+	if n := len(m.After); n > 0 {
+		m.Ctxn1 = m.After[0]
+		if n > 1 {
+			m.Ctxn2 = m.After[1]
+		}
+	}
+}
+
+// fileDigest returns the SHA-256 digest (see SearchRequest.FileDigests) of a
+// file whose first bytes were already read into prefix, and whose remaining
+// bytes (if any) are read from rest.
+func fileDigest(prefix []byte, rest io.Reader) ([]byte, error) {
+	h := sha256.New()
+	h.Write(prefix)
+	if _, err := io.Copy(h, rest); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// grepDigest is like grep.File, but additionally returns the SHA-256 digest
+// of the file (see SearchRequest.FileDigests), computed from the bytes which
+// grep reads anyway.
+func grepDigest(grep *regexp.Grep, name string) ([]regexp.Match, []byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	matches := grep.Reader(io.TeeReader(f, h), name)
+	// grep might stop reading before the end of the file.
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, nil, err
+	}
+	return matches, h.Sum(nil), nil
+}
+
+// fileFilter verifies SearchRequest.RequiredPatterns and ExcludedPatterns
+// against the contents of a file. Like regexp.Regexp, it is not safe for
+// concurrent use.
+type fileFilter struct {
+	required []*regexp.Regexp
+	excluded []*regexp.Regexp
+}
+
+func newFileFilter(in *sourcebackendpb.SearchRequest, opts regexp.Options) (*fileFilter, error) {
+	var f fileFilter
+	for _, pattern := range in.RequiredPatterns {
+		re, err := regexp.CompileOptions(pattern, opts)
+		if err != nil {
+			return nil, fmt.Errorf("required pattern %q: %v", pattern, err)
+		}
+		f.required = append(f.required, re)
+	}
+	for _, pattern := range in.ExcludedPatterns {
+		re, err := regexp.CompileOptions(pattern, opts)
+		if err != nil {
+			return nil, fmt.Errorf("excluded pattern %q: %v", pattern, err)
+		}
+		f.excluded = append(f.excluded, re)
+	}
+	return &f, nil
+}
+
+// empty reports whether all files pass the filter.
+func (f *fileFilter) empty() bool {
+	return len(f.required) == 0 && len(f.excluded) == 0
+}
+
+// matches reports whether b (the contents of a file) matches all required and
+// none of the excluded patterns.
+func (f *fileFilter) matches(b []byte) bool {
+	for _, re := range f.required {
+		if re.Match(b, true, true) == -1 {
+			return false
+		}
+	}
+	for _, re := range f.excluded {
+		if re.Match(b, true, true) != -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRanges converts offsets as returned by regexp.Regexp.SubmatchIndex
+// into the ranges of the match and of its capture groups.
+func matchRanges(offsets []int) (*sourcebackendpb.Range, []*sourcebackendpb.Range) {
+	if len(offsets) < 2 {
+		return nil, nil
+	}
+	var submatches []*sourcebackendpb.Range
+	for i := 2; i+1 < len(offsets); i += 2 {
+		submatches = append(submatches, &sourcebackendpb.Range{
+			Start: int32(offsets[i]),
+			End:   int32(offsets[i+1]),
+		})
+	}
+	return &sourcebackendpb.Range{
+		Start: int32(offsets[0]),
+		End:   int32(offsets[1]),
+	}, submatches
+}
+
 func (s *Server) ReplaceIndex(ctx context.Context, in *sourcebackendpb.ReplaceIndexRequest) (*sourcebackendpb.ReplaceIndexReply, error) {
 	newShard := in.ReplacementPath
 
@@ -214,7 +351,7 @@ func (s *Server) ReplaceIndex(ctx context.Context, in *sourcebackendpb.ReplaceIn
 			// this directory, so let’s load this shard.
 			oldIndex := s.Index
 			log.Printf("Trying to load %q\n", newShard)
-			newIndex, err := index.Open(newShard)
+			newIndex, err := index.OpenSegmented(newShard)
 			if err != nil {
 				return nil, err
 			}
@@ -249,6 +386,38 @@ func (s *Server) ReplaceIndex(ctx context.Context, in *sourcebackendpb.ReplaceIn
 	return nil, fmt.Errorf("No such shard.")
 }
 
+// ReloadIndex re-opens the index at IndexPath, which picks up segments that
+// were appended or compacted since it was opened.
+func (s *Server) ReloadIndex(ctx context.Context, in *sourcebackendpb.ReloadIndexRequest) (*sourcebackendpb.ReloadIndexReply, error) {
+	newIndex, err := index.OpenSegmented(s.IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	oldIndex := s.Index
+	s.Index = newIndex
+	s.mu.Unlock()
+	if err := oldIndex.Close(); err != nil {
+		return nil, err
+	}
+	return &sourcebackendpb.ReloadIndexReply{}, nil
+}
+
+// shortLiterals reports whether Search locates short literals (see
+// index.IsShortLiteral) using the positional index.
+func (s *Server) shortLiterals() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.UsePositionalIndex && s.Index.ShortQueries()
+}
+
+// Capabilities describes which queries Search can answer from the index.
+func (s *Server) Capabilities(ctx context.Context, in *sourcebackendpb.CapabilitiesRequest) (*sourcebackendpb.CapabilitiesReply, error) {
+	return &sourcebackendpb.CapabilitiesReply{
+		ShortLiterals: s.shortLiterals(),
+	}, nil
+}
+
 func (s *Server) queryPositional(literal string) ([]entry, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -259,7 +428,7 @@ func (s *Server) queryPositional(literal string) ([]entry, error) {
 	}
 	possible := make([]entry, len(matches))
 	for idx, match := range matches {
-		fn, err := s.Index.DocidMap.Lookup(match.Docid)
+		fn, err := s.Index.Lookup(match.Docid)
 		if err != nil {
 			return nil, fmt.Errorf("DocidMap.Lookup(%v): %v", match.Docid, err)
 		}
@@ -272,6 +441,45 @@ func (s *Server) queryPositional(literal string) ([]entry, error) {
 	return possible, nil
 }
 
+// queryPattern returns the files which may contain matches of pattern,
+// according to the positional index.
+func (s *Server) queryPattern(pattern *index.PositionalPattern) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log.Printf("queryPattern(%+v)", pattern)
+	matches, err := s.Index.QueryPositionalPattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("ix.QueryPositionalPattern(%+v): %v", pattern, err)
+	}
+	var possible []string
+	for idx, match := range matches {
+		if idx > 0 && matches[idx-1].Docid == match.Docid {
+			continue
+		}
+		fn, err := s.Index.Lookup(match.Docid)
+		if err != nil {
+			return nil, fmt.Errorf("DocidMap.Lookup(%v): %v", match.Docid, err)
+		}
+		possible = append(possible, fn)
+	}
+	return possible, nil
+}
+
+// intersect returns the elements of a which are also contained in b.
+func intersect(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	result := a[:0]
+	for _, s := range a {
+		if inB[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 func (s *Server) query(query *index.Query) ([]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -279,7 +487,7 @@ func (s *Server) query(query *index.Query) ([]string, error) {
 	possible := make([]string, len(post))
 	var err error
 	for idx, docid := range post {
-		possible[idx], err = s.Index.DocidMap.Lookup(docid)
+		possible[idx], err = s.Index.Lookup(docid)
 		if err != nil {
 			return nil, err
 		}
@@ -298,10 +506,26 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 		span = (&opentracing.NoopTracer{}).StartSpan("Search")
 	}
 
-	re, err := regexp.Compile(in.Query)
+	contextLines := DefaultContextLines
+	if in.ContextLines != nil {
+		if in.ContextLines.Value > MaxContextLines {
+			return fmt.Errorf("%s context_lines must be at most %d, got %d", logprefix, MaxContextLines, in.ContextLines.Value)
+		}
+		contextLines = int(in.ContextLines.Value)
+	}
+
+	opts := regexp.Options{
+		FoldCase:  in.CaseInsensitive,
+		WholeWord: in.WholeWord,
+	}
+	re, err := regexp.CompileOptions(in.Query, opts)
 	if err != nil {
 		return fmt.Errorf("%s Could not compile regexp: %v\n", logprefix, err)
 	}
+	filter, err := newFileFilter(in, opts)
+	if err != nil {
+		return fmt.Errorf("%s %v\n", logprefix, err)
+	}
 
 	// Parse the (rewritten) URL to extract all ranking options/keywords.
 	rewritten, err := url.Parse(in.RewrittenUrl)
@@ -314,7 +538,11 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 	// TODO: analyze the query to see if fast path can be taken
 	// maybe by using a different worker?
 	simplified := re.Syntax.Simplify()
-	queryPos := s.UsePositionalIndex && simplified.Op == syntax.OpLiteral
+	// The positional index stores trigrams verbatim, so it can only be used
+	// for case-sensitive literals.
+	queryPos := s.UsePositionalIndex &&
+		simplified.Op == syntax.OpLiteral &&
+		simplified.Flags&syntax.FoldCase == 0
 	var files ranking.ResultPaths
 	if queryPos {
 		possible, err := s.queryPositional(string(simplified.Rune))
@@ -333,9 +561,38 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 			}
 		}
 	} else {
-		possible, err := s.query(index.RegexpQuery(re.Syntax))
-		if err != nil {
-			return err
+		// Files must contain the trigrams of the query and of all required
+		// patterns. Excluded patterns are only verified per file: a file
+		// containing their trigrams does not necessarily match them.
+		query := index.RegexpQuery(re.Syntax)
+		for _, re := range filter.required {
+			query = query.And(index.RegexpQuery(re.Syntax))
+		}
+		if query.Op == index.QAll && index.IsShortLiteral(re.Syntax) {
+			// Without the positional index, all files would be searched.
+			return fmt.Errorf("%s queries shorter than 4 bytes require -use_positional_index\n", logprefix)
+		}
+		var possible []string
+		// Regexps made of literals joined by gaps (e.g. foo.*bar) can be
+		// narrowed down further using the positional index.
+		pattern := index.NewPositionalPattern(re.Syntax)
+		if s.UsePositionalIndex && pattern != nil {
+			possible, err = s.queryPattern(pattern)
+			if err != nil {
+				return err
+			}
+			if len(filter.required) > 0 {
+				candidates, err := s.query(query)
+				if err != nil {
+					return err
+				}
+				possible = intersect(possible, candidates)
+			}
+		} else {
+			possible, err = s.query(query)
+			if err != nil {
+				return err
+			}
 		}
 
 		span.LogFields(olog.Int("files.possible", len(possible)))
@@ -371,9 +628,16 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 
 	log.Printf("%s regexp = %q, %d possible files\n", logprefix, re, len(files))
 
+	// Querying the index can take a while, so check whether the client is
+	// still interested before starting to grep.
+	if err := ctx.Err(); err != nil {
+		log.Printf("%s cancelled by client: %v\n", logprefix, err)
+		return status.FromContextError(err).Err()
+	}
+
 	// Send the first progress update so that clients know how many files are
 	// going to be searched.
-	if err := sendProgressUpdate(stream, connMu, 0, len(files)); err != nil {
+	if err := sendProgressUpdate(stream, connMu, 0, len(files), false); err != nil {
 		return fmt.Errorf("%s %v\n", logprefix, err)
 	}
 
@@ -385,21 +649,110 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 	// So instead, we start 1000 worker goroutines and feed them work through a
 	// single channel. Due to these goroutines being blocked on writing,
 	// the grepping will naturally become slower.
-	progress := make(chan int)
+	//
+	// Cancelling ctx stops feeding work to the workers, e.g. once
+	// in.MaxResults matches were sent, in.TimeoutMs elapsed or the client
+	// cancelled the RPC (streamCtx is done).
+	streamCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if in.TimeoutMs > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(in.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
 
-	var wg sync.WaitGroup
+	var (
+		// sent and truncated are guarded by connMu.
+		sent      uint32
+		truncated bool
+	)
+	// sendResult sends a result unless the search was stopped. It returns
+	// false if the worker should stop working.
+	sendResult := func(reply *sourcebackendpb.SearchReply) bool {
+		connMu.Lock()
+		defer connMu.Unlock()
+		if ctx.Err() != nil {
+			return false
+		}
+		if in.MaxResults > 0 && sent >= in.MaxResults {
+			truncated = true
+			cancel()
+			return false
+		}
+		if err := stream.Send(reply); err != nil {
+			log.Printf("%s %v\n", logprefix, err)
+			cancel()
+			return false
+		}
+		sent++
+		if in.MaxResults > 0 && sent >= in.MaxResults {
+			// Stop feeding work to the workers. Any match which is found
+			// after this point marks the result set as truncated.
+			cancel()
+		}
+		return true
+	}
+	sendMatch := func(match *sourcebackendpb.Match) bool {
+		setLegacyContext(match)
+		return sendResult(&sourcebackendpb.SearchReply{
+			Type:  sourcebackendpb.SearchReply_MATCH,
+			Match: match,
+		})
+	}
+
+	// sendFileSummary sends the number of matches in path if requested. In
+	// the MATCHES result mode, it must only be called once all matches of
+	// path were sent.
+	sendFileSummary := func(path string, matches int) {
+		if matches == 0 {
+			return
+		}
+		reply := &sourcebackendpb.SearchReply{
+			Type: sourcebackendpb.SearchReply_FILE_SUMMARY,
+			FileSummary: &sourcebackendpb.FileSummary{
+				Path:    path,
+				Matches: uint32(matches),
+			},
+		}
+		switch in.ResultMode {
+		case sourcebackendpb.SearchRequest_FILES_ONLY:
+			reply.FileSummary.Matches = 0
+			sendResult(reply)
+			return
+		case sourcebackendpb.SearchRequest_COUNT_ONLY:
+			sendResult(reply)
+			return
+		}
+		if !in.FileSummaries {
+			return
+		}
+		connMu.Lock()
+		defer connMu.Unlock()
+		if err := stream.Send(reply); err != nil {
+			log.Printf("%s %v\n", logprefix, err)
+		}
+	}
+
+	progress := make(chan int)
+	workersDone := make(chan struct{})
+	progressDone := make(chan struct{})
+	filesProcessed := 0
 
 	go func() {
-		cnt := 0
+		defer close(progressDone)
 		errorShown := false
 		var lastProgressUpdate time.Time
 		progressInterval := 2*time.Second + time.Duration(rand.Int63n(int64(500*time.Millisecond)))
-		for cnt < len(files) {
-			add := <-progress
-			cnt += add
+		for {
+			select {
+			case add := <-progress:
+				filesProcessed += add
+			case <-workersDone:
+				return
+			}
 
 			if time.Since(lastProgressUpdate) > progressInterval {
-				if err := sendProgressUpdate(stream, connMu, cnt, len(files)); err != nil {
+				if err := sendProgressUpdate(stream, connMu, filesProcessed, len(files), false); err != nil {
 					if !errorShown {
 						log.Printf("%s %v\n", logprefix, err)
 						// We need to read the 'progress' channel, so we cannot
@@ -411,13 +764,6 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 				lastProgressUpdate = time.Now()
 			}
 		}
-
-		if err := sendProgressUpdate(stream, connMu, len(files), len(files)); err != nil {
-			log.Printf("%s %v\n", logprefix, err)
-		}
-		close(progress)
-
-		wg.Done()
 	}()
 
 	querystr := ranking.NewQueryStr(in.Query)
@@ -426,16 +772,23 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 	if len(files) < numWorkers {
 		numWorkers = len(files)
 	}
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
 	var workerFn func()
 	if queryPos {
 		work := make(chan []ranking.ResultPath)
 		go func() {
+			defer close(work)
 			var last string
 			var bundle []ranking.ResultPath
 			for _, fn := range files {
 				if fn.Path != last {
 					if len(bundle) > 0 {
-						work <- bundle
+						select {
+						case work <- bundle:
+						case <-ctx.Done():
+							return
+						}
 						bundle = nil
 					}
 					last = fn.Path
@@ -443,20 +796,22 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 				bundle = append(bundle, fn)
 			}
 			if len(bundle) > 0 {
-				work <- bundle
+				select {
+				case work <- bundle:
+				case <-ctx.Done():
+				}
 			}
-			close(work)
 		}()
 
-		// We add the additional 1 for the progress updater goroutine. It also
-		// needs to be done before we can return, otherwise it will try to use the
-		// (already closed) network connection, which is a fatal error.
-		wg.Add(numWorkers + 1)
-
 		workerFn = func() {
 			defer wg.Done()
 			buf := make([]byte, 0, 64*1024)
 			rqb := []byte(string(simplified.Rune))
+			filter, err := newFileFilter(in, opts)
+			if err != nil {
+				log.Printf("%s\n", err)
+				return
+			}
 
 			for bundle := range work {
 
@@ -468,31 +823,48 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 				f, err := os.Open(filepath.Join(s.UnpackedPath, bundle[0].Path))
 				if err != nil {
 					log.Printf("%s %v", logprefix, err)
-					for range bundle {
-						progress <- 1
-					}
+					progress <- len(bundle)
 					continue
 				}
-				const extraBytes = 1024 // for context lines
-				// Assumption: bundle is ordered from low to high (if not, we
-				// need to traverse bundle).
-				max := bundle[len(bundle)-1].Position + len(rqb) + extraBytes
-				if max > cap(buf) {
-					buf = make([]byte, 0, max)
-				}
-				n, err := f.Read(buf[:max])
-				if err != nil {
-					log.Printf("%s %v", logprefix, err)
-					for range bundle {
-						progress <- 1
+				var b []byte
+				if filter.empty() {
+					extraBytes := 512 * (contextLines + 2) // for context lines
+					// Assumption: bundle is ordered from low to high (if not, we
+					// need to traverse bundle).
+					max := bundle[len(bundle)-1].Position + len(rqb) + extraBytes
+					if max > cap(buf) {
+						buf = make([]byte, 0, max)
 					}
+					n, err := f.Read(buf[:max])
+					if err != nil {
+						log.Printf("%s %v", logprefix, err)
+						f.Close()
+						progress <- len(bundle)
+						continue
+					}
+					// The rest of the file is only read for FileDigests.
+					b = buf[:n]
+				} else {
+					// The patterns need to be verified against the whole file.
+					b, err = ioutil.ReadAll(f)
+					if err != nil {
+						log.Printf("%s %v", logprefix, err)
+						f.Close()
+						progress <- len(bundle)
+						continue
+					}
+				}
+				if !filter.matches(b) {
+					f.Close()
+					progress <- len(bundle)
 					continue
 				}
-				f.Close()
-				b := buf[:n]
 
 				lastPos := -1
-				for _, fn := range bundle {
+				matches := 0
+				complete := true
+				var digest []byte // see SearchRequest.FileDigests
+				for idx, fn := range bundle {
 					progress <- 1
 					sourcePkgName := fn.Path[fn.SourcePkgIdx[0]:fn.SourcePkgIdx[1]]
 					if rankingopts.Pathmatch {
@@ -509,12 +881,32 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 					if fn.Position+len(rqb) > len(b) || !bytes.Equal(b[fn.Position:fn.Position+len(rqb)], rqb) {
 						continue
 					}
-					if lastPos > -1 && !bytes.ContainsRune(b[lastPos:fn.Position], '\n') {
+					if in.AllMatches {
+						if lastPos > -1 && fn.Position < lastPos+len(rqb) {
+							continue // overlapping occurrence
+						}
+					} else if lastPos > -1 && !bytes.ContainsRune(b[lastPos:fn.Position], '\n') {
 						continue // cap to one match per line, like grep()
 					}
 					//fmt.Printf("%s:%d\n", fn.Path, fn.Position)
 					lastPos = fn.Position
 
+					if in.ResultMode != sourcebackendpb.SearchRequest_MATCHES {
+						matches++
+						if in.ResultMode == sourcebackendpb.SearchRequest_FILES_ONLY {
+							progress <- len(bundle) - idx - 1
+							break
+						}
+						continue
+					}
+
+					if in.FileDigests && digest == nil {
+						digest, err = fileDigest(b, f)
+						if err != nil {
+							log.Printf("%s %v", logprefix, err)
+						}
+					}
+
 					line := countNL(b[:fn.Position]) + 1
 					match := regexp.Match{
 						Path: fn.Path,
@@ -522,61 +914,70 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 						//Context: string(line),
 					}
 					match.PathRank = ranking.PostRank(rankingopts, &match, &querystr)
-					five := index.FiveLines(b, fn.Position)
-					connMu.Lock()
-					if err := stream.Send(&sourcebackendpb.SearchReply{
-						Type: sourcebackendpb.SearchReply_MATCH,
-						Match: &sourcebackendpb.Match{
-							Path:     fn.Path,
-							Line:     uint32(line),
-							Package:  fn.Path[:strings.Index(fn.Path, "/")],
-							Ctxp2:    html.EscapeString(five[0]),
-							Ctxp1:    html.EscapeString(five[1]),
-							Context:  html.EscapeString(five[2]),
-							Ctxn1:    html.EscapeString(five[3]),
-							Ctxn2:    html.EscapeString(five[4]),
-							Pathrank: match.PathRank,
-							Ranking:  fn.Ranking,
-						},
-					}); err != nil {
-						connMu.Unlock()
-						log.Printf("%s %v\n", logprefix, err)
-						// Drain the work channel, but without doing any work.
-						// This effectively exits the worker goroutine(s)
-						// cleanly.
-						for _ = range work {
-						}
+					before, context, after := index.ContextLines(b, fn.Position, contextLines)
+					col := fn.Position - (bytes.LastIndexByte(b[:fn.Position], '\n') + 1)
+					matchRange, _ := matchRanges(regexp.EscapeOffsets(
+						[]byte(context),
+						[]int{col, col + len(rqb)}))
+					if !sendMatch(&sourcebackendpb.Match{
+						Path:       fn.Path,
+						Line:       uint32(line),
+						Package:    fn.Path[:strings.Index(fn.Path, "/")],
+						Before:     escapeLines(before),
+						Context:    html.EscapeString(context),
+						After:      escapeLines(after),
+						MatchRange: matchRange,
+						Pathrank:   match.PathRank,
+						Ranking:    fn.Ranking,
+						FileDigest: digest,
+					}) {
+						progress <- len(bundle) - idx - 1
+						complete = false
 						break
 					}
-					connMu.Unlock()
+					matches++
+				}
+				f.Close()
+				if complete {
+					sendFileSummary(bundle[0].Path, matches)
 				}
 			}
 		}
 	} else {
 		work := make(chan ranking.ResultPath)
 		go func() {
+			defer close(work)
 			for _, file := range files {
-				work <- file
+				select {
+				case work <- file:
+				case <-ctx.Done():
+					return
+				}
 			}
-			close(work)
 		}()
 
-		// We add the additional 1 for the progress updater goroutine. It also
-		// needs to be done before we can return, otherwise it will try to use the
-		// (already closed) network connection, which is a fatal error.
-		wg.Add(len(files) + 1)
-
 		workerFn = func() {
-			re, err := regexp.Compile(in.Query)
+			defer wg.Done()
+			re, err := regexp.CompileOptions(in.Query, opts)
+			if err != nil {
+				log.Printf("%s\n", err)
+				return
+			}
+
+			filter, err := newFileFilter(in, opts)
 			if err != nil {
 				log.Printf("%s\n", err)
 				return
 			}
 
 			grep := regexp.Grep{
-				Regexp: re,
-				Stdout: os.Stdout,
-				Stderr: os.Stderr,
+				Regexp:       re,
+				Stdout:       os.Stdout,
+				Stderr:       os.Stderr,
+				ContextLines: contextLines,
+				AllMatches:   in.AllMatches,
+				L:            in.ResultMode == sourcebackendpb.SearchRequest_FILES_ONLY,
+				C:            in.ResultMode == sourcebackendpb.SearchRequest_COUNT_ONLY,
 			}
 
 			for file := range work {
@@ -593,7 +994,35 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 				}
 
 				// TODO: figure out how to safely clone a dcs/regexp
-				matches := grep.File(path.Join(s.UnpackedPath, file.Path))
+				var (
+					matches []regexp.Match
+					digest  []byte
+				)
+				if in.FileDigests && in.ResultMode == sourcebackendpb.SearchRequest_MATCHES {
+					matches, digest, err = grepDigest(&grep, path.Join(s.UnpackedPath, file.Path))
+					if err != nil {
+						log.Printf("%s %v", logprefix, err)
+					}
+				} else {
+					matches = grep.File(path.Join(s.UnpackedPath, file.Path))
+				}
+				if len(matches) > 0 && !filter.empty() {
+					b, err := ioutil.ReadFile(path.Join(s.UnpackedPath, file.Path))
+					if err != nil {
+						log.Printf("%s %v", logprefix, err)
+						matches = nil
+					} else if !filter.matches(b) {
+						matches = nil
+					}
+				}
+				if in.ResultMode != sourcebackendpb.SearchRequest_MATCHES {
+					if len(matches) > 0 {
+						sendFileSummary(matches[0].Path[len(s.UnpackedPath):], len(matches))
+					}
+					progress <- 1
+					continue
+				}
+				complete := true
 				for _, match := range matches {
 					match.Ranking = ranking.PostRank(rankingopts, &match, &querystr)
 					match.PathRank = file.Ranking
@@ -605,37 +1034,29 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 					// TODO: ideally, we’d get sourcebackendpb.Match structs from grep.File(), let’s do that after profiling the decoding performance
 
 					path := match.Path[len(s.UnpackedPath):]
-					connMu.Lock()
-					if err := stream.Send(&sourcebackendpb.SearchReply{
-						Type: sourcebackendpb.SearchReply_MATCH,
-						Match: &sourcebackendpb.Match{
-							Path:     path,
-							Line:     uint32(match.Line),
-							Package:  path[:strings.Index(path, "/")],
-							Ctxp2:    match.Ctxp2,
-							Ctxp1:    match.Ctxp1,
-							Context:  match.Context,
-							Ctxn1:    match.Ctxn1,
-							Ctxn2:    match.Ctxn2,
-							Pathrank: match.PathRank,
-							Ranking:  match.Ranking,
-						},
-					}); err != nil {
-						connMu.Unlock()
-						log.Printf("%s %v\n", logprefix, err)
-						// Drain the work channel, but without doing any work.
-						// This effectively exits the worker goroutine(s)
-						// cleanly.
-						for _ = range work {
-						}
+					matchRange, submatchRanges := matchRanges(match.Submatches)
+					if !sendMatch(&sourcebackendpb.Match{
+						Path:           path,
+						Line:           uint32(match.Line),
+						Package:        path[:strings.Index(path, "/")],
+						Before:         match.Before,
+						Context:        match.Context,
+						After:          match.After,
+						MatchRange:     matchRange,
+						SubmatchRanges: submatchRanges,
+						Pathrank:       match.PathRank,
+						Ranking:        match.Ranking,
+						FileDigest:     digest,
+					}) {
+						complete = false
 						break
 					}
-					connMu.Unlock()
+				}
+				if complete && len(matches) > 0 {
+					sendFileSummary(matches[0].Path[len(s.UnpackedPath):], len(matches))
 				}
 
 				progress <- 1
-
-				wg.Done()
 			}
 		}
 	}
@@ -644,7 +1065,25 @@ func (s *Server) Search(in *sourcebackendpb.SearchRequest, stream sourcebackendp
 	}
 
 	wg.Wait()
+	close(workersDone)
+	<-progressDone
+
+	if err := streamCtx.Err(); err != nil {
+		log.Printf("%s cancelled by client after %d matches: %v\n", logprefix, sent, err)
+		return status.FromContextError(err).Err()
+	}
+
+	// The final progress update always claims that all files were processed,
+	// otherwise clients would wait for the remaining files forever.
+	connMu.Lock()
+	if filesProcessed < len(files) && ctx.Err() != nil {
+		truncated = true
+	}
+	connMu.Unlock()
+	if err := sendProgressUpdate(stream, connMu, len(files), len(files), truncated); err != nil {
+		log.Printf("%s %v\n", logprefix, err)
+	}
 
-	log.Printf("%s Sent all results.\n", logprefix)
+	log.Printf("%s Sent all results (%d matches, truncated: %v).\n", logprefix, sent, truncated)
 	return nil
 }
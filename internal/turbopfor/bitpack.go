@@ -0,0 +1,155 @@
+package turbopfor
+
+import "math/bits"
+
+// pad8 returns the number of bytes needed to store n bits.
+func pad8(n int) int {
+	return (n + 7) / 8
+}
+
+// bsr32 returns the number of bits needed to represent v.
+func bsr32(v uint32) int {
+	return bits.Len32(v)
+}
+
+// padded returns in if it is at least n bytes long, or a copy of in which is
+// padded with zero bytes to n bytes otherwise. The C implementation reads past
+// the end of truncated input, whereas the Go implementation treats missing
+// bytes as zero. In both cases, the returned number of bytes read exceeds the
+// length of the input.
+func padded(in []byte, n int) []byte {
+	if len(in) >= n {
+		return in
+	}
+	p := make([]byte, n)
+	copy(p, in)
+	return p
+}
+
+// bitpack32 stores the lowest b bits of each value of in in out (least
+// significant bit first) and returns the number of bytes written, which is
+// pad8(len(in)*b).
+func bitpack32(in []uint32, out []byte, b int) int {
+	if b == 0 {
+		return 0
+	}
+	var (
+		acc   uint64
+		nbits uint
+		o     int
+	)
+	mask := uint64(1)<<uint(b) - 1
+	for _, v := range in {
+		acc |= (uint64(v) & mask) << nbits
+		nbits += uint(b)
+		for nbits >= 8 {
+			out[o] = byte(acc)
+			o++
+			acc >>= 8
+			nbits -= 8
+		}
+	}
+	if nbits > 0 {
+		out[o] = byte(acc)
+		o++
+	}
+	return o
+}
+
+// bitunpack32 is the inverse of bitpack32: it fills out with b bit values
+// read from in and returns the number of bytes read.
+func bitunpack32(in []byte, out []uint32, b int) int {
+	n := pad8(len(out) * b)
+	if b == 0 {
+		for i := range out {
+			out[i] = 0
+		}
+		return 0
+	}
+	in = padded(in, n)
+	var (
+		acc   uint64
+		nbits uint
+		i     int
+	)
+	mask := uint64(1)<<uint(b) - 1
+	for o := range out {
+		for nbits < uint(b) {
+			acc |= uint64(in[i]) << nbits
+			i++
+			nbits += 8
+		}
+		out[o] = uint32(acc & mask)
+		acc >>= uint(b)
+		nbits -= uint(b)
+	}
+	return n
+}
+
+// bitpack256v32 stores the lowest b bits of each of the 256 values of in in
+// out and returns the number of bytes written, which is 32*b.
+//
+// The layout matches TurboPFor’s AVX2 vertical bit packing: value i belongs
+// to lane i%8 of eight 32-bit lanes, and each output word of 256 bits holds
+// the next 32 bits of each lane.
+func bitpack256v32(in []uint32, out []byte, b int) int {
+	n := 32 * b
+	for i := range out[:n] {
+		out[i] = 0
+	}
+	if b == 0 {
+		return 0
+	}
+	mask := uint64(1)<<uint(b) - 1
+	for row := 0; row < 32; row++ {
+		bit := row * b
+		w, sh := bit/32, uint(bit%32)
+		for lane := 0; lane < 8; lane++ {
+			v := (uint64(in[row*8+lane]) & mask) << sh
+			or32(out[(w*8+lane)*4:], uint32(v))
+			if sh+uint(b) > 32 {
+				or32(out[((w+1)*8+lane)*4:], uint32(v>>32))
+			}
+		}
+	}
+	return n
+}
+
+// bitunpack256v32 is the inverse of bitpack256v32: it fills the 256 values of
+// out with b bit values read from in and returns the number of bytes read.
+func bitunpack256v32(in []byte, out []uint32, b int) int {
+	n := 32 * b
+	if b == 0 {
+		for i := range out[:256] {
+			out[i] = 0
+		}
+		return 0
+	}
+	in = padded(in, n)
+	mask := uint64(1)<<uint(b) - 1
+	for row := 0; row < 32; row++ {
+		bit := row * b
+		w, sh := bit/32, uint(bit%32)
+		for lane := 0; lane < 8; lane++ {
+			v := uint64(le32(in[(w*8+lane)*4:])) >> sh
+			if sh+uint(b) > 32 {
+				v |= uint64(le32(in[((w+1)*8+lane)*4:])) << (32 - sh)
+			}
+			out[row*8+lane] = uint32(v & mask)
+		}
+	}
+	return n
+}
+
+func le32(b []byte) uint32 {
+	_ = b[3]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func or32(b []byte, v uint32) {
+	_ = b[3]
+	b[0] |= byte(v)
+	b[1] |= byte(v >> 8)
+	b[2] |= byte(v >> 16)
+	b[3] |= byte(v >> 24)
+}
@@ -0,0 +1,70 @@
+// +build !purego
+
+package turbopfor
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// randomInput returns n values with a random number of bits, and a few
+// exceptions, so that all block formats are exercised. The returned slice has
+// spare capacity, because the C implementation reads past its end.
+func randomInput(r *rand.Rand, n int) []uint32 {
+	input := make([]uint32, n, n+32)
+	bits := uint(r.Intn(33))
+	for i := range input {
+		input[i] = r.Uint32() >> (32 - bits)
+		if r.Intn(16) == 0 {
+			input[i] = r.Uint32() >> uint(r.Intn(32))
+		}
+	}
+	if r.Intn(8) == 0 {
+		for i := range input {
+			input[i] = input[0]
+		}
+	}
+	return input
+}
+
+// TestGoCompatible verifies that the Go implementation (used with -tags
+// purego) produces the same bytes as the C implementation, and decodes what
+// the C implementation encoded, in both the 128 and the 256v32 layout.
+func TestGoCompatible(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 2000; iter++ {
+		input := randomInput(r, 1+r.Intn(700))
+
+		want := P4nenc256v32(input)
+		got := make([]byte, Size(input))
+		got = got[:p4nenc(input, got, 256, p4enc256v32)]
+		if !bytes.Equal(got, want) {
+			t.Fatalf("p4nenc256v32(%v) = %x, want %x", input, got, want)
+		}
+
+		decoded := make([]uint32, len(input))
+		if n := p4ndec(want, decoded, 256, p4dec256v32); n != len(want) {
+			t.Fatalf("p4ndec256v32(%x) read %d bytes, want %d", want, n, len(want))
+		}
+		if !reflect.DeepEqual(decoded, input) {
+			t.Fatalf("p4ndec256v32(%x) = %v, want %v", want, decoded, input)
+		}
+
+		want = P4nenc32(input)
+		got = make([]byte, Size(input))
+		got = got[:p4nenc(input, got, 128, p4enc32)]
+		if !bytes.Equal(got, want) {
+			t.Fatalf("p4nenc32(%v) = %x, want %x", input, got, want)
+		}
+
+		decoded = make([]uint32, len(input))
+		if n := p4ndec(want, decoded, 128, p4dec32); n != len(want) {
+			t.Fatalf("p4ndec32(%x) read %d bytes, want %d", want, n, len(want))
+		}
+		if !reflect.DeepEqual(decoded, input) {
+			t.Fatalf("p4ndec32(%x) = %v, want %v", want, decoded, input)
+		}
+	}
+}
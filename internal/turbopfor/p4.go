@@ -0,0 +1,263 @@
+package turbopfor
+
+// This file implements TurboPFor’s p4enc32/p4dec32 and p4enc256v32/p4dec256v32
+// block formats in Go. Each block starts with a header byte:
+//
+//   b            values are bitpacked with b bits
+//   0x80|b, bx   values are bitpacked with b bits, exceptions (values which
+//                need more than b bits) store their remaining bits bitpacked
+//                with bx bits, see p4encExceptions
+//   0x40|b       like 0x80, but exceptions are variable byte encoded
+//   0xc0|b       all values are equal, the value is stored in pad8(b) bytes
+//
+// The 256v32 variants store the bitpacked values in the AVX2 vertical layout
+// (see bitpack256v32) instead of the scalar layout (see bitpack32).
+
+const (
+	bxVbyte    = 33 // exceptions are variable byte encoded
+	bxConstant = 34 // all values are equal
+)
+
+// p4bits32 returns the number of bits b with which the values of in should be
+// bitpacked and the number of bits bx of the exceptions (0 if there are none,
+// or bxVbyte, or bxConstant), using the same cost estimation as TurboPFor’s
+// _p4bits32.
+func p4bits32(in []uint32) (b, bx int) {
+	var (
+		cnt [33]int
+		u   uint32
+		eq  int
+	)
+	for _, v := range in {
+		cnt[bsr32(v)]++
+		u |= v
+		if v == in[0] {
+			eq++
+		}
+	}
+	b = bsr32(u)
+	if eq == len(in) && in[0] != 0 {
+		return b, bxConstant
+	}
+
+	// vb[32+i] estimates the variable byte encoded size of the exceptions
+	// when bitpacking with i bits.
+	var vb [32 + 33]int
+	addvb := func(c, b int) {
+		vb[32+b-7] += c
+		vb[32+b-15] += 2 * c
+		vb[32+b-19] += 3 * c
+		vb[32+b-25] += 4 * c
+	}
+
+	n := len(in)
+	ml := pad8(n*b) + 1 // size without exceptions
+	x := cnt[b]         // number of exceptions
+	addvb(x, b)
+	vv := x
+	best, vbyte := b, false
+	for i := b - 1; i >= 0; i-- {
+		l := pad8(n*i) + 2 + pad8(n) + pad8(x*(b-i)) // bitpacked exceptions
+		v := pad8(n*i) + 2 + x + vv                  // variable byte exceptions
+		addvb(cnt[i], i)
+		vv += cnt[i] + vb[32+i]
+		if l < ml {
+			ml, best, vbyte = l, i, false
+		}
+		if v < ml {
+			ml, best, vbyte = v, i, true
+		}
+		x += cnt[i]
+	}
+	if vbyte {
+		return best, bxVbyte
+	}
+	return best, b - best
+}
+
+// p4enc writes the block header and the encoding of in to out and returns
+// the number of bytes written. pack bitpacks the values.
+func p4enc(in []uint32, out []byte, pack func(in []uint32, out []byte, b int) int) int {
+	if len(in) == 0 {
+		return 0
+	}
+	b, bx := p4bits32(in)
+	var o int
+	switch {
+	case bx == 0:
+		out[0] = byte(b)
+		return 1 + pack(in, out[1:], b)
+	case bx == bxConstant:
+		out[0] = 0xc0 | byte(b)
+		for i := 0; i < pad8(b); i++ {
+			out[1+i] = byte(in[0] >> (8 * uint(i)))
+		}
+		return 1 + pad8(b)
+	case bx == bxVbyte:
+		out[0] = 0x40 | byte(b)
+		o = 1
+	default:
+		out[0] = 0x80 | byte(b)
+		out[1] = byte(bx)
+		o = 2
+	}
+	return o + p4encExceptions(in, out[o:], b, bx, pack)
+}
+
+// p4encExceptions writes the encoding of in to out, given b and bx (which must
+// be bitpacked or variable byte exceptions), and returns the number of bytes
+// written.
+//
+// With bitpacked exceptions, a bitmap of the exception positions is followed
+// by the bitpacked exceptions and the bitpacked values. With variable byte
+// exceptions, the number of exceptions is followed by the bitpacked values,
+// the variable byte encoded exceptions and the exception positions.
+func p4encExceptions(in []uint32, out []byte, b, bx int, pack func(in []uint32, out []byte, b int) int) int {
+	var (
+		base [256]uint32
+		inx  [256]uint32 // remaining bits of the exceptions
+		miss [256]byte   // positions of the exceptions
+		xn   int
+	)
+	mask := uint32(1)<<uint(b) - 1
+	for i, v := range in {
+		base[i] = v & mask
+		if v > mask {
+			miss[xn] = byte(i)
+			inx[xn] = v >> uint(b)
+			xn++
+		}
+	}
+	n := len(in)
+	var o int
+	if bx <= 32 {
+		xmap := out[:pad8(n)]
+		for i := range xmap {
+			xmap[i] = 0
+		}
+		for _, c := range miss[:xn] {
+			xmap[c/8] |= 1 << (c % 8)
+		}
+		o = len(xmap)
+		o += bitpack32(inx[:xn], out[o:], bx)
+		o += pack(base[:n], out[o:], b)
+		return o
+	}
+	out[0] = byte(xn)
+	o = 1
+	o += pack(base[:n], out[o:], b)
+	o += vbenc32(inx[:xn], out[o:])
+	o += copy(out[o:], miss[:xn])
+	return o
+}
+
+// p4dec fills out with the values of the block in in and returns the number
+// of bytes read. unpack reads bitpacked values.
+func p4dec(in []byte, out []uint32, unpack func(in []byte, out []uint32, b int) int) int {
+	if len(out) == 0 {
+		return 0
+	}
+	in = padded(in, 2)
+	hdr := in[0]
+	switch {
+	case hdr&0xc0 == 0xc0:
+		b := int(hdr & 0x3f)
+		p := padded(tail(in, 1), pad8(b))
+		var v uint32
+		for i := 0; i < pad8(b); i++ {
+			v |= uint32(p[i]) << (8 * uint(i))
+		}
+		for i := range out {
+			out[i] = v
+		}
+		return 1 + pad8(b)
+
+	case hdr&0x40 != 0:
+		b := int(hdr & 0x3f)
+		xn := int(in[1])
+		o := 2
+		o += unpack(tail(in, o), out, b)
+		var inx [256]uint32
+		o += vbdec32(tail(in, o), inx[:xn])
+		miss := padded(tail(in, o), xn)
+		for i, v := range inx[:xn] {
+			if c := int(miss[i]); c < len(out) {
+				out[c] |= v << uint(b)
+			}
+		}
+		return o + xn
+
+	case hdr&0x80 != 0:
+		b := int(hdr & 0x7f)
+		bx := int(in[1])
+		o := 2
+		xmap := padded(tail(in, o), pad8(len(out)))[:pad8(len(out))]
+		o += len(xmap)
+		var xn int
+		for i := range out {
+			if xmap[i/8]&(1<<(uint(i)%8)) != 0 {
+				xn++
+			}
+		}
+		var inx [256]uint32
+		o += bitunpack32(tail(in, o), inx[:xn], bx)
+		o += unpack(tail(in, o), out, b)
+		var x int
+		for i := range out {
+			if xmap[i/8]&(1<<(uint(i)%8)) != 0 {
+				out[i] |= inx[x] << uint(b)
+				x++
+			}
+		}
+		return o
+
+	default:
+		return 1 + unpack(tail(in, 1), out, int(hdr))
+	}
+}
+
+func p4enc32(in []uint32, out []byte) int {
+	return p4enc(in, out, bitpack32)
+}
+
+func p4dec32(in []byte, out []uint32) int {
+	return p4dec(in, out, bitunpack32)
+}
+
+// p4enc256v32 encodes exactly 256 values.
+func p4enc256v32(in []uint32, out []byte) int {
+	return p4enc(in, out, bitpack256v32)
+}
+
+// p4dec256v32 decodes exactly 256 values.
+func p4dec256v32(in []byte, out []uint32) int {
+	return p4dec(in, out, bitunpack256v32)
+}
+
+// p4nenc writes the encoding of in to out in blocks of blockSize values
+// (encoded with enc) followed by the remaining values (encoded with
+// p4enc32), and returns the number of bytes written.
+func p4nenc(in []uint32, out []byte, blockSize int, enc func(in []uint32, out []byte) int) int {
+	var o int
+	for ; len(in) >= blockSize; in = in[blockSize:] {
+		o += enc(in[:blockSize], out[o:])
+	}
+	return o + p4enc32(in, out[o:])
+}
+
+// p4ndec is the inverse of p4nenc.
+func p4ndec(in []byte, out []uint32, blockSize int, dec func(in []byte, out []uint32) int) int {
+	var i int
+	for ; len(out) >= blockSize; out = out[blockSize:] {
+		i += dec(tail(in, i), out[:blockSize])
+	}
+	return i + p4dec32(tail(in, i), out)
+}
+
+// tail returns in[o:], or nil if o is beyond the end of in.
+func tail(in []byte, o int) []byte {
+	if o > len(in) {
+		return nil
+	}
+	return in[o:]
+}
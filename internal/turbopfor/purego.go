@@ -0,0 +1,52 @@
+// +build purego
+
+package turbopfor
+
+// This file provides the API of turbopfor.go without cgo, using the Go
+// implementation of the TurboPFor formats, which is byte-compatible with the
+// C implementation. Build with -tags purego to use it, e.g. for
+// cross-compiling, race detector builds or non-x86 architectures.
+//
+// Only the functions which the index uses are provided.
+
+// P4nenc32 encodes input in blocks of 128 values.
+func P4nenc32(input []uint32) []byte {
+	buffer := make([]byte, Size(input))
+	return buffer[:p4nenc(input, buffer, 128, p4enc32)]
+}
+
+func P4enc32(input []uint32) []byte {
+	buffer := make([]byte, Size(input))
+	return buffer[:p4enc32(input, buffer)]
+}
+
+func Size(input []uint32) int {
+	n := len(input)
+	return ((n + 127) / 128) + (n+32)*4
+}
+
+func P4enc256v32(input []uint32, output []byte) int {
+	return p4enc256v32(input, output)
+}
+
+func P4nenc256v32(input []uint32) []byte {
+	buffer := make([]byte, Size(input))
+	return buffer[:p4nenc(input, buffer, 256, p4enc256v32)]
+}
+
+func P4dec32(input []byte, output []uint32) (read int) {
+	return p4dec32(input, output)
+}
+
+// P4ndec32 decodes output in blocks of 128 values.
+func P4ndec32(input []byte, output []uint32) (read int) {
+	return p4ndec(input, output, 128, p4dec32)
+}
+
+func P4dec256v32(input []byte, output []uint32) (read int) {
+	return p4dec256v32(input, output)
+}
+
+func P4ndec256v32(input []byte, output []uint32) (read int) {
+	return p4ndec(input, output, 256, p4dec256v32)
+}
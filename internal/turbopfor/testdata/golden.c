@@ -0,0 +1,71 @@
+// golden.c writes the testdata/*.golden files using the TurboPFor C encoder.
+// Run from internal/turbopfor:
+//
+//   gcc -o /tmp/golden testdata/golden.c vp4c.o vp4c_avx2.o bitpack.o bitutil.o vint.o -lm
+//   /tmp/golden p4nenc32 > testdata/p4nenc32.golden
+//   /tmp/golden p4nenc256v32 > testdata/p4nenc256v32.golden
+//
+// This repository does not contain bitpack_avx2.o, so this file provides
+// bitpack256v32, the only function p4nenc256v32 needs from it, following
+// TurboPFor's AVX2 layout: value i is stored in 32-bit lane i%8, and each lane
+// is bitpacked like bitpack32. When linking against a full TurboPFor build,
+// add -DHAVE_BITPACK_AVX2 to use its implementation instead.
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+size_t p4nenc32(uint32_t *in, size_t n, unsigned char *out);
+size_t p4nenc256v32(uint32_t *in, size_t n, unsigned char *out);
+
+// vp4c.o references the decoders, which are never called here.
+void p4dec16(void) { abort(); }
+void p4dec32(void) { abort(); }
+void p4dec64(void) { abort(); }
+
+#ifndef HAVE_BITPACK_AVX2
+unsigned char *bitpack256v32(unsigned *in, unsigned n, unsigned char *out, unsigned b) {
+	uint32_t *o = (uint32_t *)out;
+	memset(out, 0, 32 * b);
+	for (unsigned row = 0; b > 0 && row < 32; row++) {
+		unsigned bit = row * b, w = bit / 32, shift = bit % 32;
+		for (unsigned lane = 0; lane < 8; lane++) {
+			uint64_t v = in[row * 8 + lane];
+			if (b < 32)
+				v &= (1u << b) - 1;
+			v <<= shift;
+			o[w * 8 + lane] |= (uint32_t)v;
+			if (shift + b > 32)
+				o[(w + 1) * 8 + lane] |= (uint32_t)(v >> 32);
+		}
+	}
+	return out + 32 * b;
+}
+#endif
+
+// Keep in sync with goldenInput in golden_test.go.
+int main(int argc, char **argv) {
+	uint32_t in[300 + 32] = {0};
+	unsigned char out[4096];
+	size_t n;
+	for (int i = 0; i < 300; i++) {
+		if (i < 128 && i % 17 == 0)
+			in[i] = (1u << 20) + i;
+		else if (i < 128)
+			in[i] = (uint32_t)(i * 7) % 64;
+		else if (i < 256)
+			in[i] = 5;
+		else
+			in[i] = (uint32_t)(i * i);
+	}
+	if (argc == 2 && strcmp(argv[1], "p4nenc32") == 0)
+		n = p4nenc32(in, 300, out);
+	else if (argc == 2 && strcmp(argv[1], "p4nenc256v32") == 0)
+		n = p4nenc256v32(in, 300, out);
+	else {
+		fprintf(stderr, "usage: %s p4nenc32|p4nenc256v32\n", argv[0]);
+		return 2;
+	}
+	fwrite(out, 1, n, stdout);
+	return 0;
+}
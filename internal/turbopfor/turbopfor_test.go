@@ -75,57 +75,6 @@ func TestEncode(t *testing.T) {
 	}
 }
 
-func TestDeltaEncode(t *testing.T) {
-	t.Skipf("TODO: investigate this test failure")
-	for _, test := range []struct {
-		name  string
-		input []uint32
-		want  []byte
-	}{
-		{
-			name:  "small",
-			input: []uint32{3, 4, 5, 6, 9, 10, 15, 17, 18, 333},
-			want:  []byte{0x03, 0x43, 0x01, 0x00, 0x04, 0x06, 0x42, 0x27, 0x08},
-		},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			padded := make([]uint32, len(test.input)+32)
-			copy(padded, test.input)
-			padded = padded[:len(test.input)]
-			got := turbopfor.P4nd1enc32(padded)
-			if !bytes.Equal(got, test.want) {
-				t.Fatalf("got %x, want %x", got, test.want)
-			}
-		})
-	}
-}
-
-func TestDeltaDecode(t *testing.T) {
-	t.Skipf("TODO: investigate this test failure")
-	for _, test := range []struct {
-		name  string
-		input []byte
-		want  []uint32
-	}{
-		{
-			name:  "small",
-			input: []byte{0x03, 0x43, 0x01, 0x00, 0x04, 0x06, 0x42, 0x27, 0x08},
-			want:  []uint32{3, 4, 5, 6, 9, 10, 15, 17, 18, 333},
-		},
-	} {
-		t.Run(test.name, func(t *testing.T) {
-			buffer := make([]uint32, len(test.want), len(test.want)+32)
-			num := turbopfor.P4nd1dec32(test.input, buffer)
-			if got, want := num, len(test.input); got != want {
-				t.Fatalf("got %d, want %d", got, want)
-			}
-			if !reflect.DeepEqual(buffer, test.want) {
-				t.Fatalf("got %v, want %v", buffer, test.want)
-			}
-		})
-	}
-}
-
 func TestChunkedEncode(t *testing.T) {
 	input := make([]uint32, 275, 275+32)
 	for idx := range input {
@@ -165,3 +114,34 @@ func TestChunkedDecode(t *testing.T) {
 		t.Fatalf("got %x\nwant %x", got, input)
 	}
 }
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 1000; iter++ {
+		input := make([]uint32, 1+r.Intn(700), 700+32)
+		shift := uint(r.Intn(33))
+		for idx := range input {
+			input[idx] = uint32(r.Uint64() >> (32 + shift))
+			if r.Intn(16) == 0 {
+				input[idx] = r.Uint32()
+			}
+		}
+
+		got := make([]uint32, len(input))
+		encoded := turbopfor.P4nenc256v32(input)
+		if n := turbopfor.P4ndec256v32(encoded, got); n != len(encoded) {
+			t.Fatalf("P4ndec256v32 read %d bytes, want %d", n, len(encoded))
+		}
+		if !reflect.DeepEqual(got, input) {
+			t.Fatalf("P4ndec256v32(P4nenc256v32(%v)) = %v", input, got)
+		}
+
+		encoded = turbopfor.P4nenc32(input)
+		if n := turbopfor.P4ndec32(encoded, got); n != len(encoded) {
+			t.Fatalf("P4ndec32 read %d bytes, want %d", n, len(encoded))
+		}
+		if !reflect.DeepEqual(got, input) {
+			t.Fatalf("P4ndec32(P4nenc32(%v)) = %v", input, got)
+		}
+	}
+}
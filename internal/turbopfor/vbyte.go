@@ -0,0 +1,98 @@
+package turbopfor
+
+// TurboPFor’s variable byte encoding, which stores small values in a single
+// byte and uses the first byte of larger values to indicate their length.
+const (
+	vbOfs1 = 177                // values below vbOfs1 take 1 byte
+	vbOfs2 = vbOfs1 + (1 << 14) // values below vbOfs2 take 2 bytes
+	vbOfs3 = vbOfs2 + (1 << 19) // values below vbOfs3 take 3 bytes
+	vbBA2  = vbOfs1 + (1 << 6)  // first byte of 3 byte values
+	vbBA3  = vbBA2 + (1 << 3)   // first byte of 4 and 5 byte values
+
+	// vbRaw marks a sequence of values which is stored as 4 bytes per value
+	// because the variable byte encoding would have been larger.
+	vbRaw = 0xff
+)
+
+// vbenc32 writes the variable byte encoding of in to out and returns the
+// number of bytes written.
+func vbenc32(in []uint32, out []byte) int {
+	var o int
+	for _, x := range in {
+		switch {
+		case x < vbOfs1:
+			out[o] = byte(x)
+			o++
+		case x < vbOfs2:
+			x -= vbOfs1
+			out[o] = vbOfs1 + byte(x>>8)
+			out[o+1] = byte(x)
+			o += 2
+		case x < vbOfs3:
+			x -= vbOfs2
+			out[o] = vbBA2 + byte(x>>16)
+			out[o+1] = byte(x)
+			out[o+2] = byte(x >> 8)
+			o += 3
+		case x < 1<<24:
+			out[o] = vbBA3
+			out[o+1] = byte(x)
+			out[o+2] = byte(x >> 8)
+			out[o+3] = byte(x >> 16)
+			o += 4
+		default:
+			out[o] = vbBA3 + 1
+			out[o+1] = byte(x)
+			out[o+2] = byte(x >> 8)
+			out[o+3] = byte(x >> 16)
+			out[o+4] = byte(x >> 24)
+			o += 5
+		}
+	}
+	if o > 4*len(in) {
+		out[0] = vbRaw
+		o = 1
+		for _, x := range in {
+			out[o] = byte(x)
+			out[o+1] = byte(x >> 8)
+			out[o+2] = byte(x >> 16)
+			out[o+3] = byte(x >> 24)
+			o += 4
+		}
+	}
+	return o
+}
+
+// vbdec32 is the inverse of vbenc32: it fills out with values read from in
+// and returns the number of bytes read.
+func vbdec32(in []byte, out []uint32) int {
+	in = padded(in, 5*len(out))
+	if len(out) > 0 && in[0] == vbRaw {
+		for o := range out {
+			out[o] = le32(in[1+4*o:])
+		}
+		return 1 + 4*len(out)
+	}
+	var i int
+	for o := range out {
+		x := uint32(in[i])
+		switch {
+		case x < vbOfs1:
+			i++
+		case x < vbBA2:
+			x = (x-vbOfs1)<<8 | uint32(in[i+1]) + vbOfs1
+			i += 2
+		case x < vbBA3:
+			x = ((x-vbBA2)<<16 | uint32(in[i+1]) | uint32(in[i+2])<<8) + vbOfs2
+			i += 3
+		case x == vbBA3:
+			x = uint32(in[i+1]) | uint32(in[i+2])<<8 | uint32(in[i+3])<<16
+			i += 4
+		default:
+			x = le32(in[i+1:])
+			i += 5
+		}
+		out[o] = x
+	}
+	return i
+}
@@ -41,6 +41,13 @@ func ReadRankingData(path string) error {
 	return json.NewDecoder(f).Decode(&storedRanking)
 }
 
+// Installations returns the normalized popcon installation count of
+// sourcePackage (see dcs-compute-ranking), or 0 if the ranking data does not
+// contain sourcePackage.
+func Installations(sourcePackage string) float32 {
+	return storedRanking[sourcePackage].Inst
+}
+
 // The regular expression trigram index provides us a path to a potential
 // result. This data structure represents such a path and allows for ranking
 // and sorting each path.
@@ -355,11 +355,19 @@ type Grep struct {
 	Stdout io.Writer // output target
 	Stderr io.Writer // error target
 
-	L bool // L flag - print file names only
-	C bool // C flag - print count of matches
+	L bool // L flag - print file names only; Reader stops at the first match
+	C bool // C flag - print count of matches; Reader only sets Path and Line
 	N bool // N flag - print line numbers
 	H bool // H flag - do not print file names
 
+	// ContextLines is the number of lines before and after each match to
+	// return in Match.Before and Match.After.
+	ContextLines int
+
+	// AllMatches makes Reader return a separate Match for each
+	// non-overlapping occurrence on a line, not just one Match per line.
+	AllMatches bool
+
 	Match bool
 
 	buf []byte
@@ -401,23 +409,66 @@ type Match struct {
 	Path string
 	Line int
 
-	// contents of line (Line - 2)
-	Ctxp2 string
-	// contents of line (Line - 1)
-	Ctxp1 string
+	// Contents of the (at most Grep.ContextLines) lines before Line, in
+	// file order.
+	Before []string
 	// XXX: The following will most likely change after we figure out how
 	// to highlight the found text properly :).
 	Context string
-	// contents of line (Line + 1)
-	Ctxn1 string
-	// contents of line (Line + 2)
-	Ctxn2 string
+	// Byte offsets of the match and its capture groups within Context, as
+	// returned by Regexp.SubmatchIndex.
+	Submatches []int
+	// Contents of the (at most Grep.ContextLines) lines after Line, in file
+	// order.
+	After []string
 
 	// This will be filled in by the source backend
 	PathRank float32
 	Ranking  float32
 }
 
+// firstLines returns up to n complete (\n-terminated) lines from the
+// beginning of b, HTML-escaped.
+func firstLines(b []byte, n int) []string {
+	var lines []string
+	for len(lines) < n {
+		idx := bytes.IndexByte(b, '\n')
+		if idx == -1 {
+			break
+		}
+		lines = append(lines, html.EscapeString(string(b[:idx])))
+		b = b[idx+1:]
+	}
+	return lines
+}
+
+// lastLines returns up to n lines from the end of b, which must either be
+// empty or end in \n, HTML-escaped and in file order.
+func lastLines(b []byte, n int) []string {
+	var lines []string
+	for len(b) > 0 && len(lines) < n {
+		b = b[:len(b)-1]
+		start := bytes.LastIndexByte(b, '\n') + 1
+		lines = append(lines, html.EscapeString(string(b[start:])))
+		b = b[:start]
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// appendTail appends the last n elements of prev (or all of prev if it
+// has fewer elements) and then lines to a new slice.
+func appendTail(prev []string, n int, lines []string) []string {
+	if n > len(prev) {
+		n = len(prev)
+	}
+	result := make([]string, 0, n+len(lines))
+	result = append(result, prev[len(prev)-n:]...)
+	return append(result, lines...)
+}
+
 func (g *Grep) Reader(r io.Reader, name string) []Match {
 	var result []Match
 	if g.buf == nil {
@@ -425,15 +476,21 @@ func (g *Grep) Reader(r io.Reader, name string) []Match {
 		g.buf = make([]byte, 1<<20)
 	}
 	var (
-		buf         = g.buf[:0]
-		lineno      = 1
-		bufLineNo   = 0
-		beginText   = true
-		endText     = false
-		needContext = 0
-		lastp1      = ""
-		lastp2      = ""
+		buf       = g.buf[:0]
+		lineno    = 1
+		beginText = true
+		endText   = false
+		ctxLines  = g.ContextLines
+		// indexes into result of matches which still need lines of
+		// context from the next buffer.
+		needContext []int
+		// the last ctxLines lines before the current buffer.
+		prev []string
 	)
+	if g.L || g.C {
+		// Only the matching lines are of interest.
+		ctxLines = 0
+	}
 	for {
 		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
 		buf = buf[:len(buf)+n]
@@ -445,22 +502,23 @@ func (g *Grep) Reader(r io.Reader, name string) []Match {
 			endText = true
 		}
 		chunkStart := 0
-		bufLineNo = 0
-		//fmt.Printf("need to add %d context lines to the last match\n", needContext)
-		if needContext > 0 {
-			lineEnd := bytes.Index(buf[:end], nl)
-			if lineEnd != -1 {
-				result[len(result)-1].Ctxn1 = string(buf[:lineEnd])
-				//fmt.Printf("afterwards: ctxn1 = *%s*\n", result[len(result)-1].Ctxn1)
-				if needContext > 1 {
-					nextLineEnd := bytes.Index(buf[lineEnd+1:end], nl)
-					if nextLineEnd != -1 {
-						result[len(result)-1].Ctxn2 = string(buf[lineEnd+1 : lineEnd+1+nextLineEnd])
-						//fmt.Printf("afterwards: ctxn2 = *%s*\n", result[len(result)-1].Ctxn2)
-					}
+		if len(needContext) > 0 {
+			lines := firstLines(buf[:end], ctxLines)
+			pending := needContext[:0]
+			for _, idx := range needContext {
+				m := &result[idx]
+				need := ctxLines - len(m.After)
+				if need > len(lines) {
+					need = len(lines)
+				}
+				// Matches on the same line share m.After, so copy
+				// instead of appending in place.
+				m.After = append(m.After[:len(m.After):len(m.After)], lines[:need]...)
+				if len(m.After) < ctxLines && len(lines) < ctxLines && !endText {
+					pending = append(pending, idx)
 				}
 			}
-			needContext = 0
+			needContext = pending
 		}
 
 		//fmt.Printf("looking at line *%s*\n", buf[0:end])
@@ -479,50 +537,58 @@ func (g *Grep) Reader(r io.Reader, name string) []Match {
 			//fmt.Printf("matching line: %s", buf[lineStart:lineEnd])
 
 			lineno += countNL(buf[chunkStart:lineStart])
-			line := html.EscapeString(string(buf[lineStart : lineEnd-1]))
+			raw := buf[lineStart : lineEnd-1]
+			if g.L {
+				return append(result, Match{Path: name, Line: lineno})
+			}
+			if g.C {
+				match := Match{Path: name, Line: lineno}
+				n := 1
+				if g.AllMatches {
+					if all := g.Regexp.std.FindAllIndex(raw, -1); len(all) > 0 {
+						n = len(all)
+					}
+				}
+				for i := 0; i < n; i++ {
+					result = append(result, match)
+				}
+				lineno++
+				chunkStart = lineEnd
+				continue
+			}
 			match := Match{
 				Path:    name,
 				Line:    lineno,
-				Context: string(line),
+				Context: html.EscapeString(string(raw)),
 			}
-			// Let’s find the previous two lines, if possible.
-			bufLineNo = countNL(buf[:lineStart])
-			if bufLineNo >= 1 {
-				prev1Start := bytes.LastIndex(buf[:lineStart-1], nl) + 1
-				match.Ctxp1 = html.EscapeString(string(buf[prev1Start : lineStart-1]))
-				if bufLineNo >= 2 {
-					prev2Start := bytes.LastIndex(buf[:prev1Start-1], nl) + 1
-					match.Ctxp2 = html.EscapeString(string(buf[prev2Start : prev1Start-1]))
-				} else {
-					match.Ctxp2 = lastp1
+			if ctxLines > 0 {
+				match.Before = lastLines(buf[:lineStart], ctxLines)
+				if len(match.Before) < ctxLines {
+					// The buffer starts within the context, so take the
+					// remaining lines from the previous buffer.
+					match.Before = appendTail(prev, ctxLines-len(match.Before), match.Before)
 				}
-			} else {
-				match.Ctxp1 = lastp1
-				match.Ctxp2 = lastp2
+				match.After = firstLines(buf[lineEnd:end], ctxLines)
 			}
-			needContext = 0
-			if lineEnd < end {
-				//fmt.Printf("lineEnd = %d, end = %d\n", lineEnd, end)
-				next1Start := bytes.Index(buf[lineEnd:end], nl)
-				//fmt.Printf("next1Start = %d\n", next1Start)
-				if next1Start != -1 {
-					next1Start = next1Start + lineEnd + 1
-					match.Ctxn1 = html.EscapeString(string(buf[lineEnd : next1Start-1]))
-					if next1Start < end {
-						next2Start := bytes.Index(buf[next1Start:end], nl)
-						if next2Start != -1 {
-							match.Ctxn2 = html.EscapeString(string(buf[next1Start : next1Start+next2Start]))
-						}
-					} else {
-						needContext = 1
-					}
+			first := len(result)
+			if g.AllMatches {
+				all := g.Regexp.AllSubmatchIndex(raw)
+				for _, submatches := range all {
+					match.Submatches = submatches
+					result = append(result, match)
+				}
+				if len(all) == 0 {
+					result = append(result, match)
 				}
 			} else {
-				needContext = 2
+				match.Submatches = g.Regexp.SubmatchIndex(raw)
+				result = append(result, match)
+			}
+			if ctxLines > 0 && len(match.After) < ctxLines && !endText {
+				for idx := first; idx < len(result); idx++ {
+					needContext = append(needContext, idx)
+				}
 			}
-			//fmt.Printf("ctxn1 = *%s*\n", match.Ctxn1)
-			//fmt.Printf("ctxn2 = *%s*\n", match.Ctxn2)
-			result = append(result, match)
 			lineno++
 			chunkStart = lineEnd
 		}
@@ -530,21 +596,11 @@ func (g *Grep) Reader(r io.Reader, name string) []Match {
 			lineno += countNL(buf[chunkStart:end])
 		}
 
-		// We are about to read again, so let’s store the last two lines in
-		// case the next match needs them.
-		if bufLineNo == 0 {
-			// This could be because there was no match and we didn’t count, so
-			// make sure we count.
-			bufLineNo = countNL(buf[:end])
-			//fmt.Printf("lineno = %d\n", bufLineNo)
-		}
-		if bufLineNo > 1 {
-			prev1Start := bytes.LastIndex(buf[:end-1], nl) + 1
-			lastp1 = html.EscapeString(string(buf[prev1Start : end-1]))
-			if bufLineNo > 2 {
-				prev2Start := bytes.LastIndex(buf[:prev1Start-1], nl) + 1
-				lastp2 = html.EscapeString(string(buf[prev2Start : prev1Start-1]))
-			}
+		// We are about to read again, so let’s store the last lines in case
+		// the next match needs them.
+		if ctxLines > 0 {
+			lines := lastLines(buf[:end], ctxLines)
+			prev = appendTail(prev, ctxLines-len(lines), lines)
 		}
 
 		// Copy the remaining elements to the front (everything after the next newline)
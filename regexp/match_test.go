@@ -1,6 +1,7 @@
 package regexp
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -36,17 +37,14 @@ func TestMatchContextAfter(t *testing.T) {
 		t.Fatalf("Compile(%#q): %v", "fnord", err)
 	}
 
-	g := Grep{}
+	g := Grep{ContextLines: 2}
 	g.Regexp = re
 	matches := g.Reader(strings.NewReader(string(buffer)), "input")
 	if len(matches) != 1 {
 		t.Fatalf("Expected precisely one match, got %d", len(matches))
 	}
-	if matches[0].Ctxn1 != "ctx1" {
-		t.Errorf("Context +1 wrong: %s", matches[0].Ctxn1)
-	}
-	if matches[0].Ctxn2 != "ba" {
-		t.Errorf("Context +2 wrong: %s", matches[0].Ctxn2)
+	if want := []string{"ctx1", "ba"}; !reflect.DeepEqual(matches[0].After, want) {
+		t.Errorf("Context after wrong: got %q, want %q", matches[0].After, want)
 	}
 
 	re, err = Compile("ba")
@@ -58,11 +56,8 @@ func TestMatchContextAfter(t *testing.T) {
 	if len(matches) != 1 {
 		t.Fatalf("Expected precisely one match, got %d", len(matches))
 	}
-	if matches[0].Ctxp1 != "ctx1" {
-		t.Errorf("Context -1 wrong: %s", matches[0].Ctxp1)
-	}
-	if matches[0].Ctxp2 != "fnord" {
-		t.Errorf("Context -2 wrong: %s", matches[0].Ctxp2)
+	if want := []string{"fnord", "ctx1"}; !reflect.DeepEqual(matches[0].Before, want) {
+		t.Errorf("Context before wrong: got %q, want %q", matches[0].Before, want)
 	}
 }
 
@@ -97,16 +92,129 @@ func TestMatchContextBefore(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Compile(%#q): %v", "ba", err)
 	}
-	g := Grep{}
+	g := Grep{ContextLines: 2}
 	g.Regexp = re
 	matches := g.Reader(strings.NewReader(string(buffer)), "input")
 	if len(matches) != 1 {
 		t.Fatalf("Expected precisely one match, got %d", len(matches))
 	}
-	if matches[0].Ctxp1 != "ctx1" {
-		t.Errorf("Context -1 wrong: %s", matches[0].Ctxp1)
+	if want := []string{"fnord", "ctx1"}; !reflect.DeepEqual(matches[0].Before, want) {
+		t.Errorf("Context before wrong: got %q, want %q", matches[0].Before, want)
+	}
+}
+
+func TestMatchContextLines(t *testing.T) {
+	input := "l1\nl2\nl3\nmatch\nl5\nl6\nl7\n"
+	re, err := Compile("match")
+	if err != nil {
+		t.Fatalf("Compile(%#q): %v", "match", err)
+	}
+	for _, tt := range []struct {
+		contextLines  int
+		before, after []string
+	}{
+		{0, nil, nil},
+		{1, []string{"l3"}, []string{"l5"}},
+		{3, []string{"l1", "l2", "l3"}, []string{"l5", "l6", "l7"}},
+		{20, []string{"l1", "l2", "l3"}, []string{"l5", "l6", "l7"}},
+	} {
+		g := Grep{Regexp: re, ContextLines: tt.contextLines}
+		matches := g.Reader(strings.NewReader(input), "input")
+		if len(matches) != 1 {
+			t.Fatalf("Expected precisely one match, got %d", len(matches))
+		}
+		if got := matches[0].Before; !reflect.DeepEqual(got, tt.before) {
+			t.Errorf("ContextLines=%d: Before = %q, want %q", tt.contextLines, got, tt.before)
+		}
+		if got := matches[0].After; !reflect.DeepEqual(got, tt.after) {
+			t.Errorf("ContextLines=%d: After = %q, want %q", tt.contextLines, got, tt.after)
+		}
+	}
+}
+
+func TestMatchContextLinesAcrossBuffers(t *testing.T) {
+	bufferSize := 1 << 20
+	var input strings.Builder
+	for input.Len() < bufferSize-len("l1\nl2\nl3\nmatch\n") {
+		input.WriteString("x\n")
+	}
+	input.WriteString("l1\nl2\nl3\nmatch\nl5\nl6\nl7\nl8\n")
+
+	re, err := Compile("match")
+	if err != nil {
+		t.Fatalf("Compile(%#q): %v", "match", err)
+	}
+	g := Grep{Regexp: re, ContextLines: 5}
+	matches := g.Reader(strings.NewReader(input.String()), "input")
+	if len(matches) != 1 {
+		t.Fatalf("Expected precisely one match, got %d", len(matches))
+	}
+	if want := []string{"x", "x", "l1", "l2", "l3"}; !reflect.DeepEqual(matches[0].Before, want) {
+		t.Errorf("Context before wrong: got %q, want %q", matches[0].Before, want)
+	}
+	if want := []string{"l5", "l6", "l7", "l8"}; !reflect.DeepEqual(matches[0].After, want) {
+		t.Errorf("Context after wrong: got %q, want %q", matches[0].After, want)
+	}
+}
+
+func TestMatchAllMatches(t *testing.T) {
+	input := "foo foo\nbar\nfoo\n"
+	re, err := Compile("fo(o)")
+	if err != nil {
+		t.Fatalf("Compile(%#q): %v", "fo(o)", err)
+	}
+	for _, tt := range []struct {
+		allMatches bool
+		lines      []int
+		submatches [][]int
+	}{
+		{false, []int{1, 3}, [][]int{{0, 3, 2, 3}, {0, 3, 2, 3}}},
+		{true, []int{1, 1, 3}, [][]int{{0, 3, 2, 3}, {4, 7, 6, 7}, {0, 3, 2, 3}}},
+	} {
+		g := Grep{Regexp: re, AllMatches: tt.allMatches}
+		matches := g.Reader(strings.NewReader(input), "input")
+		var lines []int
+		var submatches [][]int
+		for _, m := range matches {
+			lines = append(lines, m.Line)
+			submatches = append(submatches, m.Submatches)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("AllMatches=%v: lines = %v, want %v", tt.allMatches, lines, tt.lines)
+		}
+		if !reflect.DeepEqual(submatches, tt.submatches) {
+			t.Errorf("AllMatches=%v: submatches = %v, want %v", tt.allMatches, submatches, tt.submatches)
+		}
+	}
+}
+
+func TestMatchFilesAndCountOnly(t *testing.T) {
+	input := "foo foo\nbar\nfoo\n"
+	re, err := Compile("foo")
+	if err != nil {
+		t.Fatalf("Compile(%#q): %v", "foo", err)
 	}
-	if matches[0].Ctxp2 != "fnord" {
-		t.Errorf("Context -2 wrong: %s", matches[0].Ctxp2)
+	for _, tt := range []struct {
+		g    Grep
+		want []Match
+	}{
+		{
+			g:    Grep{L: true, ContextLines: 2},
+			want: []Match{{Path: "input", Line: 1}},
+		},
+		{
+			g:    Grep{C: true, ContextLines: 2},
+			want: []Match{{Path: "input", Line: 1}, {Path: "input", Line: 3}},
+		},
+		{
+			g:    Grep{C: true, AllMatches: true},
+			want: []Match{{Path: "input", Line: 1}, {Path: "input", Line: 1}, {Path: "input", Line: 3}},
+		},
+	} {
+		g := tt.g
+		g.Regexp = re
+		if got := g.Reader(strings.NewReader(input), "input"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Grep{L: %v, C: %v, AllMatches: %v}.Reader() = %+v, want %+v", g.L, g.C, g.AllMatches, got, tt.want)
+		}
 	}
 }
@@ -6,7 +6,11 @@
 // use in grep-like programs.
 package regexp
 
-import "regexp/syntax"
+import (
+	stdregexp "regexp"
+	"regexp/syntax"
+	"sort"
+)
 
 func bug() {
 	panic("codesearch/regexp: internal error")
@@ -18,6 +22,10 @@ type Regexp struct {
 	Syntax *syntax.Regexp
 	expr   string // original expression
 	m      matcher
+
+	// std is used to locate the match (and its capture groups) within a
+	// line which the DFA matched.
+	std *stdregexp.Regexp
 }
 
 // String returns the source text used to compile the regular expression.
@@ -25,13 +33,45 @@ func (re *Regexp) String() string {
 	return re.expr
 }
 
+// Options modify how an expression is interpreted by CompileOptions.
+type Options struct {
+	// FoldCase makes the expression match case-insensitively, as if it
+	// was prefixed with (?i).
+	FoldCase bool
+
+	// WholeWord makes the expression match only at word boundaries, as if
+	// it was surrounded by \b.
+	WholeWord bool
+}
+
 // Compile parses a regular expression and returns, if successful,
 // a Regexp object that can be used to match against lines of text.
 func Compile(expr string) (*Regexp, error) {
-	re, err := syntax.Parse(expr, syntax.Perl)
+	return CompileOptions(expr, Options{})
+}
+
+// CompileOptions is like Compile, but interprets expr according to opts. The
+// options are reflected in the Syntax field, so that index.RegexpQuery
+// considers them when extracting trigrams.
+func CompileOptions(expr string, opts Options) (*Regexp, error) {
+	flags := syntax.Perl
+	if opts.FoldCase {
+		flags |= syntax.FoldCase
+	}
+	re, err := syntax.Parse(expr, flags)
 	if err != nil {
 		return nil, err
 	}
+	if opts.WholeWord {
+		re = &syntax.Regexp{
+			Op: syntax.OpConcat,
+			Sub: []*syntax.Regexp{
+				{Op: syntax.OpWordBoundary},
+				re,
+				{Op: syntax.OpWordBoundary},
+			},
+		}
+	}
 	sre := re.Simplify()
 	prog, err := syntax.Compile(sre)
 	if err != nil {
@@ -40,9 +80,14 @@ func Compile(expr string) (*Regexp, error) {
 	if err := toByteProg(prog); err != nil {
 		return nil, err
 	}
+	std, err := stdregexp.Compile(re.String())
+	if err != nil {
+		return nil, err
+	}
 	r := &Regexp{
 		Syntax: re,
 		expr:   expr,
+		std:    std,
 	}
 	if err := r.m.init(prog); err != nil {
 		return nil, err
@@ -57,3 +102,70 @@ func (r *Regexp) Match(b []byte, beginText, endText bool) (end int) {
 func (r *Regexp) MatchString(s string, beginText, endText bool) (end int) {
 	return r.m.matchString(s, beginText, endText)
 }
+
+// SubmatchIndex returns the byte offsets of the leftmost match of the
+// expression in line and of its capture groups, in the same format as
+// (*regexp.Regexp).FindSubmatchIndex. The offsets refer to
+// html.EscapeString(line), which is how lines are passed to clients.
+func (r *Regexp) SubmatchIndex(line []byte) []int {
+	return EscapeOffsets(line, r.std.FindSubmatchIndex(line))
+}
+
+// AllSubmatchIndex is like SubmatchIndex, but returns all successive
+// non-overlapping matches in line.
+func (r *Regexp) AllSubmatchIndex(line []byte) [][]int {
+	all := r.std.FindAllSubmatchIndex(line, -1)
+	if len(all) == 0 {
+		return all
+	}
+	// Translate the offsets of all matches at once, so that line is only
+	// walked once.
+	flat := make([]int, 0, len(all)*len(all[0]))
+	for _, offsets := range all {
+		flat = append(flat, offsets...)
+	}
+	flat = EscapeOffsets(line, flat)
+	for i, offsets := range all {
+		all[i], flat = flat[:len(offsets):len(offsets)], flat[len(offsets):]
+	}
+	return all
+}
+
+// escapeGrowth returns by how many bytes html.EscapeString grows c.
+func escapeGrowth(c byte) int {
+	switch c {
+	case '<', '>': // &lt; &gt;
+		return 3
+	case '&', '\'', '"': // &amp; &#39; &#34;
+		return 4
+	}
+	return 0
+}
+
+// EscapeOffsets translates byte offsets into line to byte offsets into
+// html.EscapeString(line). Negative offsets are left untouched.
+func EscapeOffsets(line []byte, offsets []int) []int {
+	if offsets == nil {
+		return nil
+	}
+	escaped := make([]int, len(offsets))
+	// Visit the offsets in ascending order, so that the growth of line up
+	// to each offset can be summed up in a single pass.
+	order := make([]int, 0, len(offsets))
+	for i, off := range offsets {
+		if off < 0 {
+			escaped[i] = off
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return offsets[order[i]] < offsets[order[j]] })
+	var pos, growth int
+	for _, i := range order {
+		for ; pos < offsets[i]; pos++ {
+			growth += escapeGrowth(line[pos])
+		}
+		escaped[i] = offsets[i] + growth
+	}
+	return escaped
+}
@@ -7,6 +7,7 @@ package regexp
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"reflect"
 	"strings"
 	"testing"
@@ -222,3 +223,101 @@ func TestGrep(t *testing.T) {
 		}
 	}
 }
+
+var optionsTests = []struct {
+	re   string
+	opts Options
+	s    string
+	m    []int
+}{
+	{`foo`, Options{}, "Foo\nfoo\n", []int{2}},
+	{`foo`, Options{FoldCase: true}, "Foo\nbar\nFOO\n", []int{1, 3}},
+	{`foo`, Options{WholeWord: true}, "foobar\nfoo bar\nbarfoo\n(foo)\n", []int{2, 4}},
+	{`foo|bar`, Options{WholeWord: true}, "foobar\nbar\n", []int{2}},
+	{`foo`, Options{FoldCase: true, WholeWord: true}, "FOObar\nFOO bar\n", []int{2}},
+}
+
+func TestCompileOptions(t *testing.T) {
+	for _, tt := range optionsTests {
+		re, err := CompileOptions("(?m)"+tt.re, tt.opts)
+		if err != nil {
+			t.Errorf("CompileOptions(%#q, %+v): %v", tt.re, tt.opts, err)
+			continue
+		}
+		lines := grep(re, []byte(tt.s))
+		if !reflect.DeepEqual(lines, tt.m) {
+			t.Errorf("grep(%#q (%+v), %q) = %v, want %v", tt.re, tt.opts, tt.s, lines, tt.m)
+		}
+	}
+}
+
+var submatchIndexTests = []struct {
+	re   string
+	opts Options
+	line string
+	want []int
+}{
+	{`foo`, Options{}, "a foo b", []int{2, 5}},
+	{`f(o+)`, Options{}, "a foo b", []int{2, 5, 3, 5}},
+	{`a(x)?b`, Options{}, "ab", []int{0, 2, -1, -1}},
+	{`foo`, Options{FoldCase: true}, "FOO", []int{0, 3}},
+	{`foo`, Options{WholeWord: true}, "foobar foo", []int{7, 10}},
+	// Offsets refer to the HTML-escaped line.
+	{`b>c`, Options{}, "a<b>c", []int{5, 11}},
+	{`x`, Options{}, "abc", nil},
+}
+
+func TestSubmatchIndex(t *testing.T) {
+	for _, tt := range submatchIndexTests {
+		re, err := CompileOptions(tt.re, tt.opts)
+		if err != nil {
+			t.Errorf("CompileOptions(%#q, %+v): %v", tt.re, tt.opts, err)
+			continue
+		}
+		if got := re.SubmatchIndex([]byte(tt.line)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SubmatchIndex(%#q (%+v), %q) = %v, want %v", tt.re, tt.opts, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeOffsets(t *testing.T) {
+	line := []byte(`if (a < b && c > "d") { s = 'e'; }`)
+	// Unordered, duplicate and negative offsets, as in nested or optional
+	// capture groups.
+	offsets := []int{18, 5, -1, len(line), 0, 9, 9, -1, 27}
+	got := EscapeOffsets(line, offsets)
+	for i, off := range offsets {
+		want := off
+		if off >= 0 {
+			want = len(html.EscapeString(string(line[:off])))
+		}
+		if got[i] != want {
+			t.Errorf("EscapeOffsets(%q, %v)[%d] = %d, want %d", line, offsets, i, got[i], want)
+		}
+	}
+}
+
+func TestAllSubmatchIndex(t *testing.T) {
+	re, err := CompileOptions(`<(\w)>`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte("<a> & <b>")
+	want := [][]int{{0, 9, 4, 5}, {16, 25, 20, 21}}
+	if got := re.AllSubmatchIndex(line); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllSubmatchIndex(%q) = %v, want %v", line, got, want)
+	}
+}
+
+func BenchmarkAllSubmatchIndexLongLine(b *testing.B) {
+	// e.g. minified JavaScript
+	line := bytes.Repeat([]byte(`if(a<b&&c){d("x")}`), 10000)
+	re, err := CompileOptions(`d\(`, Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		re.AllSubmatchIndex(line)
+	}
+}
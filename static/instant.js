@@ -122,15 +122,22 @@ function track(ev) {
         {"type": "application/json; charset=UTF-8"}));
 }
 
-function addSearchResult(results, result) {
+// Returns the result order selected by the sort= parameter, see
+// parseResultOrder in cmd/dcs-web/sort.go.
+function sortOrder() {
+    var sp = new URLSearchParams(location.search.slice(1));
+    return getDefault(sp, 'sort', 'ranking');
+}
+
+// If keepOrder is true, results are displayed in the order in which they
+// were added instead of being sorted by ranking.
+function addSearchResult(results, result, keepOrder) {
     var context = [];
 
     // NB: All of the following context lines are already HTML-escaped by the server.
-    context.push(result.ctxp2);
-    context.push(result.ctxp1);
+    context = context.concat(result.before || []);
     context.push('<strong>' + result.context + '</strong>');
-    context.push(result.ctxn1);
-    context.push(result.ctxn2);
+    context = context.concat(result.after || []);
     // Remove any empty context lines (e.g. when the match is close to the
     // beginning or end of the file).
     context = $.grep(context, function(elm, idx) { return $.trim(elm) != ""; });
@@ -142,10 +149,19 @@ function addSearchResult(results, result) {
     var sourcePackage = result.path.substring(0, delimiter);
     var rest = result.path.substring(delimiter);
 
+    // Identical matches in other packages were collapsed into this one.
+    var alsoIn = '';
+    if (result.also_in && result.also_in.length > 0) {
+        alsoIn = '<br><small>Also in ' + result.also_in.length + ' packages: ' + escapeForHTML(result.also_in.join(', ')) + '</small>';
+    }
+
     // Append the new search result, then sort the results.
-    var el = $('<li data-ranking="' + result.ranking + '"><a onclick="track(event);" href="/show?file=' + encodeURIComponent(result.path) + '&line=' + result.line + '"><code><strong>' + sourcePackage + '</strong>' + escapeForHTML(rest) + '</code></a><br><pre>' + context + '</pre><small>PathRank: ' + result.pathrank + ', Final: ' + result.ranking + '</small></li>');
+    var el = $('<li data-ranking="' + result.ranking + '"><a onclick="track(event);" href="/show?file=' + encodeURIComponent(result.path) + '&line=' + result.line + '"><code><strong>' + sourcePackage + '</strong>' + escapeForHTML(rest) + '</code></a><br><pre>' + context + '</pre><small>PathRank: ' + result.pathrank + ', Final: ' + result.ranking + '</small>' + alsoIn + '</li>');
     $(el).children('a').attr('data-path', result.path).attr('data-line', result.line);
     results.append(el);
+    if (keepOrder) {
+        return;
+    }
     $('ul#results').append($('ul#results>li').detach().sort(function(a, b) {
         return b.getAttribute('data-ranking') - a.getAttribute('data-ranking');
     }));
@@ -177,7 +193,9 @@ function loadPage(nr) {
     if (location.toString() !== pathname) {
         history.pushState({ searchterm: searchterm, nr: nr, perpkg: false }, 'page ' + nr, pathname);
     }
-    $.ajax('/results/' + queryid + '/page_' + nr + '.json')
+    var order = sortOrder();
+    var query = (order === 'ranking' ? '' : '?sort=' + encodeURIComponent(order));
+    $.ajax('/results/' + queryid + '/page_' + nr + '.json' + query)
         .done(function(data, textStatus, xhr) {
             clearTimeout(progress_bar_start);
             // TODO: experiment and see whether animating the results works
@@ -188,7 +206,7 @@ function loadPage(nr) {
             $('ul#results>li').remove();
             var ul = $('ul#results');
             $.each(data, function(idx, element) {
-                addSearchResult(ul, element);
+                addSearchResult(ul, element, order !== 'ranking');
             });
             progress(100, true, null);
         })
@@ -436,6 +454,8 @@ function onEvent(e) {
             error(false, true, msg.ErrorType, "This query has been cancelled by the server administrator (to preserve overall service health).");
         } else if (msg.ErrorType == "failed") {
             error(false, true, msg.ErrorType, "This query failed due to an unexpected internal server error.");
+        } else if (msg.ErrorType == "ratelimited") {
+            error(false, true, msg.ErrorType, "This query was not run: " + msg.ErrorMessage + ". Please try again later.");
         } else if (msg.ErrorType == "invalidquery") {
             error(false, true, msg.ErrorType, "This query was refused by the server: " + msg.ErrorMessage);
         } else {